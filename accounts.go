@@ -0,0 +1,154 @@
+package orderbook
+
+import "sort"
+
+// ownerIndex maps each account to the ids of its orders resting on one side
+// of the book, so that an account's orders can be found without a scan.
+// Orders with no OwnerId are not indexed.
+type ownerIndex map[int]map[int]struct{}
+
+func (idx *ownerIndex) add(o *Order) {
+	if o.OwnerId == 0 {
+		return
+	}
+	if *idx == nil {
+		*idx = make(ownerIndex)
+	}
+	ids := (*idx)[o.OwnerId]
+	if ids == nil {
+		ids = make(map[int]struct{})
+		(*idx)[o.OwnerId] = ids
+	}
+	ids[o.OrderId] = struct{}{}
+}
+
+func (idx *ownerIndex) remove(o *Order) {
+	idx.drop(o.OwnerId, o.OrderId)
+}
+
+func (idx *ownerIndex) drop(ownerId, orderId int) {
+	ids := (*idx)[ownerId]
+	if ids == nil {
+		return
+	}
+	delete(ids, orderId)
+	if len(ids) == 0 {
+		delete(*idx, ownerId)
+	}
+}
+
+// orders appends the account's orders resting in book to orders. Any id
+// no longer resting in book is dropped from the index rather than
+// returned.
+func (idx *ownerIndex) orders(orders []*Order, book Book, ownerId int) []*Order {
+	for id := range (*idx)[ownerId] {
+		e, ok := book.Get(id)
+		if !ok {
+			idx.drop(ownerId, id)
+			continue
+		}
+		orders = append(orders, e.Order())
+	}
+	return orders
+}
+
+// OrdersByOwner returns every order resting on either side of the book with
+// the given OwnerId, ordered by id, or nil if there are none. An index kept
+// as orders are added and removed makes this O(k log k) for k orders. The
+// orders are still resting and must not be modified.
+func (ob *OrderBook) OrdersByOwner(ownerId int) []*Order {
+	orders := ob.BidBook.owners.orders(nil, &ob.BidBook, ownerId)
+	orders = ob.AskBook.owners.orders(orders, &ob.AskBook, ownerId)
+	sort.Slice(orders, func(i, j int) bool {
+		return orders[i].OrderId < orders[j].OrderId
+	})
+	return orders
+}
+
+// CancelAllForOwner cancels every order resting on either side of the book
+// with the given OwnerId, as a single operation, and returns how many were
+// canceled. Conditional and stop orders that have not yet been triggered
+// are left alone.
+func (ob *OrderBook) CancelAllForOwner(ownerId int) int {
+	orders := ob.OrdersByOwner(ownerId)
+	for _, o := range orders {
+		ob.cancel(o.OrderId)
+	}
+	if len(orders) > 0 {
+		ob.publish(nil)
+	}
+	return len(orders)
+}
+
+// MakerVolume returns the cumulative volume an account has provided as the
+// resting maker in trades, e.g. for calculating liquidity rebates. Only
+// orders with an OwnerId are attributed.
+func (ob *OrderBook) MakerVolume(accountId int) int {
+	return ob.makerVolume[accountId]
+}
+
+// BestExcludingAccount returns the best price on side with volume from
+// accounts other than accountId, along with that other volume, so that a
+// market maker can see the best price that is not its own. Levels made up
+// entirely of the account's orders are skipped. ok is false if no such level
+// exists.
+func (ob *OrderBook) BestExcludingAccount(side Side, accountId int) (price float32, volume int, ok bool) {
+	for _, n := range ob.sortedLevels(side) {
+		for e := n.Level.Front(); e != nil; e = e.Next() {
+			if o := e.Order(); o.OwnerId != accountId {
+				volume += o.Quantity
+			}
+		}
+		if volume > 0 {
+			return n.Key.float32(), volume, true
+		}
+	}
+	return 0, 0, false
+}
+
+// AccountConcentration returns how many distinct accounts have orders resting
+// on side, and the account with the most volume resting there along with that
+// volume. Ties go to the lower account id. Unattributed orders are ignored.
+func (ob *OrderBook) AccountConcentration(side Side) (distinctAccounts int, topAccountVolume int, topAccountId int) {
+	volumes := make(map[int]int)
+	for _, n := range ob.levels(side) {
+		for e := n.Level.Front(); e != nil; e = e.Next() {
+			if o := e.Order(); o.OwnerId != 0 {
+				volumes[o.OwnerId] += o.Quantity
+			}
+		}
+	}
+	for id, volume := range volumes {
+		if volume > topAccountVolume || (volume == topAccountVolume && id < topAccountId) {
+			topAccountVolume, topAccountId = volume, id
+		}
+	}
+	return len(volumes), topAccountVolume, topAccountId
+}
+
+// SetRejectSelfCross makes InsertOrder reject, with RejectSelfCross, any
+// order that would cross a resting order from the same account on the
+// opposite side, e.g. an account's bid at or above its own ask. Only orders
+// with an OwnerId are checked. It is disabled by default.
+func (ob *OrderBook) SetRejectSelfCross(enabled bool) {
+	ob.rejectSelfCross = enabled
+}
+
+// selfCrosses reports whether o would cross a resting order from its own
+// account. Only the account's own orders on the opposite side are checked,
+// found through the owner index, so this is O(k) for k such orders.
+func (ob *OrderBook) selfCrosses(side Side, o *Order) bool {
+	if o.OwnerId == 0 {
+		return false
+	}
+	book, owners := Book(&ob.AskBook), ob.AskBook.owners
+	if side == ASK {
+		book, owners = &ob.BidBook, ob.BidBook.owners
+	}
+	for id := range owners[o.OwnerId] {
+		if e, ok := book.Get(id); ok && ob.crosses(side, o.Price, e.Order().Price) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,252 @@
+// Copyright 2024 Lane A. Shetron
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package orderbook
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMakerVolume(t *testing.T) {
+	ob := NewOrderBook()
+	ob.InsertOrder(ASK, &Order{OrderId: 1, Price: px(100.0), Quantity: 10, OwnerId: 7})
+	ob.InsertOrder(ASK, &Order{OrderId: 2, Price: px(100.0), Quantity: 10, OwnerId: 8})
+	ob.InsertOrder(ASK, &Order{OrderId: 3, Price: px(101.0), Quantity: 10, OwnerId: 7})
+
+	// Partial fill of account 7's first order
+	ob.InsertOrder(BID, &Order{OrderId: 4, Price: px(100.0), Quantity: 4, OwnerId: 9})
+	// Completes order 1 and partially fills order 2
+	ob.Insert(5, BID, 100.0, 9)
+	// Sweeps the rest of 100 and part of 101
+	ob.Insert(6, BID, 101.0, 10)
+
+	expected := map[int]int{7: 10 + 3, 8: 10, 9: 0}
+	for account, volume := range expected {
+		if v := ob.MakerVolume(account); v != volume {
+			t.Errorf("Expected maker volume %d for account %d, got %d", volume, account, v)
+		}
+	}
+	if v := ob.MakerVolume(0); v != 0 {
+		t.Errorf("Expected unattributed volume not to be tracked, got %d", v)
+	}
+}
+
+func TestBestExcludingAccount(t *testing.T) {
+	ob := NewOrderBook()
+	if _, _, ok := ob.BestExcludingAccount(BID, 7); ok {
+		t.Errorf("Expected no level for an empty book")
+	}
+	ob.InsertOrder(BID, &Order{OrderId: 1, Price: px(100.0), Quantity: 10, OwnerId: 7})
+	ob.InsertOrder(BID, &Order{OrderId: 2, Price: px(100.0), Quantity: 5, OwnerId: 7})
+	ob.InsertOrder(BID, &Order{OrderId: 3, Price: px(99.0), Quantity: 4, OwnerId: 7})
+	ob.InsertOrder(BID, &Order{OrderId: 4, Price: px(99.0), Quantity: 6, OwnerId: 8})
+	ob.Insert(5, BID, 99.0, 3)
+
+	// The touch is entirely account 7's, so skip to the next level
+	price, volume, ok := ob.BestExcludingAccount(BID, 7)
+	if !ok || price != 99.0 || volume != 9 {
+		t.Errorf("Expected 9 @ 99, got %d @ %f", volume, price)
+	}
+	price, volume, ok = ob.BestExcludingAccount(BID, 8)
+	if !ok || price != 100.0 || volume != 15 {
+		t.Errorf("Expected 15 @ 100, got %d @ %f", volume, price)
+	}
+	if _, _, ok := ob.BestExcludingAccount(ASK, 7); ok {
+		t.Errorf("Expected no ask level")
+	}
+}
+
+func TestAccountConcentration(t *testing.T) {
+	ob := NewOrderBook()
+	ob.InsertOrder(ASK, &Order{OrderId: 1, Price: px(100.0), Quantity: 50, OwnerId: 7})
+	ob.InsertOrder(ASK, &Order{OrderId: 2, Price: px(101.0), Quantity: 5, OwnerId: 8})
+	ob.InsertOrder(ASK, &Order{OrderId: 3, Price: px(102.0), Quantity: 40, OwnerId: 7})
+	ob.InsertOrder(ASK, &Order{OrderId: 4, Price: px(102.0), Quantity: 3, OwnerId: 9})
+	ob.Insert(5, ASK, 103.0, 100)
+	ob.InsertOrder(BID, &Order{OrderId: 6, Price: px(99.0), Quantity: 5, OwnerId: 9})
+	ob.InsertOrder(BID, &Order{OrderId: 7, Price: px(98.0), Quantity: 5, OwnerId: 8})
+
+	cases := []struct {
+		Side     Side
+		Distinct int
+		Volume   int
+		Account  int
+	}{
+		{ASK, 3, 90, 7},
+		// Tied accounts resolve to the lower id
+		{BID, 2, 5, 8},
+	}
+	for _, c := range cases {
+		t.Run(c.Side.String(), func(t *testing.T) {
+			distinct, volume, account := ob.AccountConcentration(c.Side)
+			if distinct != c.Distinct || volume != c.Volume || account != c.Account {
+				t.Errorf("Expected (%d, %d, %d), got (%d, %d, %d)", c.Distinct, c.Volume, c.Account, distinct, volume, account)
+			}
+		})
+	}
+}
+
+func TestRejectSelfCross(t *testing.T) {
+	ob := NewOrderBook()
+	ob.SetRejectSelfCross(true)
+	ob.InsertOrder(ASK, &Order{OrderId: 1, Price: px(100.0), Quantity: 5, OwnerId: 8})
+	ob.InsertOrder(ASK, &Order{OrderId: 2, Price: px(101.0), Quantity: 5, OwnerId: 7})
+
+	cases := []struct {
+		Name     string
+		Order    *Order
+		Rejected bool
+	}{
+		{"crosses own ask", &Order{OrderId: 3, Price: px(101.0), Quantity: 1, OwnerId: 7}, true},
+		{"crosses only others", &Order{OrderId: 4, Price: px(100.0), Quantity: 1, OwnerId: 7}, false},
+		{"other account", &Order{OrderId: 5, Price: px(101.0), Quantity: 1, OwnerId: 9}, false},
+		{"unattributed", &Order{OrderId: 6, Price: px(101.0), Quantity: 1}, false},
+	}
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			_, err := ob.InsertOrder(BID, c.Order)
+			var reject *RejectError
+			rejected := errors.As(err, &reject) && reject.Reason == RejectSelfCross
+			if rejected != c.Rejected {
+				t.Errorf("Expected rejected %v, got %v", c.Rejected, err)
+			}
+		})
+	}
+	if v, _ := ob.Inspect(1); v.Quantity != 2 {
+		t.Errorf("Expected the accepted bids to trade with order 1, got %d left", v.Quantity)
+	}
+}
+
+func TestOrdersByOwner(t *testing.T) {
+	ob := NewOrderBook()
+	place := func(id int, side Side, price float64, qty int, owner int) {
+		ob.InsertOrder(side, &Order{OrderId: id, Price: px(price), Quantity: qty, OwnerId: owner})
+	}
+	place(1, BID, 99.0, 5, 7)
+	place(2, BID, 98.0, 5, 8)
+	place(3, ASK, 101.0, 5, 7)
+	place(4, ASK, 102.0, 5, 7)
+	place(5, BID, 99.0, 5, 8)
+	place(6, ASK, 101.0, 5, 0)
+
+	ids := func(orders []*Order) []int {
+		var ids []int
+		for _, o := range orders {
+			ids = append(ids, o.OrderId)
+		}
+		return ids
+	}
+	equal := func(a, b []int) bool {
+		if len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if a[i] != b[i] {
+				return false
+			}
+		}
+		return true
+	}
+	if got := ids(ob.OrdersByOwner(7)); !equal(got, []int{1, 3, 4}) {
+		t.Errorf("Expected orders [1 3 4] for owner 7, got %v", got)
+	}
+
+	// Cancels, fills and reprices keep the index up to date
+	ob.Cancel(3)
+	ob.Insert(10, ASK, 99.0, 5)
+	ob.Update(4, 103.0, 5)
+	if got := ids(ob.OrdersByOwner(7)); !equal(got, []int{4}) {
+		t.Errorf("Expected orders [4] for owner 7, got %v", got)
+	}
+	if got := ids(ob.OrdersByOwner(8)); !equal(got, []int{2, 5}) {
+		t.Errorf("Expected orders [2 5] for owner 8, got %v", got)
+	}
+	ob.BidBook.RemoveLevel(px(98.0))
+	if got := ids(ob.OrdersByOwner(8)); !equal(got, []int{5}) {
+		t.Errorf("Expected orders [5] for owner 8, got %v", got)
+	}
+	if got := ob.OrdersByOwner(9); got != nil {
+		t.Errorf("Expected no orders for an unknown owner, got %v", ids(got))
+	}
+
+	// Restoring a snapshot rebuilds the index
+	data, _ := ob.Snapshot()
+	restored := NewOrderBook()
+	restored.Restore(data)
+	if got := ids(restored.OrdersByOwner(8)); !equal(got, []int{5}) {
+		t.Errorf("Expected orders [5] for owner 8 after restore, got %v", got)
+	}
+	ob.Clear()
+	if got := ob.OrdersByOwner(8); got != nil {
+		t.Errorf("Expected no orders after clearing, got %v", ids(got))
+	}
+
+	// PopLevel takes its orders out of the index, and an id left in the
+	// index that is no longer resting is skipped and pruned
+	place(20, BID, 99.0, 5, 8)
+	place(21, BID, 98.0, 5, 8)
+	ob.BidBook.PopLevel()
+	ob.AskBook.owners.add(&Order{OrderId: 22, OwnerId: 8})
+	if got := ids(ob.OrdersByOwner(8)); !equal(got, []int{21}) {
+		t.Errorf("Expected orders [21] for owner 8, got %v", got)
+	}
+	if _, ok := ob.AskBook.owners[8]; ok {
+		t.Errorf("Expected the stale entry to be pruned")
+	}
+}
+
+func TestCancelAllForOwner(t *testing.T) {
+	ob := NewOrderBook()
+	var cancelled []int
+	ob.OnCancel(func(orderId int) { cancelled = append(cancelled, orderId) })
+	updates := 0
+	ob.OnIncrementalUpdate(func(IncrementalUpdate) { updates++ })
+
+	ob.InsertOrder(BID, &Order{OrderId: 1, Price: px(99.0), Quantity: 5, OwnerId: 7})
+	ob.InsertOrder(BID, &Order{OrderId: 2, Price: px(99.0), Quantity: 5, OwnerId: 8})
+	ob.InsertOrder(BID, &Order{OrderId: 3, Price: px(98.0), Quantity: 5, OwnerId: 7})
+	ob.InsertOrder(ASK, &Order{OrderId: 4, Price: px(101.0), Quantity: 5, OwnerId: 7})
+	ob.InsertOrder(ASK, &Order{OrderId: 5, Price: px(102.0), Quantity: 5, OwnerId: 8})
+	ob.InsertOrder(ASK, &Order{OrderId: 6, Price: px(102.0), Quantity: 5, OwnerId: 7})
+
+	updates = 0
+	if n := ob.CancelAllForOwner(7); n != 4 {
+		t.Errorf("Expected 4 orders canceled, got %d", n)
+	}
+	if len(cancelled) != 4 || updates != 1 {
+		t.Errorf("Expected 4 cancel events in one update, got %v in %d", cancelled, updates)
+	}
+	for _, id := range []int{1, 3, 4, 6} {
+		if _, ok := ob.Inspect(id); ok {
+			t.Errorf("Expected order %d to be canceled", id)
+		}
+	}
+	for _, id := range []int{2, 5} {
+		if _, ok := ob.Inspect(id); !ok {
+			t.Errorf("Expected order %d to remain", id)
+		}
+	}
+	if ob.LevelCount(BID) != 1 || ob.LevelCount(ASK) != 1 {
+		t.Errorf("Expected one level left on each side, got %d and %d", ob.LevelCount(BID), ob.LevelCount(ASK))
+	}
+	if orders := ob.OrdersByOwner(7); orders != nil {
+		t.Errorf("Expected the owner index to be empty, got %d orders", len(orders))
+	}
+
+	updates = 0
+	if n := ob.CancelAllForOwner(7); n != 0 || updates != 0 {
+		t.Errorf("Expected nothing to cancel and no update, got %d and %d updates", n, updates)
+	}
+	checkConsistency(t, ob)
+}
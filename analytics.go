@@ -0,0 +1,451 @@
+package orderbook
+
+import "sort"
+
+// top returns the best price level of a book, or nil if the book is empty.
+func top(b Book) *Node {
+	if b.Len() == 0 {
+		return nil
+	}
+	n, _ := b.GetLevel(b.Peek().Price)
+	return n
+}
+
+// sortedLevels returns the price levels on one side of the book ordered from
+// best to worst. The heap only keeps its root in order, so this copies and
+// sorts the levels, which is O(n log n) for n levels.
+func (ob *OrderBook) sortedLevels(side Side) []*Node {
+	var levels BaseHeap
+	if side == ASK {
+		levels = ob.AskBook.Orders.BaseHeap
+	} else {
+		levels = ob.BidBook.Orders.BaseHeap
+	}
+	sorted := make([]*Node, len(levels))
+	copy(sorted, levels)
+	sort.Slice(sorted, func(i, j int) bool {
+		if side == ASK {
+			return sorted[i].Key < sorted[j].Key
+		}
+		return sorted[i].Key > sorted[j].Key
+	})
+	return sorted
+}
+
+// IterateLevels calls fn for each price level on side from best to worst,
+// bids from highest and asks from lowest, until fn returns false. The levels
+// are sorted up front, which is O(n log n) for n levels, and must not be
+// modified by fn.
+func (ob *OrderBook) IterateLevels(side Side, fn func(*Node) bool) {
+	for _, n := range ob.sortedLevels(side) {
+		if !fn(n) {
+			return
+		}
+	}
+}
+
+// IterateOrders calls fn for each order resting on side in full price-time
+// priority, the order in which repeated calls to Pop would return them,
+// until fn returns false. Orders must not be modified by fn.
+func (ob *OrderBook) IterateOrders(side Side, fn func(*Order) bool) {
+	ob.IterateLevels(side, func(n *Node) bool {
+		for e := n.Level.Front(); e != nil; e = e.Next() {
+			if !fn(e.Order()) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// OldestOrder returns the order resting on side with the earliest
+// Timestamp, or nil if no order on that side has one, e.g. because the book
+// has no clock. Ties go to the order with the higher priority. This visits
+// every order on side. The order is still resting and must not be modified.
+func (ob *OrderBook) OldestOrder(side Side) *Order {
+	var oldest *Order
+	ob.IterateOrders(side, func(o *Order) bool {
+		if !o.Timestamp.IsZero() && (oldest == nil || o.Timestamp.Before(oldest.Timestamp)) {
+			oldest = o
+		}
+		return true
+	})
+	return oldest
+}
+
+// TopOrders returns up to n orders resting on side in the order they would
+// be matched, walking levels from best to worst. Within a level, displayed
+// orders come before hidden ones under VisibleFirst, as in matching. The
+// orders are copies, so they may be kept and modified freely.
+func (ob *OrderBook) TopOrders(side Side, n int) []*Order {
+	var orders []*Order
+	ob.IterateLevels(side, func(l *Node) bool {
+		var hidden []*Order
+		for e := l.Level.Front(); e != nil && len(orders) < n; e = e.Next() {
+			c := copyOrder(e.Order())
+			if c.Hidden && ob.hiddenPriority != TimePriority {
+				hidden = append(hidden, &c)
+				continue
+			}
+			orders = append(orders, &c)
+		}
+		for _, o := range hidden {
+			if len(orders) == n {
+				break
+			}
+			orders = append(orders, o)
+		}
+		return len(orders) < n
+	})
+	return orders
+}
+
+// TouchImbalance returns the order imbalance at the top of the book,
+// (bidVol - askVol) / (bidVol + askVol), using only the volume resting at the
+// best bid and best ask. The result ranges from -1 (all ask) to 1 (all bid).
+// ok is false if either side of the book is empty.
+func (ob *OrderBook) TouchImbalance() (float64, bool) {
+	bid, ask := top(&ob.BidBook), top(&ob.AskBook)
+	if bid == nil || ask == nil {
+		return 0, false
+	}
+	bidVol, askVol := float64(bid.Volume()), float64(ask.Volume())
+	return (bidVol - askVol) / (bidVol + askVol), true
+}
+
+// Imbalance returns the order imbalance over the best levels price levels on
+// each side, (bidVol - askVol) / (bidVol + askVol), from -1 (all ask) to 1
+// (all bid). A book with only bids gives 1, one with only asks gives -1, and
+// an empty book gives 0.
+func (ob *OrderBook) Imbalance(levels int) float32 {
+	bidVol, askVol := ob.topVolume(BID, levels), ob.topVolume(ASK, levels)
+	if bidVol+askVol == 0 {
+		return 0
+	}
+	return float32(bidVol-askVol) / float32(bidVol+askVol)
+}
+
+// topVolume returns the total volume of the best levels price levels on side.
+func (ob *OrderBook) topVolume(side Side, levels int) int {
+	total := 0
+	for i, n := range ob.sortedLevels(side) {
+		if i == levels {
+			break
+		}
+		total += n.Volume()
+	}
+	return total
+}
+
+// ExpectedFillPrice returns the volume-weighted average price at which an
+// order for quantity on the given side would fill if it swept the opposite
+// side of the book, which is left unchanged. ok is false if the opposite
+// side does not hold enough volume to fill quantity in full.
+func (ob *OrderBook) ExpectedFillPrice(side Side, quantity int) (float32, bool) {
+	if quantity <= 0 {
+		return 0, false
+	}
+	maker := BID
+	if side == BID {
+		maker = ASK
+	}
+
+	remaining := quantity
+	var notional float64
+	for _, n := range ob.sortedLevels(maker) {
+		qty := min(n.Volume(), remaining)
+		notional += n.Key.Float() * float64(qty)
+		remaining -= qty
+		if remaining == 0 {
+			return float32(notional / float64(quantity)), true
+		}
+	}
+	return 0, false
+}
+
+// MarketImpact returns what a market order for quantity on side would do
+// if it arrived now, without changing the book: the volume-weighted average
+// price of its fills, the quantity that would fill, and whether it would
+// consume every resting order on the opposite side and still be unfilled.
+// It is matched as SimulateInsert matches an order, following the book's
+// matching mode, sweep distance cap and other settings, except that limits
+// on order quantity do not apply. vwap is zero if nothing would fill.
+func (ob *OrderBook) MarketImpact(side Side, quantity int) (vwap float32, filled int, exhausted bool) {
+	maker := BID
+	if side == BID {
+		maker = ASK
+	}
+	// A limit at the worst opposite price crosses every level
+	var worst Price
+	first := true
+	for price := range ob.levels(maker) {
+		if first || (side == BID && price > worst) || (side == ASK && price < worst) {
+			worst, first = price, false
+		}
+	}
+	if first || quantity <= 0 {
+		return 0, 0, false
+	}
+
+	sim := ob.crossingCopy(side, worst)
+	sim.maxOrderQuantity, sim.minQuantity, sim.lotSize = 0, 0, 0
+	trades, err := sim.insertOrder(side, NewOrder(ob.nextAutoId(ob.lastAutoId), worst, quantity))
+	if err != nil {
+		return 0, 0, false
+	}
+	var notional float64
+	for _, t := range trades {
+		notional += t.Price.Float() * float64(t.Volume)
+		filled += t.Volume
+	}
+	if filled > 0 {
+		vwap = float32(notional / float64(filled))
+	}
+	makerBook, _ := sim.books(side)
+	return vwap, filled, filled < quantity && makerBook.Len() == 0
+}
+
+// EffectiveSpread returns the round-trip cost of trading size on both sides
+// of the book: the average price to buy size less the average price to sell
+// it. Unlike the quoted spread it accounts for the depth of the book.
+// ok is false if either side cannot fill size in full.
+func (ob *OrderBook) EffectiveSpread(size int) (float32, bool) {
+	buy, ok := ob.ExpectedFillPrice(BID, size)
+	if !ok {
+		return 0, false
+	}
+	sell, ok := ob.ExpectedFillPrice(ASK, size)
+	if !ok {
+		return 0, false
+	}
+	return buy - sell, true
+}
+
+// levels returns the price levels on one side of the book, keyed by price.
+func (ob *OrderBook) levels(side Side) LevelsMap {
+	if side == ASK {
+		return ob.AskBook.LevelsMap
+	}
+	return ob.BidBook.LevelsMap
+}
+
+// OrderCount returns the number of orders resting on side.
+func (ob *OrderBook) OrderCount(side Side) int {
+	if side == ASK {
+		return len(ob.AskBook.OrdersMap)
+	}
+	return len(ob.BidBook.OrdersMap)
+}
+
+// LevelCount returns the number of price levels on side.
+func (ob *OrderBook) LevelCount(side Side) int {
+	return len(ob.levels(side))
+}
+
+// TotalVolume returns the total volume resting on side, including hidden
+// orders and iceberg reserves.
+func (ob *OrderBook) TotalVolume(side Side) int {
+	total := 0
+	for _, n := range ob.levels(side) {
+		total += n.Volume()
+	}
+	return total
+}
+
+// ShapeMetrics summarizes how orders are distributed across the price levels
+// on one side of the book.
+type ShapeMetrics struct {
+	Levels             int
+	Orders             int
+	Volume             int
+	MeanOrdersPerLevel float64
+	MaxOrdersPerLevel  int
+	// MinPrice and MaxPrice bound the prices of the resting levels.
+	MinPrice float32
+	MaxPrice float32
+}
+
+// ShapeMetrics computes summary shape metrics for one side of the book in a
+// single pass over its levels. All fields are zero for an empty side.
+func (ob *OrderBook) ShapeMetrics(side Side) ShapeMetrics {
+	var m ShapeMetrics
+	var lo, hi Price
+	for price, n := range ob.levels(side) {
+		count := n.Level.Len()
+		if m.Levels == 0 || price < lo {
+			lo = price
+		}
+		if m.Levels == 0 || price > hi {
+			hi = price
+		}
+		m.Levels++
+		m.Orders += count
+		m.Volume += n.Volume()
+		m.MaxOrdersPerLevel = max(m.MaxOrdersPerLevel, count)
+	}
+	if m.Levels > 0 {
+		m.MeanOrdersPerLevel = float64(m.Orders) / float64(m.Levels)
+		m.MinPrice, m.MaxPrice = lo.float32(), hi.float32()
+	}
+	return m
+}
+
+// BestBid returns the highest priority bid, or false if there are no bids.
+// The order is still resting and must not be modified.
+func (ob *OrderBook) BestBid() (*Order, bool) {
+	o := ob.BidBook.Peek()
+	return o, o != nil
+}
+
+// BestAsk returns the highest priority ask, or false if there are no asks.
+// The order is still resting and must not be modified.
+func (ob *OrderBook) BestAsk() (*Order, bool) {
+	o := ob.AskBook.Peek()
+	return o, o != nil
+}
+
+// Spread returns the best ask price less the best bid price. ok is false if
+// either side of the book is empty.
+func (ob *OrderBook) Spread() (float32, bool) {
+	bid, bidOk := ob.BestBid()
+	ask, askOk := ob.BestAsk()
+	if !bidOk || !askOk {
+		return 0, false
+	}
+	return (ask.Price - bid.Price).float32(), true
+}
+
+// Mid returns the mid price, halfway between the best bid and best ask. ok
+// is false if either side of the book is empty.
+func (ob *OrderBook) Mid() (float32, bool) {
+	bid, bidOk := ob.BestBid()
+	ask, askOk := ob.BestAsk()
+	if !bidOk || !askOk {
+		return 0, false
+	}
+	return float32((bid.Price.Float() + ask.Price.Float()) / 2), true
+}
+
+// Microprice returns the mid price weighted by the volume at the best bid
+// and ask, (bid*askVol + ask*bidVol) / (bidVol + askVol), which leans
+// towards the price of the side with less volume, since that side is more
+// likely to be taken out first.
+// ok is false if either side of the book is empty.
+func (ob *OrderBook) Microprice() (float32, bool) {
+	bid, ask := top(&ob.BidBook), top(&ob.AskBook)
+	if bid == nil || ask == nil {
+		return 0, false
+	}
+	bidVol, askVol := float64(bid.Volume()), float64(ask.Volume())
+	return float32((bid.Key.Float()*askVol + ask.Key.Float()*bidVol) / (bidVol + askVol)), true
+}
+
+// VolumeToMid returns the volume an order on side could take from the
+// opposite side of the book at prices at or better than the mid price, i.e.
+// the marketable depth from the touch up to and including the mid. This is
+// only non-zero while the book is crossed, such as while matching is paused.
+// ok is false if either side of the book is empty.
+func (ob *OrderBook) VolumeToMid(side Side) (int, bool) {
+	bid, bidOk := ob.BestBid()
+	ask, askOk := ob.BestAsk()
+	if !bidOk || !askOk {
+		return 0, false
+	}
+	// Twice the mid, so that it is exact
+	mid2 := bid.Price + ask.Price
+
+	maker := ASK
+	if side == ASK {
+		maker = BID
+	}
+	total := 0
+	for _, n := range ob.sortedLevels(maker) {
+		if (maker == ASK && 2*n.Key > mid2) || (maker == BID && 2*n.Key < mid2) {
+			break
+		}
+		total += n.Volume()
+	}
+	return total, true
+}
+
+// displayedTop returns the best level on one side that has displayed volume,
+// along with that volume. Levels holding only hidden orders are skipped, as
+// they would not appear on a public feed.
+func (ob *OrderBook) displayedTop(side Side) (float32, int, bool) {
+	for _, n := range ob.sortedLevels(side) {
+		if vol := n.VolumeIncluding(false); vol > 0 {
+			return n.Key.float32(), vol, true
+		}
+	}
+	return 0, 0, false
+}
+
+// DisplayedTouch returns the best bid and ask as shown on a public feed: the
+// best prices with displayed volume and the displayed size at each,
+// excluding hidden quantity. ok is false if either side has no displayed
+// volume.
+func (ob *OrderBook) DisplayedTouch() (bidPrice float32, bidDisplayVol int, askPrice float32, askDisplayVol int, ok bool) {
+	bidPrice, bidDisplayVol, bidOk := ob.displayedTop(BID)
+	askPrice, askDisplayVol, askOk := ob.displayedTop(ASK)
+	if !bidOk || !askOk {
+		return 0, 0, 0, 0, false
+	}
+	return bidPrice, bidDisplayVol, askPrice, askDisplayVol, true
+}
+
+// QueuePosition returns the volume resting ahead of an order at its price
+// level, i.e. how much must trade at that price before the order begins to
+// fill under FIFO matching. ok is false if the order is not in the book.
+func (ob *OrderBook) QueuePosition(orderId int) (ahead int, ok bool) {
+	_, e, ok := ob.find(orderId)
+	if !ok {
+		return 0, false
+	}
+	for e = e.Prev(); e != nil; e = e.Prev() {
+		ahead += e.Order().Quantity
+	}
+	return ahead, true
+}
+
+// EstimateFillIndex replays a recorded sequence of fill volumes at an order's
+// price level and returns the index of the fill at which an order with
+// queueAhead volume ahead of it (see QueuePosition) and the given quantity
+// would have filled in full, assuming FIFO matching and no cancellations
+// ahead of it. ok is false if the fills are not enough to complete it.
+func EstimateFillIndex(levelFills []int, queueAhead int, quantity int) (int, bool) {
+	need := queueAhead + quantity
+	cumulative := 0
+	for i, v := range levelFills {
+		cumulative += v
+		if cumulative >= need {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// RealizedSpread returns the realized spread of a trade against the mid price
+// some time after it, 2 * (price - laterMid) for a buyer-initiated trade and
+// 2 * (laterMid - price) for a seller-initiated one. It measures what the
+// liquidity provider kept once the price had moved; a negative value means
+// the taker was informed and the maker lost out.
+func RealizedSpread(t Trade, laterMid float32) float32 {
+	if t.TakerSide == ASK {
+		return 2 * (laterMid - t.Price.float32())
+	}
+	return 2 * (t.Price.float32() - laterMid)
+}
+
+// CumulativeOrderCount returns the number of orders resting on side at or
+// better than price, walking the levels out from the touch.
+func (ob *OrderBook) CumulativeOrderCount(side Side, price float32) int {
+	count := 0
+	limit := float32Price(price)
+	for _, n := range ob.sortedLevels(side) {
+		if (side == BID && n.Key < limit) || (side == ASK && n.Key > limit) {
+			break
+		}
+		count += n.Level.Len()
+	}
+	return count
+}
@@ -0,0 +1,588 @@
+// Copyright 2024 Lane A. Shetron
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package orderbook
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestTouchImbalance(t *testing.T) {
+	ob := NewOrderBook()
+	if _, ok := ob.TouchImbalance(); ok {
+		t.Errorf("Expected no imbalance for an empty book")
+	}
+	ob.Insert(1, BID, 99.0, 30)
+	ob.Insert(2, BID, 99.0, 10)
+	ob.Insert(3, BID, 98.0, 500)
+	if _, ok := ob.TouchImbalance(); ok {
+		t.Errorf("Expected no imbalance for a one-sided book")
+	}
+	ob.Insert(4, ASK, 101.0, 10)
+	ob.Insert(5, ASK, 102.0, 500)
+
+	// Only the best levels count: (40 - 10) / (40 + 10)
+	imbalance, ok := ob.TouchImbalance()
+	if !ok || imbalance != 0.6 {
+		t.Errorf("Expected imbalance 0.6, got %f", imbalance)
+	}
+}
+
+func TestImbalance(t *testing.T) {
+	tests := []struct {
+		name     string
+		bids     []int
+		asks     []int
+		levels   int
+		expected float32
+	}{
+		{"empty", nil, nil, 5, 0},
+		{"bids only", []int{10, 20}, nil, 5, 1},
+		{"asks only", nil, []int{10}, 5, -1},
+		{"balanced", []int{10, 20}, []int{20, 10}, 2, 0},
+		{"bid heavy", []int{30, 10}, []int{5, 5}, 2, 0.6},
+		{"ask heavy", []int{5, 5}, []int{30, 10}, 2, -0.6},
+		{"deeper levels ignored", []int{10, 500}, []int{30, 10}, 1, -0.5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ob := NewOrderBook()
+			id := 0
+			for i, vol := range tt.bids {
+				id++
+				ob.Insert(id, BID, float32(99-i), vol)
+			}
+			for i, vol := range tt.asks {
+				id++
+				ob.Insert(id, ASK, float32(101+i), vol)
+			}
+			if imbalance := ob.Imbalance(tt.levels); imbalance != tt.expected {
+				t.Errorf("Expected imbalance %v, got %v", tt.expected, imbalance)
+			}
+		})
+	}
+}
+
+func TestEffectiveSpread(t *testing.T) {
+	ob := NewOrderBook()
+	ob.Insert(1, BID, 99.0, 10)
+	ob.Insert(2, BID, 98.0, 10)
+	ob.Insert(3, BID, 96.0, 20)
+	ob.Insert(4, ASK, 101.0, 10)
+	ob.Insert(5, ASK, 103.0, 10)
+	ob.Insert(6, ASK, 104.0, 20)
+
+	cases := []struct {
+		Size   int
+		Buy    float32
+		Sell   float32
+		Spread float32
+		Ok     bool
+	}{
+		{5, 101.0, 99.0, 2.0, true},
+		{20, 102.0, 98.5, 3.5, true},
+		{40, 103.0, 97.25, 5.75, true},
+		{41, 0, 0, 0, false},
+	}
+	for _, c := range cases {
+		t.Run(fmt.Sprintf("size-%d", c.Size), func(t *testing.T) {
+			if c.Ok {
+				if buy, _ := ob.ExpectedFillPrice(BID, c.Size); buy != c.Buy {
+					t.Errorf("Expected buy price %f, got %f", c.Buy, buy)
+				}
+				if sell, _ := ob.ExpectedFillPrice(ASK, c.Size); sell != c.Sell {
+					t.Errorf("Expected sell price %f, got %f", c.Sell, sell)
+				}
+			}
+			spread, ok := ob.EffectiveSpread(c.Size)
+			if ok != c.Ok || spread != c.Spread {
+				t.Errorf("Expected effective spread %f (%t), got %f (%t)", c.Spread, c.Ok, spread, ok)
+			}
+		})
+	}
+	if ob.AskBook.Len() != 3 || ob.BidBook.Len() != 3 {
+		t.Errorf("Expected the book to be unchanged")
+	}
+}
+
+func TestShapeMetrics(t *testing.T) {
+	ob := NewOrderBook()
+	if m := ob.ShapeMetrics(BID); m != (ShapeMetrics{}) {
+		t.Errorf("Expected zero metrics for an empty side, got %+v", m)
+	}
+
+	ob.Insert(1, BID, 99.0, 10)
+	ob.Insert(2, BID, 99.0, 5)
+	ob.Insert(3, BID, 99.0, 5)
+	ob.Insert(4, BID, 98.0, 1)
+	ob.Insert(5, BID, 95.0, 2)
+	ob.Insert(6, BID, 95.0, 2)
+	ob.Insert(7, ASK, 101.0, 7)
+
+	expected := ShapeMetrics{
+		Levels:             3,
+		Orders:             6,
+		Volume:             25,
+		MeanOrdersPerLevel: 2,
+		MaxOrdersPerLevel:  3,
+		MinPrice:           95.0,
+		MaxPrice:           99.0,
+	}
+	if m := ob.ShapeMetrics(BID); m != expected {
+		t.Errorf("Expected %+v, got %+v", expected, m)
+	}
+	expected = ShapeMetrics{1, 1, 7, 1, 1, 101.0, 101.0}
+	if m := ob.ShapeMetrics(ASK); m != expected {
+		t.Errorf("Expected %+v, got %+v", expected, m)
+	}
+}
+
+func TestVolumeToMid(t *testing.T) {
+	ob := NewOrderBook()
+	if _, ok := ob.VolumeToMid(BID); ok {
+		t.Errorf("Expected no volume for an empty book")
+	}
+	ob.Insert(1, BID, 99.0, 5)
+	ob.Insert(2, ASK, 101.0, 5)
+	if v, ok := ob.VolumeToMid(BID); !ok || v != 0 {
+		t.Errorf("Expected no volume to mid for an uncrossed book, got %d", v)
+	}
+
+	// Crossed while paused: best bid 106, best ask 100, mid 103
+	ob.Pause()
+	ob.Insert(3, ASK, 100.0, 1)
+	ob.Insert(4, ASK, 102.0, 2)
+	ob.Insert(5, ASK, 103.0, 4)
+	ob.Insert(6, ASK, 104.0, 8)
+	ob.Insert(7, BID, 106.0, 10)
+	ob.Insert(8, BID, 103.5, 20)
+	ob.Insert(9, BID, 102.5, 40)
+
+	if v, ok := ob.VolumeToMid(BID); !ok || v != 12 {
+		t.Errorf("Expected 12 ask volume at or below the mid, got %d", v)
+	}
+	if v, ok := ob.VolumeToMid(ASK); !ok || v != 30 {
+		t.Errorf("Expected 30 bid volume at or above the mid, got %d", v)
+	}
+}
+
+func TestDisplayedTouch(t *testing.T) {
+	ob := NewOrderBook()
+	if _, _, _, _, ok := ob.DisplayedTouch(); ok {
+		t.Errorf("Expected no displayed touch for an empty book")
+	}
+	ob.Insert(1, BID, 99.0, 5)
+	ob.InsertOrder(BID, &Order{OrderId: 2, Price: px(99.0), Quantity: 20, Hidden: true})
+	ob.Insert(3, BID, 99.0, 3)
+	ob.InsertOrder(ASK, &Order{OrderId: 4, Price: px(100.0), Quantity: 10, Hidden: true})
+	ob.Insert(5, ASK, 101.0, 7)
+
+	bidPrice, bidVol, askPrice, askVol, ok := ob.DisplayedTouch()
+	if !ok {
+		t.Fatalf("Expected a displayed touch")
+	}
+	if bidPrice != 99.0 || bidVol != 8 {
+		t.Errorf("Expected displayed bid 8 @ 99, got %d @ %v", bidVol, bidPrice)
+	}
+	// The 100 level holds only hidden volume so the displayed ask is 101
+	if askPrice != 101.0 || askVol != 7 {
+		t.Errorf("Expected displayed ask 7 @ 101, got %d @ %v", askVol, askPrice)
+	}
+}
+
+func TestQueuePosition(t *testing.T) {
+	ob := NewOrderBook()
+	ob.Insert(1, BID, 99.0, 5)
+	ob.Insert(2, BID, 99.0, 7)
+	ob.Insert(3, BID, 99.0, 4)
+	ob.Insert(4, BID, 98.0, 100)
+
+	for id, expected := range map[int]int{1: 0, 2: 5, 3: 12, 4: 0} {
+		if ahead, ok := ob.QueuePosition(id); !ok || ahead != expected {
+			t.Errorf("Expected %d ahead of order %d, got %d", expected, id, ahead)
+		}
+	}
+	if _, ok := ob.QueuePosition(5); ok {
+		t.Errorf("Expected no queue position for a missing order")
+	}
+}
+
+func TestEstimateFillIndex(t *testing.T) {
+	fills := []int{3, 4, 2, 6, 1, 5}
+	cases := []struct {
+		Ahead    int
+		Quantity int
+		Index    int
+		Ok       bool
+	}{
+		{0, 3, 0, true},
+		{0, 4, 1, true},
+		{7, 2, 2, true},
+		{12, 4, 4, true},
+		{15, 6, 5, true},
+		{15, 7, 0, false},
+	}
+	for _, c := range cases {
+		t.Run(fmt.Sprintf("%d+%d", c.Ahead, c.Quantity), func(t *testing.T) {
+			i, ok := EstimateFillIndex(fills, c.Ahead, c.Quantity)
+			if ok != c.Ok || i != c.Index {
+				t.Errorf("Expected (%d, %v), got (%d, %v)", c.Index, c.Ok, i, ok)
+			}
+		})
+	}
+
+	// Composed with QueuePosition for a resting order
+	ob := NewOrderBook()
+	ob.Insert(1, ASK, 101.0, 6)
+	ob.Insert(2, ASK, 101.0, 4)
+	ahead, _ := ob.QueuePosition(2)
+	if i, ok := EstimateFillIndex(fills, ahead, 4); !ok || i != 3 {
+		t.Errorf("Expected order 2 to fill at index 3, got %d", i)
+	}
+}
+
+func TestRealizedSpread(t *testing.T) {
+	ob := NewOrderBook()
+	ob.Insert(1, BID, 99.0, 10)
+	ob.Insert(2, ASK, 101.0, 10)
+	buys, _ := ob.Insert(3, BID, 101.0, 5)
+	sells, _ := ob.Insert(4, ASK, 99.0, 5)
+
+	cases := []struct {
+		Name     string
+		Trade    Trade
+		Mid      float32
+		Expected float32
+	}{
+		{"buy, mid unchanged", buys[0], 100.0, 2.0},
+		{"buy, mid moved up", buys[0], 100.75, 0.5},
+		{"buy, mid moved through", buys[0], 102.0, -2.0},
+		{"sell, mid unchanged", sells[0], 100.0, 2.0},
+		{"sell, mid moved down", sells[0], 98.5, -1.0},
+	}
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			if s := RealizedSpread(c.Trade, c.Mid); s != c.Expected {
+				t.Errorf("Expected %v, got %v", c.Expected, s)
+			}
+		})
+	}
+}
+
+func TestCumulativeOrderCount(t *testing.T) {
+	ob := NewOrderBook()
+	id := 0
+	for price, count := range map[float32]int{99.0: 1, 98.0: 3, 97.0: 2, 95.0: 4} {
+		for i := 0; i < count; i++ {
+			id++
+			ob.Insert(id, BID, price, 1)
+		}
+	}
+	ob.Insert(id+1, ASK, 101.0, 1)
+	ob.Insert(id+2, ASK, 101.0, 1)
+	ob.Insert(id+3, ASK, 102.0, 1)
+
+	cases := []struct {
+		Side     Side
+		Price    float32
+		Expected int
+	}{
+		{BID, 100.0, 0},
+		{BID, 99.0, 1},
+		{BID, 97.5, 4},
+		{BID, 97.0, 6},
+		{BID, 90.0, 10},
+		{ASK, 100.0, 0},
+		{ASK, 101.0, 2},
+		{ASK, 110.0, 3},
+	}
+	for _, c := range cases {
+		t.Run(fmt.Sprintf("%s-%v", c.Side, c.Price), func(t *testing.T) {
+			if count := ob.CumulativeOrderCount(c.Side, c.Price); count != c.Expected {
+				t.Errorf("Expected %d orders, got %d", c.Expected, count)
+			}
+		})
+	}
+}
+
+func TestBestPrices(t *testing.T) {
+	ob := NewOrderBook()
+	check := func(name string, bidOk, askOk bool, spread, mid float32) {
+		t.Run(name, func(t *testing.T) {
+			if _, ok := ob.BestBid(); ok != bidOk {
+				t.Errorf("Expected best bid %v, got %v", bidOk, ok)
+			}
+			if _, ok := ob.BestAsk(); ok != askOk {
+				t.Errorf("Expected best ask %v, got %v", askOk, ok)
+			}
+			s, sOk := ob.Spread()
+			m, mOk := ob.Mid()
+			if sOk != (bidOk && askOk) || mOk != sOk || s != spread || m != mid {
+				t.Errorf("Expected spread %v and mid %v, got %v (%v) and %v (%v)", spread, mid, s, sOk, m, mOk)
+			}
+		})
+	}
+
+	check("empty", false, false, 0, 0)
+	ob.Insert(1, BID, 99.0, 5)
+	ob.Insert(2, BID, 98.0, 5)
+	check("bids only", true, false, 0, 0)
+	ob.Insert(3, ASK, 102.0, 5)
+	check("two-sided", true, true, 3.0, 100.5)
+	if o, _ := ob.BestBid(); o.OrderId != 1 || ob.BidBook.Len() != 2 {
+		t.Errorf("Expected best bid order 1 with the book unchanged")
+	}
+	ob.Cancel(1)
+	ob.Cancel(2)
+	check("asks only", false, true, 0, 0)
+}
+
+func TestMarketImpact(t *testing.T) {
+	cases := []struct {
+		Name        string
+		Side        Side
+		Quantity    int
+		MaxDistance float32
+		Exhausted   bool
+	}{
+		{"within touch", BID, 5, 0, false},
+		{"across levels", BID, 25, 0, false},
+		{"exact", BID, 35, 0, false},
+		{"exhausted", BID, 50, 0, true},
+		{"capped", BID, 50, 0.015, false},
+		{"sell", ASK, 12, 0, false},
+	}
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			ob := NewOrderBook()
+			ob.SetMaxSweepDistance(c.MaxDistance)
+			ob.Insert(1, ASK, 100.0, 10)
+			ob.InsertOrder(ASK, &Order{OrderId: 2, Price: px(101.0), Quantity: 10, Hidden: true})
+			ob.Insert(3, ASK, 102.0, 15)
+			ob.Insert(4, BID, 99.0, 8)
+			ob.Insert(5, BID, 98.0, 8)
+
+			vwap, filled, exhausted := ob.MarketImpact(c.Side, c.Quantity)
+
+			// The same order actually sent must fill identically
+			price := px(1000.0)
+			if c.Side == ASK {
+				price = px(0.01)
+			}
+			trades, _ := ob.InsertOrder(c.Side, &Order{OrderId: 10, Price: price, Quantity: c.Quantity, TimeInForce: IOC})
+			var notional float64
+			traded := 0
+			for _, trade := range trades {
+				notional += trade.Price.Float() * float64(trade.Volume)
+				traded += trade.Volume
+			}
+			if filled != traded {
+				t.Errorf("Expected %d filled, got %d", traded, filled)
+			}
+			if expected := float32(notional / float64(traded)); fmt.Sprintf("%.4f", vwap) != fmt.Sprintf("%.4f", expected) {
+				t.Errorf("Expected vwap %f, got %f", expected, vwap)
+			}
+			if exhausted != c.Exhausted {
+				t.Errorf("Expected exhausted %v, got %v", c.Exhausted, exhausted)
+			}
+		})
+	}
+
+	ob := NewOrderBook()
+	if vwap, filled, exhausted := ob.MarketImpact(BID, 10); vwap != 0 || filled != 0 || exhausted {
+		t.Errorf("Expected nothing to fill against an empty book, got %f %d %v", vwap, filled, exhausted)
+	}
+}
+
+func TestCounts(t *testing.T) {
+	ob := NewOrderBook()
+	check := func(step string, side Side, orders, levels, volume int) {
+		if ob.OrderCount(side) != orders || ob.LevelCount(side) != levels || ob.TotalVolume(side) != volume {
+			t.Errorf("%s: expected %d orders, %d levels and %d volume on %s, got %d, %d and %d", step, orders, levels, volume, side,
+				ob.OrderCount(side), ob.LevelCount(side), ob.TotalVolume(side))
+		}
+	}
+	check("empty", ASK, 0, 0, 0)
+
+	ob.Insert(1, ASK, 100.0, 10)
+	ob.Insert(2, ASK, 100.0, 5)
+	ob.Insert(3, ASK, 101.0, 20)
+	ob.Insert(4, BID, 99.0, 7)
+	check("insert", ASK, 3, 2, 35)
+	check("insert", BID, 1, 1, 7)
+
+	// Order 1 fills in full and order 2 in part
+	ob.Insert(5, BID, 100.0, 12)
+	check("partial fill", ASK, 2, 2, 23)
+	check("partial fill", BID, 1, 1, 7)
+
+	ob.Cancel(2)
+	check("cancel", ASK, 1, 1, 20)
+	ob.Cancel(4)
+	check("cancel", BID, 0, 0, 0)
+}
+
+func TestIterateLevels(t *testing.T) {
+	ob := NewOrderBook()
+	for i, price := range []float32{99.0, 97.0, 98.5, 96.0, 98.0} {
+		ob.Insert(i+1, BID, price, 1)
+		ob.Insert(i+10, ASK, price+5, 1)
+	}
+
+	cases := []struct {
+		Name     string
+		Side     Side
+		Limit    int
+		Expected []float32
+	}{
+		{"bids", BID, 0, []float32{99.0, 98.5, 98.0, 97.0, 96.0}},
+		{"asks", ASK, 0, []float32{101.0, 102.0, 103.0, 103.5, 104.0}},
+		{"early stop", BID, 2, []float32{99.0, 98.5}},
+	}
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			var prices []float32
+			ob.IterateLevels(c.Side, func(n *Node) bool {
+				prices = append(prices, n.Key.float32())
+				return c.Limit == 0 || len(prices) < c.Limit
+			})
+			if fmt.Sprint(prices) != fmt.Sprint(c.Expected) {
+				t.Errorf("Expected %v, got %v", c.Expected, prices)
+			}
+		})
+	}
+}
+
+func TestIterateOrders(t *testing.T) {
+	for _, side := range []Side{BID, ASK} {
+		ob := NewOrderBook()
+		for i, price := range []float32{99.0, 97.0, 99.0, 98.0, 97.0, 99.0} {
+			ob.Insert(i+1, side, price, 1)
+		}
+
+		var ids []int
+		ob.IterateOrders(side, func(o *Order) bool {
+			ids = append(ids, o.OrderId)
+			return true
+		})
+		var popped []int
+		book := Book(&ob.BidBook)
+		if side == ASK {
+			book = &ob.AskBook
+		}
+		for book.Len() > 0 {
+			popped = append(popped, book.Pop().OrderId)
+		}
+		if fmt.Sprint(ids) != fmt.Sprint(popped) {
+			t.Errorf("Expected %s orders %v, got %v", side, popped, ids)
+		}
+	}
+
+	ob := NewOrderBook()
+	ob.Insert(1, BID, 99.0, 1)
+	ob.Insert(2, BID, 99.0, 1)
+	ob.Insert(3, BID, 98.0, 1)
+	count := 0
+	ob.IterateOrders(BID, func(o *Order) bool {
+		count++
+		return o.OrderId != 2
+	})
+	if count != 2 {
+		t.Errorf("Expected iteration to stop after 2 orders, got %d", count)
+	}
+}
+
+func TestTopOrders(t *testing.T) {
+	ob := NewOrderBook()
+	if orders := ob.TopOrders(BID, 3); len(orders) != 0 {
+		t.Errorf("Expected no orders from an empty book, got %+v", orders)
+	}
+
+	ob.Insert(1, BID, 99.0, 1)
+	ob.InsertOrder(BID, &Order{OrderId: 2, Price: px(100.0), Quantity: 2, Hidden: true})
+	ob.Insert(3, BID, 100.0, 3)
+	ob.Insert(4, BID, 98.0, 4)
+	ob.Insert(5, BID, 99.0, 5)
+
+	ids := func(orders []*Order) []int {
+		var ids []int
+		for _, o := range orders {
+			ids = append(ids, o.OrderId)
+		}
+		return ids
+	}
+	tests := []struct {
+		name     string
+		n        int
+		expected []int
+	}{
+		{"first level", 1, []int{3}},
+		{"hidden behind displayed", 2, []int{3, 2}},
+		{"spanning levels", 4, []int{3, 2, 1, 5}},
+		{"more than the book", 10, []int{3, 2, 1, 5, 4}},
+		{"none", 0, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ids(ob.TopOrders(BID, tt.n))
+			if len(got) != len(tt.expected) {
+				t.Fatalf("Expected %v, got %v", tt.expected, got)
+			}
+			for i := range got {
+				if got[i] != tt.expected[i] {
+					t.Errorf("Expected %v, got %v", tt.expected, got)
+					break
+				}
+			}
+		})
+	}
+
+	// The orders are copies
+	ob.TopOrders(BID, 1)[0].Quantity = 100
+	if v, _ := ob.Inspect(3); v.Quantity != 3 {
+		t.Errorf("Expected the book to be unchanged, got %d", v.Quantity)
+	}
+
+	ob.SetHiddenPriority(TimePriority)
+	if got := ids(ob.TopOrders(BID, 2)); len(got) != 2 || got[0] != 2 || got[1] != 3 {
+		t.Errorf("Expected strict time priority [2 3], got %v", got)
+	}
+}
+
+func TestMicroprice(t *testing.T) {
+	ob := NewOrderBook()
+	if _, ok := ob.Microprice(); ok {
+		t.Errorf("Expected no microprice for an empty book")
+	}
+	ob.Insert(1, BID, 99.0, 30)
+	if _, ok := ob.Microprice(); ok {
+		t.Errorf("Expected no microprice without asks")
+	}
+	ob.Insert(2, ASK, 101.0, 10)
+	ob.Insert(3, ASK, 102.0, 100)
+
+	// Heavy bids push the microprice up towards the ask; deeper levels
+	// are ignored
+	if p, ok := ob.Microprice(); !ok || p != 100.5 {
+		t.Errorf("Expected 100.5, got %v", p)
+	}
+	ob.Insert(4, ASK, 101.0, 80)
+	if p, _ := ob.Microprice(); p != 99.5 {
+		t.Errorf("Expected the heavier ask to pull it down to 99.5, got %v", p)
+	}
+	ob.Insert(5, BID, 99.0, 60)
+	if p, _ := ob.Microprice(); p != 100.0 {
+		t.Errorf("Expected balanced volumes to give the mid 100, got %v", p)
+	}
+}
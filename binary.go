@@ -0,0 +1,112 @@
+package orderbook
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// The binary snapshot format is a fixed header followed by one fixed-width
+// record per resting order, all little endian. Records run bids then asks,
+// levels from best to worst, and orders in queue order within each level.
+//
+//	header: magic [4]byte, sequence uint64, lastApplied uint64,
+//	        lastAutoId int64, orders uint64
+//	record: orderId int64, side uint8, price float64, quantity int64,
+//	        filled int64, displayQuantity int64, shown int64, ownerId int64,
+//	        timestamp int64, timeInForce uint8, hidden uint8
+const (
+	binaryHeaderSize = 4 + 8 + 8 + 8 + 8
+	binaryRecordSize = 8 + 1 + 8 + 8 + 8 + 8 + 8 + 8 + 8 + 1 + 1
+)
+
+var binaryMagic = [4]byte{'O', 'B', 'K', 1}
+
+// MarshalBinary encodes every resting order and the book's sequence numbers
+// in a compact binary form, capturing the same state as Snapshot. The output
+// is deterministic for a given book.
+func (ob *OrderBook) MarshalBinary() ([]byte, error) {
+	count := len(ob.AskBook.OrdersMap) + len(ob.BidBook.OrdersMap)
+	buf := make([]byte, binaryHeaderSize+count*binaryRecordSize)
+	copy(buf, binaryMagic[:])
+	binary.LittleEndian.PutUint64(buf[4:], ob.sequence)
+	binary.LittleEndian.PutUint64(buf[12:], ob.lastApplied)
+	binary.LittleEndian.PutUint64(buf[20:], uint64(ob.lastAutoId))
+	binary.LittleEndian.PutUint64(buf[28:], uint64(count))
+
+	b := buf[binaryHeaderSize:]
+	for _, side := range []Side{BID, ASK} {
+		for _, n := range ob.sortedLevels(side) {
+			for e := n.Level.Front(); e != nil; e = e.Next() {
+				o := e.Order()
+				binary.LittleEndian.PutUint64(b[0:], uint64(o.OrderId))
+				b[8] = uint8(side)
+				binary.LittleEndian.PutUint64(b[9:], math.Float64bits(n.Key.Float()))
+				binary.LittleEndian.PutUint64(b[17:], uint64(o.Quantity))
+				binary.LittleEndian.PutUint64(b[25:], uint64(o.Filled))
+				binary.LittleEndian.PutUint64(b[33:], uint64(o.DisplayQuantity))
+				binary.LittleEndian.PutUint64(b[41:], uint64(o.shown))
+				binary.LittleEndian.PutUint64(b[49:], uint64(o.OwnerId))
+				if !o.Timestamp.IsZero() {
+					binary.LittleEndian.PutUint64(b[57:], uint64(o.Timestamp.UnixNano()))
+				}
+				b[65] = uint8(o.TimeInForce)
+				if o.Hidden {
+					b[66] = 1
+				}
+				b = b[binaryRecordSize:]
+			}
+		}
+	}
+	return buf, nil
+}
+
+// UnmarshalBinary replaces the resting orders and sequence numbers of the
+// book with those encoded by MarshalBinary, exactly as Restore does. An
+// error is returned, and the book is left unchanged, if data is malformed.
+func (ob *OrderBook) UnmarshalBinary(data []byte) error {
+	if len(data) < binaryHeaderSize || [4]byte{data[0], data[1], data[2], data[3]} != binaryMagic {
+		return errors.New("Not a binary order book snapshot")
+	}
+	count := binary.LittleEndian.Uint64(data[28:])
+	if records := len(data) - binaryHeaderSize; records%binaryRecordSize != 0 || uint64(records/binaryRecordSize) != count {
+		return fmt.Errorf("Binary snapshot has %d bytes of records, expected %d orders", records, count)
+	}
+	s := bookSnapshot{
+		Sequence:    binary.LittleEndian.Uint64(data[4:]),
+		LastApplied: binary.LittleEndian.Uint64(data[12:]),
+		LastAutoId:  int(int64(binary.LittleEndian.Uint64(data[20:]))),
+	}
+
+	var last *snapshotLevel
+	var lastSide Side
+	for b := data[binaryHeaderSize:]; len(b) > 0; b = b[binaryRecordSize:] {
+		side := Side(b[8])
+		if side != BID && side != ASK {
+			return fmt.Errorf("Binary snapshot has invalid side %d", b[8])
+		}
+		price := math.Float64frombits(binary.LittleEndian.Uint64(b[9:]))
+		// Consecutive records at the same price form one level
+		if last == nil || side != lastSide || price != last.Price {
+			levels := &s.Bids
+			if side == ASK {
+				levels = &s.Asks
+			}
+			*levels = append(*levels, snapshotLevel{Price: price})
+			last, lastSide = &(*levels)[len(*levels)-1], side
+		}
+		last.Orders = append(last.Orders, snapshotOrder{
+			OrderId:         int(int64(binary.LittleEndian.Uint64(b[0:]))),
+			Quantity:        int(int64(binary.LittleEndian.Uint64(b[17:]))),
+			Filled:          int(int64(binary.LittleEndian.Uint64(b[25:]))),
+			DisplayQuantity: int(int64(binary.LittleEndian.Uint64(b[33:]))),
+			Shown:           int(int64(binary.LittleEndian.Uint64(b[41:]))),
+			OwnerId:         int(int64(binary.LittleEndian.Uint64(b[49:]))),
+			Timestamp:       int64(binary.LittleEndian.Uint64(b[57:])),
+			TimeInForce:     TimeInForce(b[65]),
+			Hidden:          b[66] != 0,
+		})
+	}
+	return ob.restore(s)
+}
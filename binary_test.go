@@ -0,0 +1,122 @@
+// Copyright 2024 Lane A. Shetron
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package orderbook
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestBinaryRoundTrip(t *testing.T) {
+	clock := time.Unix(1700000000, 0)
+	ob := NewOrderBook()
+	ob.SetClock(func() time.Time { return clock })
+	ob.Insert(1, BID, 99.0, 10)
+	ob.Insert(2, BID, 99.0, 20)
+	ob.InsertOrder(BID, &Order{OrderId: 3, Price: px(98.5), Quantity: 7, Hidden: true, OwnerId: 3})
+	ob.InsertOrder(ASK, &Order{OrderId: 4, Price: px(100.5), Quantity: 40, DisplayQuantity: 10})
+	ob.Insert(5, ASK, 101.0, 8)
+	ob.Insert(6, BID, 100.5, 4)
+	ob.InsertAuto(ASK, 102.0, 1)
+
+	data, err := ob.MarshalBinary()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(data) != binaryHeaderSize+6*binaryRecordSize {
+		t.Errorf("Expected %d bytes, got %d", binaryHeaderSize+6*binaryRecordSize, len(data))
+	}
+	again, _ := ob.MarshalBinary()
+	if !bytes.Equal(data, again) {
+		t.Errorf("Expected identical output for the same book")
+	}
+
+	restored := NewOrderBook()
+	if err := restored.UnmarshalBinary(data); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if diffs := DiffSnapshots(ob.State(), restored.State()); diffs != nil {
+		t.Errorf("Expected identical state, got %v", diffs)
+	}
+	if v, _ := restored.Inspect(3); !v.Hidden || v.OwnerId != 3 {
+		t.Errorf("Expected order attributes to be restored, got %+v", v)
+	}
+	// The restored book encodes to exactly the same bytes
+	if out, _ := restored.MarshalBinary(); !bytes.Equal(data, out) {
+		t.Errorf("Expected the restored book to encode identically")
+	}
+	json, _ := ob.Snapshot()
+	if rJson, _ := restored.Snapshot(); !bytes.Equal(json, rJson) {
+		t.Errorf("Expected the binary and JSON forms to capture the same state")
+	}
+}
+
+func TestUnmarshalBinaryInvalid(t *testing.T) {
+	ob := NewOrderBook()
+	ob.Insert(1, BID, 99.0, 10)
+	data, _ := ob.MarshalBinary()
+	cases := []struct {
+		Name string
+		Data []byte
+	}{
+		{"empty", nil},
+		{"bad magic", append([]byte("JSON"), data[4:]...)},
+		{"truncated", data[:len(data)-1]},
+	}
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			ob := NewOrderBook()
+			ob.Insert(2, ASK, 101.0, 5)
+			if err := ob.UnmarshalBinary(c.Data); err == nil {
+				t.Errorf("Expected an error")
+			}
+			if _, ok := ob.Inspect(2); !ok {
+				t.Errorf("Expected the book to be unchanged")
+			}
+		})
+	}
+}
+
+func benchmarkBook(orders int) *OrderBook {
+	r := rand.New(rand.NewSource(1))
+	ob := NewOrderBook()
+	for i := 0; i < orders; i++ {
+		if i%2 == 0 {
+			ob.Insert(i, BID, float32(900+r.Intn(100)), 1+r.Intn(100))
+		} else {
+			ob.Insert(i, ASK, float32(1000+r.Intn(100)), 1+r.Intn(100))
+		}
+	}
+	return ob
+}
+
+func BenchmarkRoundTripBinary(b *testing.B) {
+	ob := benchmarkBook(100000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		data, _ := ob.MarshalBinary()
+		NewOrderBook().UnmarshalBinary(data)
+	}
+}
+
+func BenchmarkRoundTripJSON(b *testing.B) {
+	ob := benchmarkBook(100000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		data, _ := ob.Snapshot()
+		NewOrderBook().Restore(data)
+	}
+}
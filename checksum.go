@@ -0,0 +1,32 @@
+package orderbook
+
+import (
+	"hash/crc32"
+	"strconv"
+	"strings"
+)
+
+// Checksum returns a CRC32 (IEEE) checksum of the top depth levels on each
+// side, as published by venues such as OKX so that clients can verify their
+// local copy of the book. The levels are those reported by DepthSnapshot,
+// written as price:volume pairs and interleaved best first, bid then ask, all
+// joined by colons; once one side runs out, the remaining levels of the
+// other side follow on their own. Prices are written in their shortest
+// decimal form, e.g. 99.5 and 100.
+func (ob *OrderBook) Checksum(depth int) uint32 {
+	bids, asks := ob.DepthSnapshot(depth)
+	var parts []string
+	for i := 0; i < len(bids) || i < len(asks); i++ {
+		if i < len(bids) {
+			parts = append(parts, checksumLevel(bids[i]))
+		}
+		if i < len(asks) {
+			parts = append(parts, checksumLevel(asks[i]))
+		}
+	}
+	return crc32.ChecksumIEEE([]byte(strings.Join(parts, ":")))
+}
+
+func checksumLevel(l Level) string {
+	return strconv.FormatFloat(float64(l.Price), 'f', -1, 32) + ":" + strconv.Itoa(l.Volume)
+}
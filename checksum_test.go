@@ -0,0 +1,58 @@
+// Copyright 2024 Lane A. Shetron
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package orderbook
+
+import (
+	"testing"
+)
+
+func TestChecksum(t *testing.T) {
+	ob := NewOrderBook()
+	ob.Insert(1, BID, 99.5, 10)
+	ob.Insert(2, BID, 99.0, 5)
+	ob.Insert(3, ASK, 100.0, 3)
+	ob.Insert(4, ASK, 100.5, 7)
+	ob.Insert(5, ASK, 101.0, 2)
+
+	// Precomputed CRC32s of the interleaved strings
+	tests := []struct {
+		name     string
+		depth    int
+		expected uint32
+	}{
+		// 99.5:10:100:3
+		{"top of book", 1, 1907026723},
+		// 99.5:10:100:3:99:5:100.5:7:101:2, the asks outlasting the bids
+		{"uneven sides", 3, 2410741190},
+		{"beyond the book", 10, 2410741190},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if c := ob.Checksum(tt.depth); c != tt.expected {
+				t.Errorf("Expected checksum %d, got %d", tt.expected, c)
+			}
+		})
+	}
+
+	// A change to any one order changes the checksum
+	before := ob.Checksum(3)
+	ob.Update(2, 99.0, 4)
+	if ob.Checksum(3) == before {
+		t.Errorf("Expected the checksum to change with the book")
+	}
+	ob.Update(2, 99.0, 5)
+	if ob.Checksum(3) != before {
+		t.Errorf("Expected the checksum to be restored with the book")
+	}
+}
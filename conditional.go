@@ -0,0 +1,107 @@
+package orderbook
+
+import "errors"
+
+// TriggerKind selects the book measure a Trigger watches.
+type TriggerKind uint8
+
+const (
+	// TriggerMid watches the mid price.
+	TriggerMid TriggerKind = iota
+	// TriggerSpread watches the spread between the best bid and ask.
+	TriggerSpread
+)
+
+// Trigger is the condition that activates a conditional order: the watched
+// measure reaching Threshold, at or above it if Above is set and at or below
+// it otherwise. A trigger is never met while either side of the book is
+// empty.
+type Trigger struct {
+	Kind      TriggerKind
+	Threshold float32
+	Above     bool
+}
+
+// conditional is an order held outside the book until its trigger is met.
+type conditional struct {
+	side    Side
+	order   *Order
+	trigger Trigger
+}
+
+// met reports whether the trigger's condition currently holds.
+func (ob *OrderBook) met(t Trigger) bool {
+	bid, ask := ob.BidBook.Peek(), ob.AskBook.Peek()
+	if bid == nil || ask == nil {
+		return false
+	}
+	// The mid is compared at twice its value, so that it is exact
+	v, threshold := bid.Price+ask.Price, 2*float32Price(t.Threshold)
+	if t.Kind == TriggerSpread {
+		v, threshold = ask.Price-bid.Price, float32Price(t.Threshold)
+	}
+	if t.Above {
+		return v >= threshold
+	}
+	return v <= threshold
+}
+
+// InsertConditional holds an order outside the book until its trigger is
+// met. Triggers are evaluated at the end of every operation that changes the
+// book, and immediately on submission; once met, the order is inserted as
+// with InsertOrder, and any trades are reported through the book's updates.
+// A RejectError is returned at once if the order's quantity or price is
+// invalid, or if its id is already used by a resting or pending order. If
+// InsertOrder rejects it when the trigger is met, for example because
+// another order has since taken its id, the order is dropped.
+func (ob *OrderBook) InsertConditional(side Side, o *Order, trigger Trigger) error {
+	if err := ob.validate(o.OrderId, o.Quantity, o.Price); err != nil {
+		return err
+	}
+	if ob.inUse(o.OrderId) {
+		return &RejectError{o.OrderId, RejectDuplicateOrderId}
+	}
+	ob.conditionals = append(ob.conditionals, conditional{side, o, trigger})
+	ob.checkTriggers()
+	return nil
+}
+
+// CancelConditional removes a conditional order that has not yet been
+// triggered. An error is returned if no such order is pending.
+func (ob *OrderBook) CancelConditional(orderId int) error {
+	for i, c := range ob.conditionals {
+		if c.order.OrderId == orderId {
+			ob.conditionals = append(ob.conditionals[:i], ob.conditionals[i+1:]...)
+			return nil
+		}
+	}
+	return errors.New("Conditional order does not exist")
+}
+
+// PendingConditionals returns the number of conditional orders waiting for
+// their triggers.
+func (ob *OrderBook) PendingConditionals() int {
+	return len(ob.conditionals)
+}
+
+// checkTriggers inserts every conditional order whose trigger is met, in the
+// order they were submitted. Inserting one can change the book and so meet
+// further triggers, which are checked in turn by the same pass.
+func (ob *OrderBook) checkTriggers() {
+	if ob.triggering {
+		return
+	}
+	ob.triggering = true
+	defer func() { ob.triggering = false }()
+	for i := 0; i < len(ob.conditionals); {
+		c := ob.conditionals[i]
+		if !ob.met(c.trigger) {
+			i++
+			continue
+		}
+		ob.conditionals = append(ob.conditionals[:i], ob.conditionals[i+1:]...)
+		ob.InsertOrder(c.side, c.order)
+		// Earlier orders may now be triggered too
+		i = 0
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright 2024 Lane A. Shetron
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package orderbook
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestConditionalOnMid(t *testing.T) {
+	ob := NewOrderBook()
+	ob.Insert(1, BID, 99.0, 10)
+	ob.Insert(2, ASK, 101.0, 10)
+	ob.Insert(3, ASK, 104.0, 10)
+
+	// Buy once the mid reaches 101
+	err := ob.InsertConditional(BID, NewOrder(10, px(104.0), 5), Trigger{Kind: TriggerMid, Threshold: 101.0, Above: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ob.Insert(4, BID, 100.0, 1) // mid 100.5
+	if ob.PendingConditionals() != 1 {
+		t.Fatalf("Expected the order to wait for its trigger")
+	}
+
+	var trades []Trade
+	ob.OnIncrementalUpdate(func(u IncrementalUpdate) {
+		trades = append(trades, u.Trades...)
+	})
+	// Lifting the 101 ask moves the mid to 102, triggering the order
+	ob.Insert(5, BID, 101.0, 10)
+	if ob.PendingConditionals() != 0 {
+		t.Fatalf("Expected the order to be triggered")
+	}
+	if len(trades) != 2 || trades[1].TakerOrderId != 10 || trades[1].Price != px(104.0) || trades[1].Volume != 5 {
+		t.Errorf("Expected the triggered order to buy 5 @ 104, got %+v", trades)
+	}
+}
+
+func TestConditionalOnSpread(t *testing.T) {
+	ob := NewOrderBook()
+	ob.Insert(1, BID, 99.0, 10)
+	ob.Insert(2, BID, 97.0, 10)
+	ob.Insert(3, ASK, 100.0, 10)
+
+	// Quote inside the spread once it widens to 2 or more
+	ob.InsertConditional(BID, NewOrder(10, px(98.5), 3), Trigger{Kind: TriggerSpread, Threshold: 2.0, Above: true})
+	ob.InsertConditional(ASK, NewOrder(11, px(99.5), 3), Trigger{Kind: TriggerSpread, Threshold: 2.0, Above: true})
+	ob.InsertConditional(ASK, NewOrder(12, px(99.0), 3), Trigger{Kind: TriggerSpread, Threshold: 0.5})
+	ob.CancelConditional(12)
+	if err := ob.CancelConditional(12); err == nil {
+		t.Errorf("Expected an error cancelling a removed conditional order")
+	}
+
+	// The spread widens to 3, triggering the bid, which narrows it to 1.5
+	// before the ask is evaluated
+	ob.Cancel(1)
+	if ob.PendingConditionals() != 1 {
+		t.Fatalf("Expected only the bid to be triggered, %d pending", ob.PendingConditionals())
+	}
+	if ob.BidBook.Peek().OrderId != 10 || ob.AskBook.Peek().OrderId != 3 {
+		t.Errorf("Expected the triggered bid to be the new best bid")
+	}
+
+	ob.Cancel(10) // spread 3 again
+	if ob.PendingConditionals() != 0 || ob.AskBook.Peek().OrderId != 11 {
+		t.Errorf("Expected the ask to be triggered")
+	}
+}
+
+func TestConditionalOrderIds(t *testing.T) {
+	ob := NewOrderBook()
+	ob.Insert(1, BID, 99.0, 5)
+	ob.InsertStop(2, BID, 105.0, 105.0, 5)
+	ob.InsertConditional(BID, NewOrder(3, px(90.0), 5), Trigger{Kind: TriggerSpread, Threshold: 50.0, Above: true})
+	for _, id := range []int{1, 2, 3} {
+		err := ob.InsertConditional(ASK, NewOrder(id, px(110.0), 1), Trigger{Kind: TriggerMid, Threshold: 200.0, Above: true})
+		var reject *RejectError
+		if !errors.As(err, &reject) || reject.Reason != RejectDuplicateOrderId {
+			t.Errorf("Expected a conditional with id %d to be rejected as a duplicate, got %v", id, err)
+		}
+	}
+	if ob.PendingConditionals() != 1 {
+		t.Errorf("Expected 1 pending conditional, got %d", ob.PendingConditionals())
+	}
+}
@@ -0,0 +1,185 @@
+package orderbook
+
+import "math"
+
+// SetDisplayPrecision rounds the prices reported by Depth and DepthSnapshot
+// to the given number of decimal places. It only affects those outputs;
+// level keys, matching and State keep full precision, so VolumeAtPrice and
+// the other queries still take exact prices. A negative value (the default) disables rounding.
+func (ob *OrderBook) SetDisplayPrecision(decimals int) {
+	if decimals < 0 {
+		ob.displayScale = 0
+		return
+	}
+	ob.displayScale = math.Pow10(decimals)
+}
+
+// displayPrice rounds a price to the display precision.
+func (ob *OrderBook) displayPrice(price Price) float32 {
+	if ob.displayScale == 0 {
+		return price.float32()
+	}
+	return float32(math.Round(price.Float()*ob.displayScale) / ob.displayScale)
+}
+
+// Level is an aggregated price level.
+type Level struct {
+	Price      float32
+	Volume     int
+	OrderCount int
+}
+
+// depth aggregates up to n levels on side, best first, at the display
+// precision, merging levels that round to the same display price. Only
+// displayed volume and the orders showing it are counted, and levels with
+// nothing displayed are left out.
+func (ob *OrderBook) depth(side Side, n int) []Level {
+	var depth []Level
+	for _, l := range ob.sortedLevels(side) {
+		volume, orders := l.displayed()
+		if volume == 0 {
+			continue
+		}
+		price := ob.displayPrice(l.Key)
+		if len(depth) > 0 && depth[len(depth)-1].Price == price {
+			depth[len(depth)-1].Volume += volume
+			depth[len(depth)-1].OrderCount += orders
+			continue
+		}
+		if len(depth) == n {
+			break
+		}
+		depth = append(depth, Level{price, volume, orders})
+	}
+	return depth
+}
+
+// Depth returns up to n aggregated price levels on side, best first, with
+// prices at the display precision. Levels that round to the same display
+// price are reported as one. As on a public feed, hidden orders and iceberg
+// reserves are excluded.
+func (ob *OrderBook) Depth(side Side, n int) []LevelUpdate {
+	levels := ob.depth(side, n)
+	depth := make([]LevelUpdate, len(levels))
+	for i, l := range levels {
+		depth[i] = LevelUpdate{l.Price, l.Volume}
+	}
+	return depth
+}
+
+// DepthSnapshot returns an aggregated level 2 view of the top levels price
+// levels on each side: bids from highest to lowest and asks from lowest to
+// highest, each with its total volume and number of orders. Prices are at the
+// display precision as with Depth.
+func (ob *OrderBook) DepthSnapshot(levels int) ([]Level, []Level) {
+	return ob.depth(BID, levels), ob.depth(ASK, levels)
+}
+
+// VolumeAtPrice returns the volume resting at exactly price on side, or zero
+// if there is no such level. With a tick size, price is first snapped to the
+// nearest tick.
+func (ob *OrderBook) VolumeAtPrice(side Side, price float32) int {
+	if n, ok := ob.levels(side)[ob.price(price)]; ok {
+		return n.Volume()
+	}
+	return 0
+}
+
+// VolumeWithin returns the total volume resting on side at or better than
+// price: at or above it for bids, at or below it for asks. It visits every
+// level once without sorting.
+func (ob *OrderBook) VolumeWithin(side Side, price float32) int {
+	total := 0
+	limit := float32Price(price)
+	for key, n := range ob.levels(side) {
+		if (side == BID && key >= limit) || (side == ASK && key <= limit) {
+			total += n.Volume()
+		}
+	}
+	return total
+}
+
+// VolumeAtOrBetween returns the total volume resting on side at prices from
+// low to high inclusive, or zero if low is above high.
+func (ob *OrderBook) VolumeAtOrBetween(side Side, low, high float32) int {
+	total := 0
+	lo, hi := float32Price(low), float32Price(high)
+	for key, n := range ob.levels(side) {
+		if key >= lo && key <= hi {
+			total += n.Volume()
+		}
+	}
+	return total
+}
+
+// maxTopN is the largest depth TopNInto serves without allocating.
+const maxTopN = 64
+
+// TopNInto fills prices and vols with the price and volume of the best n
+// levels on side, best first, and returns how many levels it filled, which
+// is limited by the length of either buffer and the depth of the book.
+// Prices are not rounded to the display precision, and as with Depth only
+// displayed volume is counted, skipping levels with none. Reusing the
+// buffers, it does not allocate for n up to 64 unless many levels display
+// nothing, so it suits a depth display refreshed on every tick.
+//
+// Unlike Depth, which sorts every level, it walks only the top of the level
+// heap, which is O(n^2) for n levels.
+func (ob *OrderBook) TopNInto(side Side, n int, prices []float32, vols []int) int {
+	n = min(n, min(len(prices), len(vols)))
+	if n <= 0 {
+		return 0
+	}
+	if n > maxTopN {
+		count := 0
+		for _, l := range ob.sortedLevels(side) {
+			if count == n {
+				break
+			}
+			if vol, _ := l.displayed(); vol > 0 {
+				prices[count], vols[count] = l.Key.float32(), vol
+				count++
+			}
+		}
+		return count
+	}
+
+	var levels BaseHeap
+	var less func(i, j int) bool
+	if side == ASK {
+		levels, less = ob.AskBook.Orders.BaseHeap, ob.AskBook.Orders.Less
+	} else {
+		levels, less = ob.BidBook.Orders.BaseHeap, ob.BidBook.Orders.Less
+	}
+
+	// The next best level is always a child of one already taken, so only
+	// those children need to be compared. Skipping levels with nothing
+	// displayed can grow the frontier past n+1, beyond the stack buffer
+	var buf [maxTopN + 1]int
+	frontier, count := buf[:0], 0
+	if len(levels) > 0 {
+		frontier = append(frontier, 0)
+	}
+	for count < n && len(frontier) > 0 {
+		best := 0
+		for i := 1; i < len(frontier); i++ {
+			if less(frontier[i], frontier[best]) {
+				best = i
+			}
+		}
+		i := frontier[best]
+		frontier[best] = frontier[len(frontier)-1]
+		frontier = frontier[:len(frontier)-1]
+
+		if vol, _ := levels[i].displayed(); vol > 0 {
+			prices[count], vols[count] = levels[i].Key.float32(), vol
+			count++
+		}
+		for _, child := range [2]int{2*i + 1, 2*i + 2} {
+			if child < len(levels) {
+				frontier = append(frontier, child)
+			}
+		}
+	}
+	return count
+}
@@ -0,0 +1,259 @@
+// Copyright 2024 Lane A. Shetron
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package orderbook
+
+import (
+	"fmt"
+	"hash/crc32"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestDisplayPrecision(t *testing.T) {
+	ob := NewOrderBook()
+	ob.Insert(1, BID, 99.996, 5)
+	ob.Insert(2, BID, 99.994, 3)
+	ob.Insert(3, BID, 99.5, 7)
+	ob.Insert(4, BID, 98.0, 1)
+	ob.SetDisplayPrecision(2)
+
+	expected := []LevelUpdate{{100.0, 5}, {99.99, 3}, {99.5, 7}}
+	depth := ob.Depth(BID, 3)
+	if len(depth) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, depth)
+	}
+	for i := range expected {
+		if depth[i] != expected[i] {
+			t.Errorf("Expected level %v, got %v", expected[i], depth[i])
+		}
+	}
+	// State keeps levels that round to the same price apart
+	if bids := ob.State().Bids; bids[0].Price != px(99.996) || bids[1].Price != px(99.994) {
+		t.Errorf("Expected exact state prices, got %v and %v", bids[0].Price, bids[1].Price)
+	}
+
+	// Matching and lookups keep full precision
+	if v := ob.VolumeAtPrice(BID, 99.996); v != 5 {
+		t.Errorf("Expected 5 at 99.996, got %d", v)
+	}
+	if v := ob.VolumeAtPrice(BID, 100.0); v != 0 {
+		t.Errorf("Expected no level at the display price, got %d", v)
+	}
+	if trades, _ := ob.Insert(5, ASK, 99.995, 10); len(trades) != 1 || trades[0].Price != px(99.996) {
+		t.Errorf("Expected a single trade at 99.996, got %+v", trades)
+	}
+
+	// Levels rounding to the same display price are aggregated
+	ob.SetDisplayPrecision(0)
+	if depth := ob.Depth(BID, 1); len(depth) != 1 || depth[0] != (LevelUpdate{100.0, 10}) {
+		t.Errorf("Expected 10 @ 100, got %v", depth)
+	}
+	if bids := ob.State().Bids; len(bids) != 3 || bids[0].Price == bids[1].Price {
+		t.Errorf("Expected state to keep every level distinct, got %+v", bids)
+	}
+	ob.SetDisplayPrecision(-1)
+	if depth := ob.Depth(BID, 1); depth[0].Price != 99.994 {
+		t.Errorf("Expected unrounded prices, got %v", depth)
+	}
+}
+
+func TestTopNInto(t *testing.T) {
+	ob := NewOrderBook()
+	for i := 0; i < 200; i++ {
+		price := float32(rand.Intn(500))
+		ob.Insert(i, BID, price, 1+i%7)
+		ob.Insert(1000+i, ASK, 1000.0+price, 1+i%5)
+	}
+
+	for _, side := range []Side{BID, ASK} {
+		for _, n := range []int{1, 5, 20, 100, 1000} {
+			t.Run(fmt.Sprintf("%s-%d", side, n), func(t *testing.T) {
+				prices, vols := make([]float32, n), make([]int, n)
+				count := ob.TopNInto(side, n, prices, vols)
+				expected := ob.sortedLevels(side)
+				if len(expected) > n {
+					expected = expected[:n]
+				}
+				if count != len(expected) {
+					t.Fatalf("Expected %d levels, got %d", len(expected), count)
+				}
+				for i, l := range expected {
+					if prices[i] != l.Key.float32() || vols[i] != l.Volume() {
+						t.Errorf("Expected level %d to be %d @ %v, got %d @ %v", i, l.Volume(), l.Key, vols[i], prices[i])
+					}
+				}
+			})
+		}
+	}
+
+	prices, vols := make([]float32, 10), make([]int, 5)
+	if count := ob.TopNInto(BID, 10, prices, vols); count != 5 {
+		t.Errorf("Expected the count to be limited by the buffers, got %d", count)
+	}
+	if allocs := testing.AllocsPerRun(100, func() { ob.TopNInto(ASK, 10, prices, vols) }); allocs != 0 {
+		t.Errorf("Expected no allocations, got %v", allocs)
+	}
+}
+
+func BenchmarkTopNInto(b *testing.B) {
+	ob := NewOrderBook()
+	for i := 0; i < 10000; i++ {
+		ob.Insert(i, BID, float32(rand.Intn(5000)), 1)
+	}
+	prices, vols := make([]float32, 10), make([]int, 10)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		ob.TopNInto(BID, 10, prices, vols)
+	}
+}
+
+func TestDepthSnapshot(t *testing.T) {
+	ob := NewOrderBook()
+	orders := []struct {
+		Side   Side
+		Price  float32
+		Volume int
+	}{
+		{BID, 98.0, 3}, {BID, 99.0, 1}, {BID, 97.0, 2}, {BID, 99.0, 4}, {BID, 98.0, 5}, {BID, 99.0, 2},
+		{ASK, 102.0, 6}, {ASK, 101.0, 1}, {ASK, 103.0, 2}, {ASK, 101.0, 1},
+	}
+	for i, o := range orders {
+		ob.Insert(i+1, o.Side, o.Price, o.Volume)
+	}
+
+	bids, asks := ob.DepthSnapshot(2)
+	expectedBids := []Level{{99.0, 7, 3}, {98.0, 8, 2}}
+	expectedAsks := []Level{{101.0, 2, 2}, {102.0, 6, 1}}
+	for _, c := range []struct {
+		Name     string
+		Got      []Level
+		Expected []Level
+	}{{"bids", bids, expectedBids}, {"asks", asks, expectedAsks}} {
+		t.Run(c.Name, func(t *testing.T) {
+			if len(c.Got) != len(c.Expected) {
+				t.Fatalf("Expected %v, got %v", c.Expected, c.Got)
+			}
+			for i := range c.Expected {
+				if c.Got[i] != c.Expected[i] {
+					t.Errorf("Expected level %+v, got %+v", c.Expected[i], c.Got[i])
+				}
+			}
+		})
+	}
+
+	if bids, asks := ob.DepthSnapshot(10); len(bids) != 3 || len(asks) != 3 {
+		t.Errorf("Expected every level when fewer than requested, got %d and %d", len(bids), len(asks))
+	}
+}
+
+func TestDepthDisplayedOnly(t *testing.T) {
+	ob := NewOrderBook()
+	var updates []IncrementalUpdate
+	ob.OnIncrementalUpdate(func(u IncrementalUpdate) { updates = append(updates, u) })
+	// An iceberg showing 10 of 100, and a hidden order alone at 101
+	ob.InsertOrder(ASK, &Order{Price: px(100.0), Quantity: 100, OrderId: 1, DisplayQuantity: 10})
+	ob.Insert(2, ASK, 100.0, 5)
+	ob.InsertOrder(ASK, &Order{Price: px(101.0), Quantity: 50, OrderId: 3, Hidden: true})
+	ob.Insert(4, ASK, 102.0, 7)
+
+	_, asks := ob.DepthSnapshot(5)
+	expected := []Level{{100.0, 15, 2}, {102.0, 7, 1}}
+	if !reflect.DeepEqual(asks, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, asks)
+	}
+	if depth := ob.Depth(ASK, 1); len(depth) != 1 || depth[0] != (LevelUpdate{100.0, 15}) {
+		t.Errorf("Expected only the displayed 15 at 100, got %+v", depth)
+	}
+	prices, vols := make([]float32, 5), make([]int, 5)
+	if n := ob.TopNInto(ASK, 5, prices, vols); n != 2 || prices[1] != 102.0 || vols[0] != 15 || vols[1] != 7 {
+		t.Errorf("Expected 15 at 100 and 7 at 102, got %v and %v", prices[:n], vols[:n])
+	}
+	if ob.Checksum(5) != crc32.ChecksumIEEE([]byte("100:15:102:7")) {
+		t.Errorf("Expected the checksum to cover displayed volume only")
+	}
+	for _, u := range updates {
+		for _, l := range u.Asks {
+			if (l.Price == 100.0 && l.Volume > 15) || (l.Price == 101.0 && l.Volume != 0) {
+				t.Errorf("Expected no undisplayed volume in updates, got %+v", l)
+			}
+		}
+	}
+
+	// A repriced iceberg shows a full slice at its new price
+	ob.Insert(5, BID, 100.0, 3)
+	ob.Update(1, 103.0, 97)
+	if n, _ := ob.AskBook.GetLevel(px(103.0)); n.VolumeIncluding(false) != 10 {
+		t.Errorf("Expected a fresh slice of 10 after a reprice, got %d", n.VolumeIncluding(false))
+	}
+}
+
+func TestVolumeWithin(t *testing.T) {
+	ob := NewOrderBook()
+	if ob.VolumeWithin(BID, 100.0) != 0 || ob.VolumeAtOrBetween(ASK, 0, 1000) != 0 {
+		t.Errorf("Expected no volume in an empty book")
+	}
+	ob.Insert(1, BID, 99.0, 10)
+	ob.Insert(2, BID, 99.0, 5)
+	ob.Insert(3, BID, 98.0, 20)
+	ob.Insert(4, BID, 97.0, 40)
+	ob.Insert(5, ASK, 101.0, 1)
+	ob.Insert(6, ASK, 102.0, 2)
+	ob.Insert(7, ASK, 104.0, 4)
+
+	cases := []struct {
+		Name     string
+		Side     Side
+		Price    float32
+		Expected int
+	}{
+		{"bid at touch", BID, 99.0, 15},
+		{"bid between levels", BID, 98.5, 15},
+		{"bid inclusive", BID, 98.0, 35},
+		{"bid wide", BID, 90.0, 75},
+		{"bid above touch", BID, 99.5, 0},
+		{"ask inclusive", ASK, 102.0, 3},
+		{"ask wide", ASK, 200.0, 7},
+		{"ask below touch", ASK, 100.0, 0},
+	}
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			if v := ob.VolumeWithin(c.Side, c.Price); v != c.Expected {
+				t.Errorf("Expected %d, got %d", c.Expected, v)
+			}
+		})
+	}
+
+	bands := []struct {
+		Name      string
+		Side      Side
+		Low, High float32
+		Expected  int
+	}{
+		{"single level", BID, 98.0, 98.0, 20},
+		{"tight band", BID, 97.5, 98.5, 20},
+		{"both bounds inclusive", BID, 97.0, 99.0, 75},
+		{"wide band", ASK, 0, 1000, 7},
+		{"no level inside", ASK, 102.5, 103.5, 0},
+		{"inverted", ASK, 104.0, 101.0, 0},
+	}
+	for _, c := range bands {
+		t.Run(c.Name, func(t *testing.T) {
+			if v := ob.VolumeAtOrBetween(c.Side, c.Low, c.High); v != c.Expected {
+				t.Errorf("Expected %d, got %d", c.Expected, v)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package orderbook
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+// OverflowPolicy selects what a Dispatcher does when its buffer is full.
+type OverflowPolicy uint8
+
+const (
+	// Block waits for the subscriber to make room, so nothing is lost but
+	// the book is held up by a slow subscriber.
+	Block OverflowPolicy = iota
+	// DropOldest discards the oldest buffered update to make room.
+	DropOldest
+	// DropNewest discards the incoming update.
+	DropNewest
+)
+
+// Dispatcher decouples the book from slow subscribers by delivering
+// IncrementalUpdates on a separate goroutine through a bounded buffer. The
+// book only enqueues:
+//
+//	d, err := NewDispatcher(1024, DropOldest, fn)
+//	ob.OnIncrementalUpdate(d.Enqueue)
+//
+// The subscriber is passed batches of every update buffered since its last
+// call, in sequence order. The batch slice is reused for the next call, so
+// it is only valid until fn returns; a subscriber that keeps updates must
+// copy them out. The updates themselves are the subscriber's own: their
+// Trades are copied on Enqueue, so they are not shared with the trades
+// returned to the book's caller.
+type Dispatcher struct {
+	ch      chan IncrementalUpdate
+	policy  OverflowPolicy
+	fn      func([]IncrementalUpdate)
+	done    chan struct{}
+	dropped uint64
+}
+
+// NewDispatcher starts a dispatcher that buffers up to capacity updates for
+// fn, handling overflow according to policy. An error is returned if
+// capacity is less than one, as there would be no room to enqueue into.
+func NewDispatcher(capacity int, policy OverflowPolicy, fn func([]IncrementalUpdate)) (*Dispatcher, error) {
+	if capacity < 1 {
+		return nil, errors.New("Dispatcher capacity must be at least one")
+	}
+	d := &Dispatcher{
+		ch:     make(chan IncrementalUpdate, capacity),
+		policy: policy,
+		fn:     fn,
+		done:   make(chan struct{}),
+	}
+	go d.run()
+	return d, nil
+}
+
+// run delivers updates until the dispatcher is closed and drained.
+func (d *Dispatcher) run() {
+	defer close(d.done)
+	batch := make([]IncrementalUpdate, 0, cap(d.ch)+1)
+	for u := range d.ch {
+		batch = append(batch[:0], u)
+	drain:
+		for len(batch) < cap(batch) {
+			select {
+			case u, ok := <-d.ch:
+				if !ok {
+					break drain
+				}
+				batch = append(batch, u)
+			default:
+				break drain
+			}
+		}
+		d.fn(batch)
+	}
+}
+
+// Enqueue buffers an update for delivery. It must not be called after Close.
+func (d *Dispatcher) Enqueue(u IncrementalUpdate) {
+	if u.Trades != nil {
+		u.Trades = append(make([]Trade, 0, len(u.Trades)), u.Trades...)
+	}
+	if d.policy == Block {
+		d.ch <- u
+		return
+	}
+	for {
+		select {
+		case d.ch <- u:
+			return
+		default:
+		}
+		if d.policy == DropNewest {
+			atomic.AddUint64(&d.dropped, 1)
+			return
+		}
+		select {
+		case <-d.ch:
+			atomic.AddUint64(&d.dropped, 1)
+		default:
+		}
+	}
+}
+
+// Dropped returns the number of updates discarded because the buffer was
+// full.
+func (d *Dispatcher) Dropped() uint64 {
+	return atomic.LoadUint64(&d.dropped)
+}
+
+// Close stops accepting updates and waits for every buffered update to be
+// delivered.
+func (d *Dispatcher) Close() {
+	close(d.ch)
+	<-d.done
+}
@@ -0,0 +1,129 @@
+// Copyright 2024 Lane A. Shetron
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package orderbook
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDispatcher(t *testing.T) {
+	cases := []struct {
+		Name     string
+		Policy   OverflowPolicy
+		Expected []uint64
+		Dropped  uint64
+	}{
+		{"drop-oldest", DropOldest, []uint64{1, 5, 6}, 3},
+		{"drop-newest", DropNewest, []uint64{1, 2, 3}, 3},
+	}
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			started, release := make(chan struct{}), make(chan struct{})
+			var received []uint64
+			d, _ := NewDispatcher(2, c.Policy, func(batch []IncrementalUpdate) {
+				if len(received) == 0 {
+					close(started)
+					<-release
+				}
+				for _, u := range batch {
+					received = append(received, u.Sequence)
+				}
+			})
+			ob := NewOrderBook()
+			ob.OnIncrementalUpdate(d.Enqueue)
+
+			ob.Insert(1, BID, 99.0, 1)
+			<-started
+			// The subscriber is stuck on the first update, so these
+			// overflow the buffer but must not stall the book
+			done := make(chan struct{})
+			go func() {
+				for i := 2; i <= 6; i++ {
+					ob.Insert(i, BID, 99.0, 1)
+				}
+				close(done)
+			}()
+			select {
+			case <-done:
+			case <-time.After(time.Second):
+				t.Fatalf("Expected matching not to block on a slow subscriber")
+			}
+
+			close(release)
+			d.Close()
+			if len(received) != len(c.Expected) {
+				t.Fatalf("Expected sequences %v, got %v", c.Expected, received)
+			}
+			for i := range c.Expected {
+				if received[i] != c.Expected[i] {
+					t.Errorf("Expected sequences %v, got %v", c.Expected, received)
+					break
+				}
+			}
+			if d.Dropped() != c.Dropped {
+				t.Errorf("Expected %d dropped, got %d", c.Dropped, d.Dropped())
+			}
+		})
+	}
+}
+
+func TestDispatcherBlock(t *testing.T) {
+	var received []uint64
+	d, _ := NewDispatcher(1, Block, func(batch []IncrementalUpdate) {
+		for _, u := range batch {
+			received = append(received, u.Sequence)
+		}
+	})
+	ob := NewOrderBook()
+	ob.OnIncrementalUpdate(d.Enqueue)
+	for i := 1; i <= 50; i++ {
+		ob.Insert(i, ASK, 100.0, 1)
+	}
+	d.Close()
+	if len(received) != 50 || d.Dropped() != 0 {
+		t.Fatalf("Expected all 50 updates, got %d", len(received))
+	}
+	for i, seq := range received {
+		if seq != uint64(i+1) {
+			t.Errorf("Expected sequence %d, got %d", i+1, seq)
+		}
+	}
+}
+
+func TestDispatcherCapacity(t *testing.T) {
+	for _, capacity := range []int{0, -1} {
+		if _, err := NewDispatcher(capacity, DropOldest, func([]IncrementalUpdate) {}); err == nil {
+			t.Errorf("Expected capacity %d to be rejected", capacity)
+		}
+	}
+}
+
+func TestDispatcherOwnsTrades(t *testing.T) {
+	var received []Trade
+	d, _ := NewDispatcher(4, Block, func(batch []IncrementalUpdate) {
+		for _, u := range batch {
+			received = append(received, u.Trades...)
+		}
+	})
+	ob := NewOrderBook()
+	ob.OnIncrementalUpdate(d.Enqueue)
+	ob.Insert(1, ASK, 100.0, 5)
+	trades, _ := ob.Insert(2, BID, 100.0, 5)
+	trades[0].Volume = -1
+	d.Close()
+	if len(received) != 1 || received[0].Volume != 5 {
+		t.Errorf("Expected the dispatched trade to be unaffected by the caller, got %+v", received)
+	}
+}
@@ -0,0 +1,99 @@
+package orderbook
+
+import "fmt"
+
+// RejectReason describes why an order was refused before reaching the book.
+type RejectReason uint8
+
+const (
+	// RejectMaxQuantity indicates the order quantity exceeds the configured
+	// maximum order quantity.
+	RejectMaxQuantity RejectReason = iota + 1
+	// RejectWouldCross indicates a post-only order would have traded on
+	// arrival.
+	RejectWouldCross
+	// RejectSelfCross indicates the order would cross a resting order from
+	// the same account.
+	RejectSelfCross
+	// RejectInvalidQuantity indicates the order quantity is zero or
+	// negative.
+	RejectInvalidQuantity
+	// RejectInvalidPrice indicates a price is zero or negative, and the
+	// book does not allow such prices, or is too large to be a Price.
+	RejectInvalidPrice
+	// RejectDuplicateOrderId indicates the order's id is already in use by a
+	// resting order.
+	RejectDuplicateOrderId
+	// RejectOffTick indicates a price is not a whole number of ticks, and
+	// the book rejects such prices rather than snapping them.
+	RejectOffTick
+	// RejectMinQuantity indicates the order quantity is below the
+	// configured minimum.
+	RejectMinQuantity
+	// RejectOffLot indicates the order quantity is not a whole number of
+	// lots above the minimum.
+	RejectOffLot
+	// RejectPaused indicates an IOC or FOK order arrived while the book was
+	// paused, when it could neither trade nor rest.
+	RejectPaused
+	// RejectInvalidOffset indicates a trailing stop's offset is zero,
+	// negative or too large to be a price.
+	RejectInvalidOffset
+	// RejectTickPrecision indicates a price is too large in magnitude for
+	// float32 to tell its tick apart from the neighbouring ticks.
+	RejectTickPrecision
+)
+
+func (r RejectReason) String() string {
+	switch r {
+	case RejectMaxQuantity:
+		return "quantity exceeds maximum order quantity"
+	case RejectWouldCross:
+		return "post-only order would cross the book"
+	case RejectSelfCross:
+		return "order would cross the account's own resting order"
+	case RejectInvalidQuantity:
+		return "quantity must be positive"
+	case RejectInvalidPrice:
+		return "price must be positive"
+	case RejectDuplicateOrderId:
+		return "order id already exists"
+	case RejectOffTick:
+		return "price is not on the tick grid"
+	case RejectMinQuantity:
+		return "quantity is below minimum order quantity"
+	case RejectOffLot:
+		return "quantity is not a whole number of lots"
+	case RejectPaused:
+		return "immediate order cannot match while the book is paused"
+	case RejectInvalidOffset:
+		return "trailing offset must be positive"
+	case RejectTickPrecision:
+		return "price is too large to resolve the tick"
+	}
+	return "unknown reason"
+}
+
+// RejectError is returned when an order fails validation. The book is left
+// unchanged whenever a RejectError is returned.
+type RejectError struct {
+	OrderId int
+	Reason  RejectReason
+}
+
+func (e *RejectError) Error() string {
+	return fmt.Sprintf("Order %d rejected: %s", e.OrderId, e.Reason)
+}
+
+// SequenceError is returned by the sequenced operations when the supplied
+// sequence number is not strictly greater than the last applied one, i.e.
+// the update is a duplicate or arrived out of order. The book is left
+// unchanged.
+type SequenceError struct {
+	Seq         uint64
+	LastApplied uint64
+}
+
+func (e *SequenceError) Error() string {
+	return fmt.Sprintf("Sequence %d is not after last applied sequence %d", e.Seq, e.LastApplied)
+}
@@ -0,0 +1,237 @@
+package orderbook
+
+// OrderState is a stage in the lifecycle of an order. Every order starts out
+// as OrderNew and moves forward through the states as follows:
+//
+//	OrderNew -> OrderPartiallyFilled -> OrderFilled
+//	OrderNew or OrderPartiallyFilled -> OrderCancelled or OrderExpired
+//
+// OrderFilled, OrderCancelled and OrderExpired are terminal.
+type OrderState uint8
+
+const (
+	// OrderNew is an order with no executions.
+	OrderNew OrderState = iota
+	// OrderPartiallyFilled is an order with some, but not all, of its
+	// quantity executed.
+	OrderPartiallyFilled
+	// OrderFilled is an order whose quantity has been executed in full.
+	OrderFilled
+	// OrderCancelled is an order removed from the book at the request of
+	// its owner.
+	OrderCancelled
+	// OrderExpired is an order removed from the book by the book itself,
+	// e.g. when its time in force lapses.
+	OrderExpired
+)
+
+func (s OrderState) String() string {
+	switch s {
+	case OrderNew:
+		return "new"
+	case OrderPartiallyFilled:
+		return "partially filled"
+	case OrderFilled:
+		return "filled"
+	case OrderCancelled:
+		return "cancelled"
+	case OrderExpired:
+		return "expired"
+	}
+	return "unknown"
+}
+
+// state derives the lifecycle state of an order from its quantities.
+func (o *Order) state() OrderState {
+	if o.Quantity <= 0 {
+		return OrderFilled
+	} else if o.Filled > 0 {
+		return OrderPartiallyFilled
+	}
+	return OrderNew
+}
+
+// OnOrderStateChange registers fn to be called whenever an order, whether
+// taker or maker, moves from one OrderState to another. It is called after
+// the book has been updated. Passing nil removes the callback.
+func (ob *OrderBook) OnOrderStateChange(fn func(orderId int, old, new OrderState)) {
+	ob.onStateChange = fn
+}
+
+// OnSelfMatch registers fn to be called when matching passes over a resting
+// order with the same id as the incoming order, once per incoming order.
+// This indicates a stale or duplicate order id, e.g. one reused by the
+// caller, and the order is never matched against itself. If that resting
+// order is all that is left at the best opposite level, the incoming order
+// cannot trade past it and would cross it if it rested, so its unfilled
+// quantity is canceled. Passing nil removes the callback.
+func (ob *OrderBook) OnSelfMatch(fn func(orderId int)) {
+	ob.onSelfMatch = fn
+}
+
+// OnTrade registers fn to be called for every trade, in the order the trades
+// occurred. Like the other event hooks below it is called once the
+// operation that produced the event has completed, so fn sees the book in a
+// consistent state. Passing nil removes the callback.
+func (ob *OrderBook) OnTrade(fn func(Trade)) {
+	ob.onTrade = fn
+}
+
+// OnAdd registers fn to be called whenever an order comes to rest on the
+// book, with a copy of the order as it was added. Passing nil removes the
+// callback.
+func (ob *OrderBook) OnAdd(fn func(OrderView)) {
+	ob.onAdd = fn
+}
+
+// OnCancel registers fn to be called whenever an order is canceled or
+// expires, whether it was resting or is an incoming order whose remainder
+// was discarded. Passing nil removes the callback.
+func (ob *OrderBook) OnCancel(fn func(orderId int)) {
+	ob.onCancel = fn
+}
+
+// OnFill registers fn to be called for each side of every trade, first the
+// maker and then the taker, with the quantity filled and the quantity of the
+// order still unfilled. Passing nil removes the callback.
+func (ob *OrderBook) OnFill(fn func(orderId int, price float32, quantity int, remaining int)) {
+	ob.onFill = fn
+}
+
+// emitFill queues the events for a trade between a maker and a taker.
+func (ob *OrderBook) emitFill(t Trade, maker *Order, taker *Order) {
+	if fn := ob.onTrade; fn != nil {
+		ob.events = append(ob.events, func() { fn(t) })
+	}
+	if fn := ob.onFill; fn != nil {
+		makerLeft, takerLeft := maker.Quantity, taker.Quantity
+		ob.events = append(ob.events,
+			func() { fn(t.MakerOrderId, t.Price.float32(), t.Volume, makerLeft) },
+			func() { fn(t.TakerOrderId, t.Price.float32(), t.Volume, takerLeft) })
+	}
+}
+
+// transition reports a change of state for an order, if there was one.
+func (ob *OrderBook) transition(o *Order, old, new OrderState) {
+	if old == new {
+		return
+	}
+	orderId := o.OrderId
+	if fn := ob.onStateChange; fn != nil {
+		ob.events = append(ob.events, func() { fn(orderId, old, new) })
+	}
+	if fn := ob.onCancel; fn != nil && (new == OrderCancelled || new == OrderExpired) {
+		ob.events = append(ob.events, func() { fn(orderId) })
+	}
+	if new == OrderFilled || new == OrderCancelled || new == OrderExpired {
+		ob.pool.retireOrder(o)
+	}
+}
+
+// LevelUpdate is the aggregate volume now resting at a price level. A Volume
+// of zero means the level has been removed.
+type LevelUpdate struct {
+	Price  float32
+	Volume int
+}
+
+// IncrementalUpdate describes everything that changed in the book as the
+// result of a single operation: every price level whose volume changed, on
+// each side, and every trade. Sequence increases by one with each operation
+// that changes the book.
+type IncrementalUpdate struct {
+	Sequence uint64
+	Bids     []LevelUpdate
+	Asks     []LevelUpdate
+	Trades   []Trade
+}
+
+// levelKey identifies a price level changed by the current operation.
+type levelKey struct {
+	side  Side
+	price Price
+}
+
+// Sequence returns the number of operations that have changed the book.
+func (ob *OrderBook) Sequence() uint64 {
+	return ob.sequence
+}
+
+// OnIncrementalUpdate registers fn to be called once at the end of every
+// operation that changes the book, with an IncrementalUpdate describing the
+// change. Passing nil removes the callback.
+func (ob *OrderBook) OnIncrementalUpdate(fn func(IncrementalUpdate)) {
+	ob.onUpdate = fn
+	ob.touched = ob.touched[:0]
+}
+
+// touch records that the volume at a price level may have changed during the
+// current operation. Levels are only tracked while an update callback is
+// registered.
+func (ob *OrderBook) touch(side Side, price Price) {
+	if ob.onUpdate == nil {
+		return
+	}
+	for _, k := range ob.touched {
+		if k.side == side && k.price == price {
+			return
+		}
+	}
+	ob.touched = append(ob.touched, levelKey{side, price})
+}
+
+// publish completes an operation that changed the book, advancing the
+// sequence and emitting an IncrementalUpdate for the levels it touched, then
+// calls the event hooks queued during the operation and activates any
+// conditional and stop orders the change has triggered.
+func (ob *OrderBook) publish(trades []Trade) {
+	// Deferred first so that it runs last, once the events have been
+	// delivered and nothing can still be reading what was retired
+	defer ob.pool.release()
+	ob.sequence++
+	if len(ob.BidBook.evicted) > 0 || len(ob.AskBook.evicted) > 0 {
+		ob.cancelEvicted()
+	}
+	if len(ob.conditionals) > 0 {
+		defer ob.checkTriggers()
+	}
+	if len(ob.stops) > 0 && (len(trades) > 0 || len(ob.stopPrices) > 0) {
+		defer ob.checkStops(trades)
+	}
+	if len(ob.trailing) > 0 {
+		defer ob.checkTrailing()
+	}
+	if len(ob.events) > 0 {
+		defer ob.flushEvents()
+	}
+	if ob.onUpdate == nil {
+		return
+	}
+	u := IncrementalUpdate{Sequence: ob.sequence, Trades: trades}
+	for _, k := range ob.touched {
+		l := LevelUpdate{Price: k.price.float32()}
+		if k.side == ASK {
+			if n, ok := ob.AskBook.GetLevel(k.price); ok {
+				l.Volume, _ = n.displayed()
+			}
+			u.Asks = append(u.Asks, l)
+		} else {
+			if n, ok := ob.BidBook.GetLevel(k.price); ok {
+				l.Volume, _ = n.displayed()
+			}
+			u.Bids = append(u.Bids, l)
+		}
+	}
+	ob.touched = ob.touched[:0]
+	ob.onUpdate(u)
+}
+
+// flushEvents calls the event hooks queued during the current operation. A
+// hook may itself change the book, queueing and flushing events of its own.
+func (ob *OrderBook) flushEvents() {
+	events := ob.events
+	ob.events = nil
+	for _, fn := range events {
+		fn()
+	}
+}
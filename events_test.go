@@ -0,0 +1,201 @@
+// Copyright 2024 Lane A. Shetron
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package orderbook
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+type stateChange struct {
+	OrderId  int
+	Old, New OrderState
+}
+
+func TestOnOrderStateChange(t *testing.T) {
+	ob := NewOrderBook()
+	var changes []stateChange
+	ob.OnOrderStateChange(func(orderId int, old, new OrderState) {
+		changes = append(changes, stateChange{orderId, old, new})
+	})
+
+	ob.Insert(1, ASK, 100.0, 10)
+	ob.Insert(2, BID, 100.0, 4)
+	ob.Insert(3, BID, 100.0, 6)
+	ob.Insert(4, ASK, 101.0, 10)
+	ob.Insert(5, BID, 101.0, 3)
+	ob.Cancel(4)
+	ob.Insert(6, ASK, 102.0, 1)
+	ob.Update(6, 102.0, 0)
+
+	expected := []stateChange{
+		{1, OrderNew, OrderPartiallyFilled},
+		{2, OrderNew, OrderFilled},
+		{1, OrderPartiallyFilled, OrderFilled},
+		{3, OrderNew, OrderFilled},
+		{4, OrderNew, OrderPartiallyFilled},
+		{5, OrderNew, OrderFilled},
+		{4, OrderPartiallyFilled, OrderCancelled},
+		{6, OrderNew, OrderCancelled},
+	}
+	if len(changes) != len(expected) {
+		t.Fatalf("Expected %d transitions, got %+v", len(expected), changes)
+	}
+	for i := range expected {
+		if changes[i] != expected[i] {
+			t.Errorf("Expected transition %+v, got %+v", expected[i], changes[i])
+		}
+	}
+}
+
+func TestOnOrderStateChangeAfterUpdate(t *testing.T) {
+	ob := NewOrderBook()
+	ob.Insert(1, ASK, 100.0, 5)
+	ob.Insert(2, ASK, 101.0, 5)
+	type seen struct {
+		OrderId int
+		New     OrderState
+		Asks    int
+		Resting bool
+	}
+	var got []seen
+	ob.OnOrderStateChange(func(orderId int, old, new OrderState) {
+		_, _, resting := ob.GetOrder(3)
+		got = append(got, seen{orderId, new, ob.TotalVolume(ASK), resting})
+	})
+
+	// Every callback sees the book once the sweep has finished and the
+	// remainder of the bid is resting
+	ob.Insert(3, BID, 101.0, 12)
+	expected := []seen{
+		{1, OrderFilled, 0, true},
+		{3, OrderPartiallyFilled, 0, true},
+		{2, OrderFilled, 0, true},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, got)
+	}
+}
+
+func TestOnIncrementalUpdate(t *testing.T) {
+	ob := NewOrderBook()
+	var updates []IncrementalUpdate
+	ob.OnIncrementalUpdate(func(u IncrementalUpdate) {
+		updates = append(updates, u)
+	})
+
+	ob.Insert(1, ASK, 100.0, 3)
+	ob.Insert(2, ASK, 100.0, 2)
+	ob.Insert(3, ASK, 101.0, 5)
+	ob.Insert(4, ASK, 102.0, 5)
+	ob.Insert(5, BID, 99.0, 1)
+	if len(updates) != 5 {
+		t.Fatalf("Expected 5 updates, got %d", len(updates))
+	}
+
+	trades, _ := ob.Insert(6, BID, 103.0, 12)
+	if len(updates) != 6 {
+		t.Fatalf("Expected a single update for the sweep, got %d", len(updates)-5)
+	}
+	u := updates[5]
+	if u.Sequence != 6 || ob.Sequence() != 6 {
+		t.Errorf("Expected sequence 6, got %d", u.Sequence)
+	}
+	expected := []LevelUpdate{{100.0, 0}, {101.0, 0}, {102.0, 3}}
+	if len(u.Asks) != len(expected) {
+		t.Fatalf("Expected %d ask levels, got %+v", len(expected), u.Asks)
+	}
+	for i := range expected {
+		if u.Asks[i] != expected[i] {
+			t.Errorf("Expected ask level %+v, got %+v", expected[i], u.Asks[i])
+		}
+	}
+	if len(u.Bids) != 0 {
+		t.Errorf("Expected no bid levels, got %+v", u.Bids)
+	}
+	if len(u.Trades) != 4 || len(trades) != 4 {
+		t.Errorf("Expected 4 trades, got %+v", u.Trades)
+	}
+
+	ob.Update(5, 99.5, 2)
+	u = updates[6]
+	expected = []LevelUpdate{{99.0, 0}, {99.5, 2}}
+	if len(u.Bids) != len(expected) || u.Bids[0] != expected[0] || u.Bids[1] != expected[1] {
+		t.Errorf("Expected bid levels %+v, got %+v", expected, u.Bids)
+	}
+
+	ob.Cancel(42)
+	if len(updates) != 7 || ob.Sequence() != 7 {
+		t.Errorf("Expected a failed cancel not to publish an update")
+	}
+	ob.CancelBatch([]int{4, 5}, BestEffort)
+	if len(updates) != 8 || len(updates[7].Asks) != 1 || len(updates[7].Bids) != 1 {
+		t.Errorf("Expected a single update for the batch, got %+v", updates[7:])
+	}
+}
+
+func TestEventHooks(t *testing.T) {
+	ob := NewOrderBook()
+	var events []string
+	ob.OnTrade(func(tr Trade) {
+		events = append(events, fmt.Sprintf("trade %d/%d %d", tr.MakerOrderId, tr.TakerOrderId, tr.Volume))
+	})
+	ob.OnFill(func(orderId int, price float32, quantity int, remaining int) {
+		events = append(events, fmt.Sprintf("fill %d %d left %d", orderId, quantity, remaining))
+	})
+	ob.OnAdd(func(o OrderView) {
+		// The book is complete by the time any hook is called
+		if _, ok := ob.Inspect(o.OrderId); !ok {
+			t.Errorf("Expected order %d to be resting when reported", o.OrderId)
+		}
+		events = append(events, fmt.Sprintf("add %d %d", o.OrderId, o.Quantity))
+	})
+	ob.OnCancel(func(orderId int) {
+		events = append(events, fmt.Sprintf("cancel %d", orderId))
+	})
+
+	ob.Insert(1, ASK, 100.0, 5)
+	ob.Insert(2, ASK, 101.0, 5)
+	ob.Insert(3, ASK, 102.0, 5)
+	ob.Insert(4, BID, 101.0, 12)
+	ob.Cancel(4)
+	ob.InsertOrder(BID, &Order{OrderId: 5, Price: px(102.0), Quantity: 10, TimeInForce: IOC})
+
+	expected := []string{
+		"add 1 5",
+		"add 2 5",
+		"add 3 5",
+		"trade 1/4 5",
+		"fill 1 5 left 0",
+		"fill 4 5 left 7",
+		"trade 2/4 5",
+		"fill 2 5 left 0",
+		"fill 4 5 left 2",
+		"add 4 2",
+		"cancel 4",
+		"trade 3/5 5",
+		"fill 3 5 left 0",
+		"fill 5 5 left 5",
+		"cancel 5",
+	}
+	if len(events) != len(expected) {
+		t.Fatalf("Expected %d events, got %q", len(expected), events)
+	}
+	for i := range expected {
+		if events[i] != expected[i] {
+			t.Errorf("Expected event %d to be %q, got %q", i, expected[i], events[i])
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package orderbook
+
+// ExecType is the kind of an execution report, after the FIX ExecType field.
+type ExecType uint8
+
+const (
+	// ExecNew acknowledges an order accepted by the book.
+	ExecNew ExecType = iota
+	// ExecTrade reports a single fill.
+	ExecTrade
+	// ExecCanceled reports an order taken off the book.
+	ExecCanceled
+	// ExecReplaced acknowledges a change to an order's price or quantity.
+	ExecReplaced
+)
+
+func (t ExecType) String() string {
+	switch t {
+	case ExecNew:
+		return "new"
+	case ExecTrade:
+		return "trade"
+	case ExecCanceled:
+		return "canceled"
+	case ExecReplaced:
+		return "replaced"
+	}
+	return "unknown"
+}
+
+// ExecReport is an execution report for one order, carrying the fields a
+// FIX gateway needs to build an ExecutionReport message. LastQty and
+// LastPrice are set only for ExecTrade reports.
+type ExecReport struct {
+	ExecType  ExecType
+	OrderId   int
+	Side      Side
+	LastQty   int
+	LastPrice float32
+	// CumQty is the quantity filled so far by the reported action, and
+	// LeavesQty the quantity still open after it.
+	CumQty    int
+	LeavesQty int
+}
+
+// ExecReports builds the execution reports for an action on an order: a
+// lifecycle report for the action itself, followed for ExecNew and
+// ExecReplaced by one ExecTrade report for each of trades in which the order
+// was the taker. quantity is the order's open quantity as submitted, e.g.
+// the volume passed to Insert or Update, and LeavesQty is decremented from
+// it fill by fill. An ExecCanceled report always has no quantity left, and
+// trades are ignored for it.
+func ExecReports(action ExecType, orderId int, side Side, quantity int, trades []Trade) []ExecReport {
+	if action == ExecCanceled {
+		return []ExecReport{{ExecType: ExecCanceled, OrderId: orderId, Side: side}}
+	}
+	reports := []ExecReport{{ExecType: action, OrderId: orderId, Side: side, LeavesQty: quantity}}
+	cum := 0
+	for _, t := range trades {
+		if t.TakerOrderId != orderId {
+			continue
+		}
+		cum += t.Volume
+		reports = append(reports, ExecReport{
+			ExecType:  ExecTrade,
+			OrderId:   orderId,
+			Side:      side,
+			LastQty:   t.Volume,
+			LastPrice: t.Price.float32(),
+			CumQty:    cum,
+			LeavesQty: max(quantity-cum, 0),
+		})
+	}
+	return reports
+}
@@ -0,0 +1,55 @@
+// Copyright 2024 Lane A. Shetron
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package orderbook
+
+import (
+	"testing"
+)
+
+func TestExecReports(t *testing.T) {
+	ob := NewOrderBook()
+	ob.Insert(1, ASK, 100.0, 3)
+	ob.Insert(2, ASK, 101.0, 4)
+	ob.Insert(3, ASK, 102.0, 5)
+
+	trades, _ := ob.Insert(4, BID, 102.0, 10)
+	reports := ExecReports(ExecNew, 4, BID, 10, trades)
+	expected := []ExecReport{
+		{ExecType: ExecNew, OrderId: 4, Side: BID, LeavesQty: 10},
+		{ExecType: ExecTrade, OrderId: 4, Side: BID, LastQty: 3, LastPrice: 100.0, CumQty: 3, LeavesQty: 7},
+		{ExecType: ExecTrade, OrderId: 4, Side: BID, LastQty: 4, LastPrice: 101.0, CumQty: 7, LeavesQty: 3},
+		{ExecType: ExecTrade, OrderId: 4, Side: BID, LastQty: 3, LastPrice: 102.0, CumQty: 10, LeavesQty: 0},
+	}
+	if len(reports) != len(expected) {
+		t.Fatalf("Expected %d reports, got %+v", len(expected), reports)
+	}
+	for i, r := range reports {
+		if r != expected[i] {
+			t.Errorf("Expected report %d to be %+v, got %+v", i, expected[i], r)
+		}
+	}
+
+	// A replace that trades in part leaves the rest open
+	ob.Insert(5, BID, 99.0, 6)
+	trades, _ = ob.Update(5, 102.0, 6)
+	reports = ExecReports(ExecReplaced, 5, BID, 6, trades)
+	if len(reports) != 2 || reports[0].ExecType != ExecReplaced || reports[1].LastQty != 2 || reports[1].LeavesQty != 4 {
+		t.Errorf("Expected a replaced report and a fill of 2 leaving 4, got %+v", reports)
+	}
+
+	reports = ExecReports(ExecCanceled, 5, BID, 4, nil)
+	if len(reports) != 1 || reports[0].ExecType != ExecCanceled || reports[0].LeavesQty != 0 {
+		t.Errorf("Expected a single canceled report, got %+v", reports)
+	}
+}
@@ -0,0 +1,69 @@
+package orderbook
+
+import "sort"
+
+// TradeSizeHistogram counts trades by volume over a rolling window of the
+// most recent trades. Bucket i counts trades with edges[i-1] <= volume <
+// edges[i], with the first bucket holding volumes below edges[0] and the last
+// those at or above the final edge, so there are len(edges)+1 buckets.
+//
+// It is fed trades with Add, or can consume a book's updates directly:
+//
+//	ob.OnIncrementalUpdate(h.OnUpdate)
+type TradeSizeHistogram struct {
+	edges  []int
+	counts []int
+	// recent holds the bucket of each trade in the window as a ring buffer
+	recent []int
+	next   int
+	full   bool
+}
+
+// NewTradeSizeHistogram creates a histogram with the given bucket edges,
+// which must be in increasing order, over a window of the last window
+// trades. A window of zero counts every trade.
+func NewTradeSizeHistogram(edges []int, window int) *TradeSizeHistogram {
+	return &TradeSizeHistogram{
+		edges:  append([]int(nil), edges...),
+		counts: make([]int, len(edges)+1),
+		recent: make([]int, window),
+	}
+}
+
+// Add records a trade, evicting the oldest trade once the window is full.
+func (h *TradeSizeHistogram) Add(t Trade) {
+	bucket := sort.SearchInts(h.edges, t.Volume+1)
+	h.counts[bucket]++
+	if len(h.recent) == 0 {
+		return
+	}
+	if h.full {
+		h.counts[h.recent[h.next]]--
+	}
+	h.recent[h.next] = bucket
+	h.next = (h.next + 1) % len(h.recent)
+	h.full = h.full || h.next == 0
+}
+
+// OnUpdate records the trades in a book update.
+func (h *TradeSizeHistogram) OnUpdate(u IncrementalUpdate) {
+	for _, t := range u.Trades {
+		h.Add(t)
+	}
+}
+
+// Snapshot returns a copy of the current count in each bucket.
+func (h *TradeSizeHistogram) Snapshot() []int {
+	return append([]int(nil), h.counts...)
+}
+
+// LevelSizeHistogram returns the number of orders at each distinct quantity
+// in the level at price on side, as Node.SizeHistogram does, or nil if
+// there is no such level. With a tick size, price is first snapped to the
+// nearest tick.
+func (ob *OrderBook) LevelSizeHistogram(side Side, price float32) map[int]int {
+	if n, ok := ob.levels(side)[ob.price(price)]; ok {
+		return n.SizeHistogram()
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+// Copyright 2024 Lane A. Shetron
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package orderbook
+
+import (
+	"testing"
+)
+
+func TestTradeSizeHistogram(t *testing.T) {
+	cases := []struct {
+		Name     string
+		Window   int
+		Sizes    []int
+		Expected []int
+	}{
+		{"unbounded", 0, []int{1, 9, 10, 50, 99, 100, 500, 3}, []int{3, 1, 2, 2}},
+		{"window", 4, []int{1, 9, 10, 50, 99, 100, 500, 3}, []int{1, 0, 1, 2}},
+		{"partial window", 10, []int{1, 100}, []int{1, 0, 0, 1}},
+	}
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			h := NewTradeSizeHistogram([]int{10, 50, 100}, c.Window)
+			for _, size := range c.Sizes {
+				h.Add(Trade{Volume: size})
+			}
+			counts := h.Snapshot()
+			for i := range c.Expected {
+				if counts[i] != c.Expected[i] {
+					t.Errorf("Expected counts %v, got %v", c.Expected, counts)
+					break
+				}
+			}
+		})
+	}
+
+	// Fed from the book's trade stream
+	ob := NewOrderBook()
+	h := NewTradeSizeHistogram([]int{10}, 0)
+	ob.OnIncrementalUpdate(h.OnUpdate)
+	ob.Insert(1, ASK, 100.0, 5)
+	ob.Insert(2, ASK, 100.0, 20)
+	ob.Insert(3, BID, 100.0, 25)
+	if counts := h.Snapshot(); counts[0] != 1 || counts[1] != 1 {
+		t.Errorf("Expected one small and one large trade, got %v", counts)
+	}
+}
+
+func TestLevelSizeHistogram(t *testing.T) {
+	ob := NewOrderBook()
+	for i, size := range []int{5, 10, 5, 1, 5, 10} {
+		ob.Insert(i+1, BID, 99.0, size)
+	}
+	ob.InsertOrder(BID, &Order{OrderId: 7, Price: px(99.0), Quantity: 1, Hidden: true})
+	ob.Insert(8, BID, 98.0, 5)
+
+	h := ob.LevelSizeHistogram(BID, 99.0)
+	expected := map[int]int{1: 2, 5: 3, 10: 2}
+	if len(h) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, h)
+	}
+	for size, count := range expected {
+		if h[size] != count {
+			t.Errorf("Expected %d orders of size %d, got %d", count, size, h[size])
+		}
+	}
+
+	// Partial fills move an order to its remaining size
+	ob.Insert(9, ASK, 99.0, 3)
+	h = ob.LevelSizeHistogram(BID, 99.0)
+	if h[5] != 2 || h[2] != 1 {
+		t.Errorf("Expected the first order to be counted at size 2, got %v", h)
+	}
+
+	if h := ob.LevelSizeHistogram(BID, 97.0); h != nil {
+		t.Errorf("Expected nil for a missing level, got %v", h)
+	}
+	if h := ob.LevelSizeHistogram(ASK, 99.0); h != nil {
+		t.Errorf("Expected nil for the empty side, got %v", h)
+	}
+}
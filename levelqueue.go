@@ -0,0 +1,118 @@
+package orderbook
+
+import "container/list"
+
+// Handle is an order's position in a LevelQueue. It remains valid until the
+// order is removed from the queue.
+type Handle interface {
+	Order() *Order
+	// Next and Prev return the neighbouring handles in time priority, or
+	// nil at either end of the queue.
+	Next() Handle
+	Prev() Handle
+}
+
+// LevelQueue holds the orders resting at a price level in time priority.
+// Implementations can be swapped in with SetLevelQueue. Iterate over a queue
+// with:
+//
+//	for h := q.Front(); h != nil; h = h.Next() {
+//		o := h.Order()
+//	}
+type LevelQueue interface {
+	PushBack(o *Order) Handle
+	// Front and Back return nil if the queue is empty.
+	Front() Handle
+	Back() Handle
+	Remove(h Handle) *Order
+	MoveToBack(h Handle)
+	Len() int
+}
+
+// NewListQueue returns the default LevelQueue, backed by container/list.
+func NewListQueue() LevelQueue {
+	return listQueue{list.New()}
+}
+
+type listQueue struct {
+	l *list.List
+}
+
+// listHandle is a list element; converting between the two is free.
+type listHandle list.Element
+
+func toHandle(e *list.Element) Handle {
+	if e == nil {
+		return nil
+	}
+	return (*listHandle)(e)
+}
+
+func (h *listHandle) Order() *Order {
+	return h.Value.(*Order)
+}
+
+func (h *listHandle) Next() Handle {
+	return toHandle((*list.Element)(h).Next())
+}
+
+func (h *listHandle) Prev() Handle {
+	return toHandle((*list.Element)(h).Prev())
+}
+
+func (q listQueue) PushBack(o *Order) Handle {
+	return toHandle(q.l.PushBack(o))
+}
+
+func (q listQueue) Front() Handle {
+	return toHandle(q.l.Front())
+}
+
+func (q listQueue) Back() Handle {
+	return toHandle(q.l.Back())
+}
+
+func (q listQueue) Remove(h Handle) *Order {
+	return q.l.Remove((*list.Element)(h.(*listHandle))).(*Order)
+}
+
+func (q listQueue) MoveToBack(h Handle) {
+	q.l.MoveToBack((*list.Element)(h.(*listHandle)))
+}
+
+func (q listQueue) Len() int {
+	return q.l.Len()
+}
+
+// SetLevelQueue selects the LevelQueue implementation used for price levels
+// created from now on; existing levels keep their queues. A nil constructor
+// restores the default, NewListQueue.
+func (ob *OrderBook) SetLevelQueue(newQueue func() LevelQueue) {
+	ob.AskBook.newQueue = newQueue
+	ob.BidBook.newQueue = newQueue
+}
+
+// listNode is a level with the default queue, allocated together so that a
+// new level costs a single allocation.
+type listNode struct {
+	Node
+	l list.List
+}
+
+// newNode creates a level using the given queue constructor, or the default
+// if it is nil.
+func newNode(price Price, newQueue func() LevelQueue) *Node {
+	if newQueue != nil {
+		return &Node{
+			Level: newQueue(),
+			Key:   price,
+		}
+	}
+	ln := &listNode{}
+	ln.l.Init()
+	ln.Node = Node{
+		Level: listQueue{&ln.l},
+		Key:   price,
+	}
+	return &ln.Node
+}
@@ -0,0 +1,111 @@
+// Copyright 2024 Lane A. Shetron
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package orderbook
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestListQueue(t *testing.T) {
+	q := NewListQueue()
+	if q.Front() != nil || q.Back() != nil {
+		t.Errorf("Expected an empty queue to have no front or back")
+	}
+	var handles []Handle
+	for i := 1; i <= 3; i++ {
+		handles = append(handles, q.PushBack(NewOrder(i, px(100.0), i)))
+	}
+	q.MoveToBack(handles[0])
+	if o := q.Remove(handles[1]); o.OrderId != 2 {
+		t.Errorf("Expected to remove order 2, got %d", o.OrderId)
+	}
+
+	var ids []int
+	for h := q.Front(); h != nil; h = h.Next() {
+		ids = append(ids, h.Order().OrderId)
+	}
+	if len(ids) != 2 || ids[0] != 3 || ids[1] != 1 || q.Len() != 2 {
+		t.Errorf("Expected queue [3 1], got %v", ids)
+	}
+	if h := q.Back(); h.Order().OrderId != 1 || h.Prev().Order().OrderId != 3 || h.Prev().Prev() != nil {
+		t.Errorf("Expected to walk back from order 1 to order 3")
+	}
+}
+
+func TestSetLevelQueue(t *testing.T) {
+	created := 0
+	ob := NewOrderBook()
+	ob.SetLevelQueue(func() LevelQueue {
+		created++
+		return NewListQueue()
+	})
+	ob.Insert(1, BID, 99.0, 5)
+	ob.Insert(2, BID, 99.0, 5)
+	ob.Insert(3, ASK, 101.0, 5)
+	ob.Insert(4, BID, 101.0, 7)
+	if created != 3 {
+		t.Errorf("Expected a queue for each of 3 levels, got %d", created)
+	}
+	if v, ok := ob.Inspect(4); !ok || v.Quantity != 2 {
+		t.Errorf("Expected 2 of order 4 to rest, got %+v", v)
+	}
+
+	ob.SetLevelQueue(nil)
+	ob.Insert(5, BID, 98.0, 5)
+	if created != 3 || ob.BidBook.LevelsMap[px(98.0)].Volume() != 5 {
+		t.Errorf("Expected the default queue to be restored")
+	}
+}
+
+func TestConcurrentBooks(t *testing.T) {
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			ob := NewOrderBook()
+			for i := 0; i < 2000; i++ {
+				price := float32(100 + i%10)
+				ob.Insert(3*i, ASK, price, 10)
+				ob.Insert(3*i+1, ASK, price+1, 10)
+				trades, _ := ob.Insert(3*i+2, BID, price+1, 20)
+				volume := 0
+				for _, tr := range trades {
+					volume += tr.Volume
+				}
+				if volume != 20 {
+					t.Errorf("Book %d: expected 20 traded, got %d in %d trades", g, volume, len(trades))
+					return
+				}
+			}
+			if n := ob.LevelCount(BID); n != 0 {
+				t.Errorf("Book %d: expected no bids left, got %d levels", g, n)
+			}
+		}(g)
+	}
+	wg.Wait()
+}
+
+// Each insert opens a new level on both sides and fully fills it, so every
+// level is created and removed again
+func BenchmarkLevelChurn(b *testing.B) {
+	ob := NewOrderBook()
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		price := float32(1 + n%1000)
+		ob.Insert(2*n, ASK, price, 1)
+		ob.Insert(2*n+1, BID, price, 1)
+	}
+}
@@ -0,0 +1,82 @@
+package orderbook
+
+import "container/heap"
+
+// BeginLoad puts the book into bulk loading mode, for building a book from
+// a snapshot of resting orders. Until EndLoad is called, Insert rests orders
+// without matching, and new price levels are appended to the heaps without
+// restoring the heap invariant. Peek and Pop are not meaningful while
+// loading.
+func (ob *OrderBook) BeginLoad() {
+	ob.loading = true
+	ob.AskBook.loading = true
+	ob.BidBook.loading = true
+}
+
+// EndLoad leaves bulk loading mode and builds each heap with a single
+// heap.Init, which is O(n) rather than the O(n log n) of n calls to
+// heap.Push.
+func (ob *OrderBook) EndLoad() {
+	heap.Init(&ob.AskBook.Orders)
+	heap.Init(&ob.BidBook.Orders)
+	ob.loading = false
+	ob.AskBook.loading = false
+	ob.BidBook.loading = false
+}
+
+// LoadOrders rests a batch of orders on side without matching, for building
+// a book from a snapshot of resting orders, which are assumed not to cross.
+// Orders are queued in the order given, and the heaps are built once at the
+// end as with BeginLoad and EndLoad, so loading n orders is O(n) rather than
+// the O(n log n) of inserting them one at a time. The orders are copied.
+// Like Restore, LoadOrders emits no events or updates.
+//
+// Every order is validated before any is loaded; if one fails, or has the
+// same id as another order in the batch or in the book, an error is
+// returned and the book is left unchanged.
+func (ob *OrderBook) LoadOrders(side Side, orders []Order) error {
+	seen := make(map[int]bool, len(orders))
+	for i := range orders {
+		o := &orders[i]
+		if err := ob.validate(o.OrderId, o.Quantity, o.Price); err != nil {
+			return err
+		}
+		if _, _, ok := ob.find(o.OrderId); ok || seen[o.OrderId] {
+			return &RejectError{o.OrderId, RejectDuplicateOrderId}
+		}
+		seen[o.OrderId] = true
+	}
+
+	_, book := ob.books(side)
+	// Size the order index for the batch if it is empty and can be replaced
+	index := &ob.BidBook.OrdersMap
+	if side == ASK {
+		index = &ob.AskBook.OrdersMap
+	}
+	if len(*index) == 0 {
+		*index = make(OrdersMap, len(orders))
+	}
+	loading := ob.loading
+	if !loading {
+		ob.BeginLoad()
+	}
+	// Copy the whole batch with a single allocation
+	copies := append([]Order(nil), orders...)
+	for i := range copies {
+		o := &copies[i]
+		o.pooled = false
+		o.Price = ob.snap(o.Price)
+		if ob.clock != nil && o.Timestamp.IsZero() {
+			o.Timestamp = ob.clock()
+		}
+		if o.DisplayQuantity > 0 && o.shown == 0 {
+			o.shown = min(o.DisplayQuantity, o.Quantity)
+		}
+		book.Push(o)
+	}
+	// A load already in progress is finished by its own EndLoad
+	if !loading {
+		ob.EndLoad()
+	}
+	return nil
+}
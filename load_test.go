@@ -0,0 +1,172 @@
+// Copyright 2024 Lane A. Shetron
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package orderbook
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	type order struct {
+		Id    int
+		Side  Side
+		Price float32
+	}
+	var orders []order
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		if i%2 == 0 {
+			orders = append(orders, order{i, BID, float32(1 + r.Intn(100))})
+		} else {
+			orders = append(orders, order{i, ASK, float32(101 + r.Intn(100))})
+		}
+	}
+
+	incremental := NewOrderBook()
+	loaded := NewOrderBook()
+	loaded.BeginLoad()
+	for _, o := range orders {
+		incremental.Insert(o.Id, o.Side, o.Price, 1)
+		loaded.Insert(o.Id, o.Side, o.Price, 1)
+	}
+	loaded.EndLoad()
+
+	for _, side := range []Side{BID, ASK} {
+		var a, b Book = &incremental.BidBook, &loaded.BidBook
+		if side == ASK {
+			a, b = &incremental.AskBook, &loaded.AskBook
+		}
+		if a.Len() != b.Len() {
+			t.Fatalf("Expected %d levels, got %d", a.Len(), b.Len())
+		}
+		for a.Len() > 0 {
+			expected, got := a.Pop(), b.Pop()
+			if expected.OrderId != got.OrderId || expected.Price != got.Price {
+				t.Fatalf("Expected order %d at %v, got %d at %v", expected.OrderId, expected.Price, got.OrderId, got.Price)
+			}
+		}
+	}
+}
+
+func TestLoadThenMatch(t *testing.T) {
+	ob := NewOrderBook()
+	ob.BeginLoad()
+	ob.Insert(1, ASK, 103.0, 1)
+	ob.Insert(2, ASK, 101.0, 1)
+	ob.Insert(3, ASK, 102.0, 1)
+	ob.EndLoad()
+
+	trades, _ := ob.Insert(4, BID, 102.0, 2)
+	if len(trades) != 2 || trades[0].MakerOrderId != 2 || trades[1].MakerOrderId != 3 {
+		t.Errorf("Expected fills against orders 2 and 3, got %+v", trades)
+	}
+}
+
+func TestLoadOrders(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	var bids, asks []Order
+	for i := 0; i < 1000; i++ {
+		o := Order{OrderId: i, Quantity: 1 + r.Intn(5)}
+		if i%2 == 0 {
+			o.Price = px(float64(1 + r.Intn(100)))
+			bids = append(bids, o)
+		} else {
+			o.Price = px(float64(101 + r.Intn(100)))
+			asks = append(asks, o)
+		}
+	}
+
+	incremental := NewOrderBook()
+	for _, o := range bids {
+		incremental.Insert(o.OrderId, BID, o.Price.float32(), o.Quantity)
+	}
+	for _, o := range asks {
+		incremental.Insert(o.OrderId, ASK, o.Price.float32(), o.Quantity)
+	}
+	loaded := NewOrderBook()
+	if err := loaded.LoadOrders(BID, bids); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := loaded.LoadOrders(ASK, asks); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if diffs := DiffSnapshots(incremental.State(), loaded.State()); diffs != nil {
+		t.Errorf("Expected identical books, got %v", diffs)
+	}
+	checkConsistency(t, loaded)
+
+	// The orders are copied, not taken over
+	bids[0].Quantity = 100
+	if v, _ := loaded.Inspect(0); v.Quantity == 100 {
+		t.Errorf("Expected the loaded order to be a copy")
+	}
+
+	// A bad batch loads nothing
+	tests := []struct {
+		name   string
+		orders []Order
+	}{
+		{"duplicate in book", []Order{{OrderId: 5000, Price: px(50), Quantity: 1}, {OrderId: 0, Price: px(50), Quantity: 1}}},
+		{"duplicate in batch", []Order{{OrderId: 5000, Price: px(50), Quantity: 1}, {OrderId: 5000, Price: px(51), Quantity: 1}}},
+		{"no quantity", []Order{{OrderId: 5000, Price: px(50), Quantity: 1}, {OrderId: 5001, Price: px(50)}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := loaded.State()
+			if err := loaded.LoadOrders(BID, tt.orders); err == nil {
+				t.Errorf("Expected an error")
+			}
+			if diffs := DiffSnapshots(before, loaded.State()); diffs != nil {
+				t.Errorf("Expected the book to be unchanged, got %v", diffs)
+			}
+		})
+	}
+}
+
+func loadFixture(n int) (bids, asks []Order) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < n; i++ {
+		if i%2 == 0 {
+			bids = append(bids, Order{OrderId: i, Price: px(float64(1 + r.Intn(100000))), Quantity: 1})
+		} else {
+			asks = append(asks, Order{OrderId: i, Price: px(float64(100001 + r.Intn(100000))), Quantity: 1})
+		}
+	}
+	return bids, asks
+}
+
+func BenchmarkLoadOrders(b *testing.B) {
+	bids, asks := loadFixture(100000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ob := NewOrderBook()
+		ob.LoadOrders(BID, bids)
+		ob.LoadOrders(ASK, asks)
+	}
+}
+
+func BenchmarkLoadSequentialInsert(b *testing.B) {
+	bids, asks := loadFixture(100000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ob := NewOrderBook()
+		for _, o := range bids {
+			ob.Insert(o.OrderId, BID, o.Price.float32(), o.Quantity)
+		}
+		for _, o := range asks {
+			ob.Insert(o.OrderId, ASK, o.Price.float32(), o.Quantity)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package orderbook
+
+import "time"
+
+// midSample is the mid price from at until the next sample. ok is false
+// while the book had no mid.
+type midSample struct {
+	at  time.Time
+	mid float32
+	ok  bool
+}
+
+// MidTracker samples a book's mid price as it changes and computes
+// time-weighted averages of it over recent windows. Drive it from the book's
+// updates:
+//
+//	ob.OnIncrementalUpdate(func(IncrementalUpdate) { m.Sample(ob) })
+type MidTracker struct {
+	lookback time.Duration
+	clock    func() time.Time
+	samples  []midSample
+}
+
+// NewMidTracker creates a tracker that keeps enough history to average over
+// windows of up to lookback, timestamped by clock. A nil clock uses
+// time.Now.
+func NewMidTracker(lookback time.Duration, clock func() time.Time) *MidTracker {
+	if clock == nil {
+		clock = time.Now
+	}
+	return &MidTracker{lookback: lookback, clock: clock}
+}
+
+// Sample records the book's current mid price if it has changed.
+func (m *MidTracker) Sample(ob *OrderBook) {
+	mid, ok := ob.Mid()
+	m.Observe(mid, ok)
+}
+
+// Observe records a mid price, or the absence of one when ok is false, at
+// the current time if it differs from the last observation.
+func (m *MidTracker) Observe(mid float32, ok bool) {
+	if n := len(m.samples); n > 0 && m.samples[n-1].ok == ok && (!ok || m.samples[n-1].mid == mid) {
+		return
+	}
+	now := m.clock()
+	m.samples = append(m.samples, midSample{now, mid, ok})
+
+	// Keep the last sample before the lookback, as it holds until the next
+	cutoff := now.Add(-m.lookback)
+	i := 0
+	for i+1 < len(m.samples) && !m.samples[i+1].at.After(cutoff) {
+		i++
+	}
+	m.samples = m.samples[i:]
+}
+
+// TWAMid returns the time-weighted average mid price over the last window,
+// up to the tracker's lookback. Time before the first sample, or while the
+// book had no mid, is left out of the average. ok is false if there was no
+// mid at any point in the window.
+func (m *MidTracker) TWAMid(window time.Duration) (float32, bool) {
+	now := m.clock()
+	start := now.Add(-window)
+	var weighted float64
+	var total time.Duration
+	for i, s := range m.samples {
+		end := now
+		if i+1 < len(m.samples) {
+			end = m.samples[i+1].at
+		}
+		from := s.at
+		if from.Before(start) {
+			from = start
+		}
+		if !s.ok || !end.After(from) {
+			continue
+		}
+		d := end.Sub(from)
+		weighted += float64(s.mid) * d.Seconds()
+		total += d
+	}
+	if total == 0 {
+		return 0, false
+	}
+	return float32(weighted / total.Seconds()), true
+}
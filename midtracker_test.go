@@ -0,0 +1,73 @@
+// Copyright 2024 Lane A. Shetron
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package orderbook
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTWAMid(t *testing.T) {
+	now := time.Date(2024, 1, 1, 9, 30, 0, 0, time.UTC)
+	m := NewMidTracker(time.Minute, func() time.Time { return now })
+	ob := NewOrderBook()
+	ob.OnIncrementalUpdate(func(IncrementalUpdate) { m.Sample(ob) })
+
+	if _, ok := m.TWAMid(time.Minute); ok {
+		t.Errorf("Expected no average without samples")
+	}
+	// Mid 100 for 10s, 101 for 20s, then 104 for 10s
+	ob.Insert(1, BID, 99.0, 1)
+	ob.Insert(2, ASK, 101.0, 1)
+	now = now.Add(10 * time.Second)
+	ob.Insert(3, BID, 101.0, 1) // lifts the ask, briefly leaving no mid
+	ob.Insert(4, ASK, 103.0, 1)
+	now = now.Add(20 * time.Second)
+	ob.Insert(5, BID, 98.0, 1) // no change to the mid
+	ob.Update(4, 109.0, 1)
+	now = now.Add(10 * time.Second)
+
+	cases := []struct {
+		Window   time.Duration
+		Expected float32
+	}{
+		{40 * time.Second, (100*10 + 101*20 + 104*10) / 40.0},
+		{20 * time.Second, (101*10 + 104*10) / 20.0},
+		{5 * time.Second, 104},
+		// Time before the first sample is left out
+		{time.Minute, (100*10 + 101*20 + 104*10) / 40.0},
+	}
+	for _, c := range cases {
+		t.Run(c.Window.String(), func(t *testing.T) {
+			if twa, ok := m.TWAMid(c.Window); !ok || twa != c.Expected {
+				t.Errorf("Expected %v, got %v", c.Expected, twa)
+			}
+		})
+	}
+}
+
+func TestMidTrackerLookback(t *testing.T) {
+	now := time.Date(2024, 1, 1, 9, 30, 0, 0, time.UTC)
+	m := NewMidTracker(10*time.Second, func() time.Time { return now })
+	for i := 0; i < 100; i++ {
+		m.Observe(float32(i), true)
+		now = now.Add(time.Second)
+	}
+	if len(m.samples) > 11 {
+		t.Errorf("Expected samples beyond the lookback to be dropped, got %d", len(m.samples))
+	}
+	if twa, _ := m.TWAMid(2 * time.Second); twa != 98.5 {
+		t.Errorf("Expected 98.5, got %v", twa)
+	}
+}
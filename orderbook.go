@@ -2,8 +2,10 @@ package orderbook
 
 import (
 	"container/heap"
-	"container/list"
 	"errors"
+	"fmt"
+	"math"
+	"time"
 )
 
 // Helpers
@@ -33,59 +35,164 @@ type Book interface {
 	Push(*Order) error
 	Pop() *Order
 	PopLevel() *Node
-	Get(int) (*list.Element, bool)
-	GetLevel(float32) (*Node, bool)
+	Get(int) (Handle, bool)
+	GetLevel(Price) (*Node, bool)
 	Remove(int) error
-	RemoveLevel(float32)
+	RemoveLevel(Price) []*Order
+	Reprice(int, Price) error
 	Len() int
 }
 
 type Node struct {
-	Level *list.List
+	Level LevelQueue
 	Item
-	Key   float32
+	Key   Price
 	index int
+
+	// seq orders levels by creation, breaking ties between prices that
+	// compare equal within the book's price tolerance.
+	seq       uint64
+	updateSeq uint64
+	// volume is the total quantity of the orders at the level, kept up to
+	// date as orders are added, removed, filled and resized.
+	volume int
+	// pooled is set on a level taken from the book's pool, until it is
+	// retired to be returned to it.
+	pooled bool
 }
 
 func (n *Node) Peek() *Order {
 	i := n.Level.Front()
 	if i != nil {
-		return i.Value.(*Order)
+		return i.Order()
 	}
 	return nil
 }
 
 // Volume returns the cumulative volume for all orders at a price level.
-// This is O(m) for m orders at the given price level.
+// The total is cached, so this is O(1).
 func (n *Node) Volume() int {
-	e := n.Level.Front()
+	return n.volume
+}
+
+// resize changes the quantity of an order resting at the level.
+func (n *Node) resize(o *Order, quantity int) {
+	n.volume += quantity - o.Quantity
+	o.Quantity = quantity
+}
+
+// VolumeIncluding returns the volume resting at a level. If hidden is
+// false, hidden orders and the undisplayed reserve of iceberg orders are
+// excluded, leaving the volume a public feed would show. This is O(m) for m
+// orders at the level unless hidden is true.
+func (n *Node) VolumeIncluding(hidden bool) int {
+	if hidden {
+		return n.volume
+	}
 	total := 0
-	for e != nil {
-		total += e.Value.(*Order).Quantity
-		e = e.Next()
+	for e := n.Level.Front(); e != nil; e = e.Next() {
+		o := e.Order()
+		if !o.Hidden {
+			total += o.visible()
+		}
 	}
 	return total
 }
 
-func NewNode(price float32) Node {
-	l := list.New()
+// displayed returns the volume a public feed shows at the level, excluding
+// hidden orders and the undisplayed reserve of iceberg orders, and the
+// number of orders that show any. This is O(m) for m orders at the level.
+func (n *Node) displayed() (volume, orders int) {
+	for e := n.Level.Front(); e != nil; e = e.Next() {
+		if o := e.Order(); !o.Hidden && o.visible() > 0 {
+			volume += o.visible()
+			orders++
+		}
+	}
+	return volume, orders
+}
+
+// SizeHistogram returns the number of orders at the level for each distinct
+// remaining quantity, including hidden orders and iceberg reserves. This is
+// O(m) for m orders at the level.
+func (n *Node) SizeHistogram() map[int]int {
+	sizes := make(map[int]int)
+	for e := n.Level.Front(); e != nil; e = e.Next() {
+		sizes[e.Order().Quantity]++
+	}
+	return sizes
+}
+
+// UpdateSeq returns the number of changes made to a price level. It is
+// incremented whenever an order is added to, removed from, or filled or
+// resized at the level, so feed consumers can detect missed updates per
+// price.
+func (n *Node) UpdateSeq() uint64 {
+	return n.updateSeq
+}
+
+func NewNode(price Price) Node {
 	return Node{
-		Level: l,
+		Level: NewListQueue(),
 		Key:   price,
 	}
 }
 
 type Order struct {
-	Price    float32
+	Price    Price
 	Quantity int
 	OrderId  int
+	// Filled is the cumulative quantity executed against the order.
+	Filled int
+	// Hidden orders match as normal but are not displayed.
+	Hidden bool
+	// DisplayQuantity makes the order an iceberg that only displays, and
+	// can only be matched for, up to this much of its quantity at a time.
+	// Each time the displayed slice fills, it is replenished from the
+	// reserve and the order moves to the back of its level. Zero displays
+	// the whole quantity.
+	DisplayQuantity int
+	// OwnerId identifies the account that placed the order. Zero means
+	// the order is not attributed to an account.
+	OwnerId int
+	// TimeInForce determines what happens to any quantity left unfilled
+	// after the order has matched.
+	TimeInForce TimeInForce
+	// Timestamp is when the order was first placed on the book, according
+	// to the book's clock. It is zero if no clock is set.
+	Timestamp time.Time
+
+	// shown is what is left of the displayed slice of an iceberg order.
+	shown int
+	// pooled is set on an order the book allocated from its pool, until it
+	// is retired to be returned to it.
+	pooled bool
+}
+
+// visible returns the quantity of a resting order that can be matched before
+// it must be replenished: the displayed slice of an iceberg order, or the
+// whole quantity of any other order.
+func (o *Order) visible() int {
+	if o.DisplayQuantity > 0 {
+		return min(o.shown, o.Quantity)
+	}
+	return o.Quantity
 }
 
 func (o *Order) Peek() *Order {
 	return o
 }
 
-func NewOrder(orderId int, price float32, quantity int) *Order {
+// Age returns how long the order has been on the book as of now, or zero if
+// it has no Timestamp.
+func (o *Order) Age(now time.Time) time.Duration {
+	if o.Timestamp.IsZero() {
+		return 0
+	}
+	return now.Sub(o.Timestamp)
+}
+
+func NewOrder(orderId int, price Price, quantity int) *Order {
 	return &Order{
 		Price:    price,
 		Quantity: quantity,
@@ -96,12 +203,14 @@ func NewOrder(orderId int, price float32, quantity int) *Order {
 type BaseHeap []*Node
 type AskOrders struct {
 	BaseHeap
+	tolerance Price
 }
 type BidOrders struct {
 	BaseHeap
+	tolerance Price
 }
-type OrdersMap map[int]*list.Element
-type LevelsMap map[float32]*Node
+type OrdersMap map[int]Handle
+type LevelsMap map[Price]*Node
 
 func (ob AskOrders) Less(i, j int) bool {
 	left := ob.BaseHeap[i].Peek()
@@ -113,7 +222,11 @@ func (ob AskOrders) Less(i, j int) bool {
 	} else if left == nil && right != nil {
 		return false
 	}
-	return left.Price < right.Price
+	if d := left.Price - right.Price; d < -ob.tolerance || d > ob.tolerance {
+		return left.Price < right.Price
+	}
+	// Prices within tolerance are considered equal, so the older level wins
+	return ob.BaseHeap[i].seq < ob.BaseHeap[j].seq
 }
 
 func (ob BidOrders) Less(i, j int) bool {
@@ -126,7 +239,11 @@ func (ob BidOrders) Less(i, j int) bool {
 	} else if left == nil && right != nil {
 		return false
 	}
-	return left.Price > right.Price
+	if d := left.Price - right.Price; d < -ob.tolerance || d > ob.tolerance {
+		return left.Price > right.Price
+	}
+	// Prices within tolerance are considered equal, so the older level wins
+	return ob.BaseHeap[i].seq < ob.BaseHeap[j].seq
 }
 
 func (h BaseHeap) Len() int { return len(h) }
@@ -152,6 +269,18 @@ type BidBook struct {
 	Orders BidOrders
 	OrdersMap
 	LevelsMap
+
+	loading  bool
+	levelSeq uint64
+	newQueue func() LevelQueue
+	// maxLevels caps the number of levels, if positive, and evicted holds
+	// the orders removed to enforce it until the OrderBook collects them.
+	maxLevels int
+	evicted   []*Order
+	owners    ownerIndex
+	// pool is the OrderBook's, which supplies new levels with the default
+	// queue and takes back the levels removed.
+	pool *pool
 }
 
 func (bb *BidBook) Side() Side {
@@ -182,22 +311,38 @@ func (bb *BidBook) Push(o *Order) error {
 
 	if _n, ok := bb.LevelsMap[o.Price]; ok {
 		e := _n.Level.PushBack(o)
+		_n.volume += o.Quantity
+		_n.updateSeq++
 		bb.OrdersMap[o.OrderId] = e
+		bb.owners.add(o)
 		return nil
 	}
 
 	// Create a new Node if the price level does not yet exist
-	n := NewNode(o.Price)
+	n := bb.pool.node(o.Price, bb.newQueue)
 	e := n.Level.PushBack(o)
+	n.volume += o.Quantity
+	n.updateSeq++
+	n.seq = bb.levelSeq
+	bb.levelSeq++
 
 	// Since most insertions in an order book tend to be at the top
 	// of the heap (close to the max bid or min ask), we could further
 	// improve performance by prepending the slice and calling push-down
 	// instead of appending. An implementation of this does not exist
 	// in the stdlib, so we would need to reimplement heap.Push ourselves.
-	heap.Push(&bb.Orders, &n)
+	// While loading, the heap is left unordered and built once by EndLoad.
+	if bb.loading {
+		bb.Orders.BaseHeap.Push(n)
+	} else {
+		heap.Push(&bb.Orders, n)
+	}
 	bb.OrdersMap[o.OrderId] = e
-	bb.LevelsMap[o.Price] = &n
+	bb.LevelsMap[o.Price] = n
+	bb.owners.add(o)
+	if bb.maxLevels > 0 && !bb.loading && bb.Len() > bb.maxLevels {
+		bb.evictWorst()
+	}
 	return nil
 }
 
@@ -216,12 +361,15 @@ func (bb *BidBook) PopLevel() *Node {
 	if bb.Len() > 0 {
 		n := heap.Pop(&bb.Orders).(*Node)
 		delete(bb.LevelsMap, n.Key)
+		for e := n.Level.Front(); e != nil; e = e.Next() {
+			bb.owners.remove(e.Order())
+		}
 		return n
 	}
 	return nil
 }
 
-func (bb *BidBook) Get(key int) (*list.Element, bool) {
+func (bb *BidBook) Get(key int) (Handle, bool) {
 	n, ok := bb.OrdersMap[key]
 	return n, ok
 }
@@ -232,36 +380,130 @@ func (bb *BidBook) Get(key int) (*list.Element, bool) {
 // (but still amortized O(1)).
 func (bb *BidBook) Remove(key int) error {
 	if e, ok := bb.Get(key); ok {
-		if n, ok := bb.GetLevel(e.Value.(*Order).Price); ok {
-			val := n.Level.Remove(e).(*Order)
-			delete(bb.OrdersMap, val.OrderId)
-
-			if n.Level.Len() == 0 {
-				bb.RemoveLevel(val.Price)
-			}
-		}
+		bb.remove(e)
 		return nil
 	}
 
 	return errors.New("Order does not exist")
 }
 
-func (bb *BidBook) GetLevel(price float32) (*Node, bool) {
+// remove deletes the order at e, which the caller has already looked up.
+func (bb *BidBook) remove(e Handle) {
+	o := e.Order()
+	if n, ok := bb.GetLevel(o.Price); ok {
+		n.Level.Remove(e)
+		n.volume -= o.Quantity
+		n.updateSeq++
+		delete(bb.OrdersMap, o.OrderId)
+		bb.owners.remove(o)
+
+		if n.Level.Len() == 0 {
+			heap.Remove(&bb.Orders, n.index)
+			delete(bb.LevelsMap, o.Price)
+			bb.pool.retireNode(n)
+		}
+	}
+}
+
+// Reprice moves an order to a new price, queued behind any orders already
+// resting there. If the order is alone at its level and there is no level at
+// the new price, the level is re-keyed in place and fixed in the heap rather
+// than removed and recreated.
+func (bb *BidBook) Reprice(key int, price Price) error {
+	e, ok := bb.Get(key)
+	if !ok {
+		return errors.New("Order does not exist")
+	}
+	o := e.Order()
+	if n, ok := bb.GetLevel(o.Price); ok && n.Level.Len() == 1 {
+		if _, ok := bb.GetLevel(price); !ok {
+			delete(bb.LevelsMap, o.Price)
+			o.Price = price
+			n.Key = price
+			n.updateSeq++
+			bb.LevelsMap[price] = n
+			if !bb.loading {
+				heap.Fix(&bb.Orders, n.index)
+			}
+			return nil
+		}
+	}
+	bb.Remove(key)
+	o.Price = price
+	return bb.Push(o)
+}
+
+func (bb *BidBook) GetLevel(price Price) (*Node, bool) {
 	n, ok := bb.LevelsMap[price]
 	return n, ok
 }
 
-func (bb *BidBook) RemoveLevel(price float32) {
-	if n, ok := bb.GetLevel(price); ok {
-		heap.Remove(&bb.Orders, n.index)
-		delete(bb.LevelsMap, price)
+// RemoveLevel deletes a whole price level and every order resting at it,
+// returning the removed orders in time priority, or nil if there is no such
+// level. The level itself goes back to the book's pool.
+func (bb *BidBook) RemoveLevel(price Price) []*Order {
+	n, ok := bb.GetLevel(price)
+	if !ok {
+		return nil
+	}
+	orders := make([]*Order, 0, n.Level.Len())
+	for e := n.Level.Front(); e != nil; e = e.Next() {
+		o := e.Order()
+		orders = append(orders, o)
+		delete(bb.OrdersMap, o.OrderId)
+		bb.owners.remove(o)
 	}
+	heap.Remove(&bb.Orders, n.index)
+	delete(bb.LevelsMap, price)
+	bb.pool.retireNode(n)
+	return orders
+}
+
+// clear removes every level and order, keeping the storage of the heap and
+// maps for reuse.
+func (bb *BidBook) clear() {
+	for i := range bb.Orders.BaseHeap {
+		bb.Orders.BaseHeap[i] = nil
+	}
+	bb.Orders.BaseHeap = bb.Orders.BaseHeap[:0]
+	for k := range bb.OrdersMap {
+		delete(bb.OrdersMap, k)
+	}
+	for k := range bb.LevelsMap {
+		delete(bb.LevelsMap, k)
+	}
+	bb.owners = nil
+	bb.evicted = nil
+}
+
+// evictWorst removes the worst priced level, which may be anywhere among the
+// leaves of the heap, and holds its orders in evicted.
+func (bb *BidBook) evictWorst() {
+	w := 0
+	for i := bb.Len() / 2; i < bb.Len(); i++ {
+		if bb.Orders.Less(w, i) {
+			w = i
+		}
+	}
+	bb.evicted = append(bb.evicted, bb.RemoveLevel(bb.Orders.BaseHeap[w].Key)...)
 }
 
 type AskBook struct {
 	Orders AskOrders
 	OrdersMap
 	LevelsMap
+
+	loading  bool
+	levelSeq uint64
+	newQueue func() LevelQueue
+	// maxLevels caps the number of levels, if positive, and evicted holds
+	// the orders removed to enforce it until the OrderBook collects them.
+	maxLevels int
+	evicted   []*Order
+	owners    ownerIndex
+	// pool is the OrderBook's, which supplies new levels with the default
+	// queue and takes back the levels removed.
+	pool *pool
 }
 
 func (ab *AskBook) Side() Side {
@@ -292,18 +534,33 @@ func (ab *AskBook) Push(o *Order) error {
 
 	if _n, ok := ab.LevelsMap[o.Price]; ok {
 		e := _n.Level.PushBack(o)
+		_n.volume += o.Quantity
+		_n.updateSeq++
 		ab.OrdersMap[o.OrderId] = e
+		ab.owners.add(o)
 		return nil
 	}
 
 	// Create a new Node if the price level does not yet exist
-	n := NewNode(o.Price)
+	n := ab.pool.node(o.Price, ab.newQueue)
 	e := n.Level.PushBack(o)
+	n.volume += o.Quantity
+	n.updateSeq++
+	n.seq = ab.levelSeq
+	ab.levelSeq++
 
 	// See the note on BidBook above
-	heap.Push(&ab.Orders, &n)
+	if ab.loading {
+		ab.Orders.BaseHeap.Push(n)
+	} else {
+		heap.Push(&ab.Orders, n)
+	}
 	ab.OrdersMap[o.OrderId] = e
-	ab.LevelsMap[o.Price] = &n
+	ab.LevelsMap[o.Price] = n
+	ab.owners.add(o)
+	if ab.maxLevels > 0 && !ab.loading && ab.Len() > ab.maxLevels {
+		ab.evictWorst()
+	}
 	return nil
 }
 
@@ -322,12 +579,15 @@ func (ab *AskBook) PopLevel() *Node {
 	if ab.Len() > 0 {
 		n := heap.Pop(&ab.Orders).(*Node)
 		delete(ab.LevelsMap, n.Key)
+		for e := n.Level.Front(); e != nil; e = e.Next() {
+			ab.owners.remove(e.Order())
+		}
 		return n
 	}
 	return nil
 }
 
-func (ab *AskBook) Get(key int) (*list.Element, bool) {
+func (ab *AskBook) Get(key int) (Handle, bool) {
 	n, ok := ab.OrdersMap[key]
 	return n, ok
 }
@@ -338,44 +598,198 @@ func (ab *AskBook) Get(key int) (*list.Element, bool) {
 // (but still amortized O(1)).
 func (ab *AskBook) Remove(key int) error {
 	if e, ok := ab.Get(key); ok {
-		if n, ok := ab.GetLevel(e.Value.(*Order).Price); ok {
-			val := n.Level.Remove(e).(*Order)
-			delete(ab.OrdersMap, val.OrderId)
-
-			if n.Level.Len() == 0 {
-				ab.RemoveLevel(val.Price)
-			}
-		}
+		ab.remove(e)
 		return nil
 	}
 
 	return errors.New("Order does not exist")
 }
 
-func (ab *AskBook) GetLevel(price float32) (*Node, bool) {
+// remove deletes the order at e, which the caller has already looked up.
+func (ab *AskBook) remove(e Handle) {
+	o := e.Order()
+	if n, ok := ab.GetLevel(o.Price); ok {
+		n.Level.Remove(e)
+		n.volume -= o.Quantity
+		n.updateSeq++
+		delete(ab.OrdersMap, o.OrderId)
+		ab.owners.remove(o)
+
+		if n.Level.Len() == 0 {
+			heap.Remove(&ab.Orders, n.index)
+			delete(ab.LevelsMap, o.Price)
+			ab.pool.retireNode(n)
+		}
+	}
+}
+
+// Reprice moves an order to a new price, queued behind any orders already
+// resting there. If the order is alone at its level and there is no level at
+// the new price, the level is re-keyed in place and fixed in the heap rather
+// than removed and recreated.
+func (ab *AskBook) Reprice(key int, price Price) error {
+	e, ok := ab.Get(key)
+	if !ok {
+		return errors.New("Order does not exist")
+	}
+	o := e.Order()
+	if n, ok := ab.GetLevel(o.Price); ok && n.Level.Len() == 1 {
+		if _, ok := ab.GetLevel(price); !ok {
+			delete(ab.LevelsMap, o.Price)
+			o.Price = price
+			n.Key = price
+			n.updateSeq++
+			ab.LevelsMap[price] = n
+			if !ab.loading {
+				heap.Fix(&ab.Orders, n.index)
+			}
+			return nil
+		}
+	}
+	ab.Remove(key)
+	o.Price = price
+	return ab.Push(o)
+}
+
+func (ab *AskBook) GetLevel(price Price) (*Node, bool) {
 	n, ok := ab.LevelsMap[price]
 	return n, ok
 }
 
-func (ab *AskBook) RemoveLevel(price float32) {
-	if n, ok := ab.GetLevel(price); ok {
-		heap.Remove(&ab.Orders, n.index)
-		delete(ab.LevelsMap, price)
+// RemoveLevel deletes a whole price level and every order resting at it,
+// returning the removed orders in time priority, or nil if there is no such
+// level. The level itself goes back to the book's pool.
+func (ab *AskBook) RemoveLevel(price Price) []*Order {
+	n, ok := ab.GetLevel(price)
+	if !ok {
+		return nil
+	}
+	orders := make([]*Order, 0, n.Level.Len())
+	for e := n.Level.Front(); e != nil; e = e.Next() {
+		o := e.Order()
+		orders = append(orders, o)
+		delete(ab.OrdersMap, o.OrderId)
+		ab.owners.remove(o)
+	}
+	heap.Remove(&ab.Orders, n.index)
+	delete(ab.LevelsMap, price)
+	ab.pool.retireNode(n)
+	return orders
+}
+
+// clear removes every level and order, keeping the storage of the heap and
+// maps for reuse.
+func (ab *AskBook) clear() {
+	for i := range ab.Orders.BaseHeap {
+		ab.Orders.BaseHeap[i] = nil
+	}
+	ab.Orders.BaseHeap = ab.Orders.BaseHeap[:0]
+	for k := range ab.OrdersMap {
+		delete(ab.OrdersMap, k)
 	}
+	for k := range ab.LevelsMap {
+		delete(ab.LevelsMap, k)
+	}
+	ab.owners = nil
+	ab.evicted = nil
+}
+
+// evictWorst removes the worst priced level, which may be anywhere among the
+// leaves of the heap, and holds its orders in evicted.
+func (ab *AskBook) evictWorst() {
+	w := 0
+	for i := ab.Len() / 2; i < ab.Len(); i++ {
+		if ab.Orders.Less(w, i) {
+			w = i
+		}
+	}
+	ab.evicted = append(ab.evicted, ab.RemoveLevel(ab.Orders.BaseHeap[w].Key)...)
 }
 
 type OrderBook struct {
 	AskBook
 	BidBook
+
+	maxOrderQuantity int
+	minQuantity      int
+	lotSize          int
+	matchingMode     MatchingMode
+	rounding         RoundingPolicy
+	quoteMode        QuoteMode
+	maxSweepDistance float32
+	negativePrices   bool
+	clock            func() time.Time
+	onSelfMatch      func(orderId int)
+	displayScale     float64
+	rejectSelfCross  bool
+	conditionals     []conditional
+	triggering       bool
+	stops            []stopOrder
+	stopPrices       []Price
+	stopping         bool
+	trailing         []trailingStop
+	trailingCheck    bool
+	tick             float64
+	tickPolicy       TickPolicy
+	stpMode          STPMode
+	takerCanceled    bool
+	selfMatched      bool
+	stream           *tradeStream
+	hiddenPriority   HiddenPriority
+	minResidual      int
+	residualPolicy   ResidualPolicy
+	onStateChange    func(orderId int, old, new OrderState)
+	onUpdate         func(IncrementalUpdate)
+	onTrade          func(Trade)
+	onAdd            func(OrderView)
+	onCancel         func(orderId int)
+	onFill           func(orderId int, price float32, quantity int, remaining int)
+	events           []func()
+	makerVolume      map[int]int
+	sequence         uint64
+	lastApplied      uint64
+	touched          []levelKey
+	loading          bool
+	lastAutoId       int
+	paused           bool
+	pending          []int
+	resuming         bool
+	held             map[int]bool
+	pool             *pool
 }
 
 func (ob *OrderBook) Init() {
+	ob.pool = newPool()
+	ob.AskBook.pool = ob.pool
+	ob.BidBook.pool = ob.pool
 	heap.Init(&ob.AskBook.Orders)
 	heap.Init(&ob.BidBook.Orders)
 	ob.AskBook.OrdersMap = make(OrdersMap)
 	ob.BidBook.OrdersMap = make(OrdersMap)
 	ob.AskBook.LevelsMap = make(LevelsMap)
 	ob.BidBook.LevelsMap = make(LevelsMap)
+	ob.makerVolume = make(map[int]int)
+}
+
+// Clear empties the book as a fresh Init would, removing every resting
+// order along with any conditional, stop and trailing stop orders, and
+// resetting maker volumes, but reuses the existing heaps and maps rather
+// than allocating new ones. Configuration, callbacks and sequence numbers
+// are kept, so auto-assigned ids and update sequences carry on. No events or
+// updates are emitted.
+func (ob *OrderBook) Clear() {
+	ob.AskBook.clear()
+	ob.BidBook.clear()
+	for k := range ob.makerVolume {
+		delete(ob.makerVolume, k)
+	}
+	ob.conditionals = nil
+	ob.stops = nil
+	ob.stopPrices = nil
+	ob.trailing = nil
+	ob.pending = nil
+	ob.touched = ob.touched[:0]
+	ob.events = nil
 }
 
 func NewOrderBook() *OrderBook {
@@ -384,6 +798,221 @@ func NewOrderBook() *OrderBook {
 	return &ob
 }
 
+// SetMaxOrderQuantity caps the quantity of any single order accepted by
+// Insert or Update. A value of zero (the default) disables the check.
+func (ob *OrderBook) SetMaxOrderQuantity(n int) {
+	ob.maxOrderQuantity = n
+}
+
+// SetLotSize sets the smallest quantity accepted by Insert or Update, and
+// the step in which larger quantities must increase from it: an order for
+// volume is accepted only if volume >= min and (volume-min) % step == 0.
+// Quantities left by partial fills are not checked. Zero (the default)
+// disables either check.
+func (ob *OrderBook) SetLotSize(min, step int) {
+	ob.minQuantity = min
+	ob.lotSize = step
+}
+
+// SetMaxLevels caps the number of price levels kept on side at n. When a new
+// level would exceed the cap, the worst priced level on that side, which may
+// be the new one, is removed along with every order resting at it, and those
+// orders are cancelled. Levels already beyond the cap are removed straight
+// away. The cap is not enforced while bulk loading. A value of zero (the
+// default) disables the cap.
+func (ob *OrderBook) SetMaxLevels(side Side, n int) {
+	if side == BID {
+		ob.BidBook.maxLevels = n
+		for n > 0 && ob.BidBook.Len() > n {
+			ob.BidBook.evictWorst()
+		}
+	} else {
+		ob.AskBook.maxLevels = n
+		for n > 0 && ob.AskBook.Len() > n {
+			ob.AskBook.evictWorst()
+		}
+	}
+	if len(ob.BidBook.evicted) > 0 || len(ob.AskBook.evicted) > 0 {
+		ob.publish(nil)
+	}
+}
+
+// cancelEvicted cancels the orders removed to enforce SetMaxLevels.
+func (ob *OrderBook) cancelEvicted() {
+	for _, side := range []Side{BID, ASK} {
+		evicted := &ob.BidBook.evicted
+		if side == ASK {
+			evicted = &ob.AskBook.evicted
+		}
+		for _, o := range *evicted {
+			ob.touch(side, o.Price)
+			ob.transition(o, o.state(), OrderCancelled)
+		}
+		*evicted = nil
+	}
+}
+
+// SetAllowNegativePrices allows orders at zero and negative prices, for
+// instruments such as calendar spreads that can legitimately trade below
+// zero. Prices are ordered and matched the same way across zero, so the
+// best bid is always the highest, i.e. the least negative. By default,
+// orders with a price that is not positive are rejected.
+func (ob *OrderBook) SetAllowNegativePrices(allow bool) {
+	ob.negativePrices = allow
+}
+
+// SetMatchingMode selects how incoming orders are allocated among the
+// resting orders at each price level. The default is FIFO.
+func (ob *OrderBook) SetMatchingMode(mode MatchingMode) {
+	ob.matchingMode = mode
+}
+
+// SetPriceTolerance makes the book treat prices within tolerance of each
+// other as equal, which guards against float noise in prices that should
+// coincide. Levels whose prices are equal within tolerance are ordered by
+// when they were created, and an order crosses any opposite level it is
+// within tolerance of. A tolerance of zero (the default) compares prices
+// exactly.
+func (ob *OrderBook) SetPriceTolerance(tolerance float32) {
+	ob.AskBook.Orders.tolerance = float32Price(tolerance)
+	ob.BidBook.Orders.tolerance = float32Price(tolerance)
+	heap.Init(&ob.AskBook.Orders)
+	heap.Init(&ob.BidBook.Orders)
+}
+
+// crosses reports whether a taker on side at price can trade against a
+// resting order at makerPrice.
+func (ob *OrderBook) crosses(side Side, price Price, makerPrice Price) bool {
+	if side == ASK {
+		return price <= makerPrice+ob.BidBook.Orders.tolerance
+	}
+	return price >= makerPrice-ob.AskBook.Orders.tolerance
+}
+
+// SetClock sets the clock used to timestamp orders as they rest on the book,
+// such as time.Now, which enables Trade.MakerRestTime. A nil clock (the
+// default) disables timestamps.
+func (ob *OrderBook) SetClock(clock func() time.Time) {
+	ob.clock = clock
+}
+
+// SetMaxSweepDistance caps how far an incoming order may sweep the opposite
+// side of the book, as a fraction of the best opposite price when it
+// arrives; for example 0.02 stops a buy from trading more than 2% above the
+// best ask. Levels beyond the cap are left untouched. Any unfilled quantity
+// is handled according to the order's TimeInForce, except that a GTC order
+// whose limit lies beyond the cap rests at the last price it traded at
+// rather than at its limit, so that it does not cross the book. A distance
+// of zero (the default) disables the cap.
+func (ob *OrderBook) SetMaxSweepDistance(fraction float32) {
+	ob.maxSweepDistance = fraction
+}
+
+// SetHiddenPriority selects how hidden orders are prioritized against
+// displayed orders at the same price level. The default is VisibleFirst.
+func (ob *OrderBook) SetHiddenPriority(p HiddenPriority) {
+	ob.hiddenPriority = p
+}
+
+// SetMinResidual sets the smallest quantity a fill may leave resting on a
+// maker order, and how a smaller residual is handled. A minimum of zero (the
+// default) disables the check.
+func (ob *OrderBook) SetMinResidual(qty int, policy ResidualPolicy) {
+	ob.minResidual = qty
+	ob.residualPolicy = policy
+}
+
+// validate checks an order's quantity and any prices that go with it before
+// it reaches the book.
+func (ob *OrderBook) validate(orderId int, volume int, prices ...Price) error {
+	if volume <= 0 {
+		return &RejectError{orderId, RejectInvalidQuantity}
+	}
+	if ob.maxOrderQuantity > 0 && volume > ob.maxOrderQuantity {
+		return &RejectError{orderId, RejectMaxQuantity}
+	}
+	if volume < ob.minQuantity {
+		return &RejectError{orderId, RejectMinQuantity}
+	}
+	if ob.lotSize > 0 && (volume-ob.minQuantity)%ob.lotSize != 0 {
+		return &RejectError{orderId, RejectOffLot}
+	}
+	for _, price := range prices {
+		if !ob.validPrice(price) {
+			return &RejectError{orderId, RejectInvalidPrice}
+		}
+		if ob.tickPolicy == TickReject && !ob.onTick(price) {
+			return &RejectError{orderId, RejectOffTick}
+		}
+		if !ob.tickExact(price) {
+			return &RejectError{orderId, RejectTickPrecision}
+		}
+	}
+	return nil
+}
+
+// validPrice reports whether the book accepts price at all, whatever its
+// tick. A price clamped by PriceFromFloat is too large and never accepted.
+func (ob *OrderBook) validPrice(price Price) bool {
+	return (price > 0 || ob.negativePrices) && price < priceLimit && price > -priceLimit
+}
+
+// checkDuplicate rejects a new order whose id is already resting on side,
+// where Push would refuse to add it, or is held by a MatchContinuation,
+// whose remainder may yet rest. Checking before matching means the order is
+// rejected before it can trade, rather than its unfilled quantity being
+// lost. An id resting on the opposite side is left to matching, which
+// reports it through OnSelfMatch.
+func (ob *OrderBook) checkDuplicate(side Side, orderId int) error {
+	_, book := ob.books(side)
+	if _, ok := book.Get(orderId); ok || ob.held[orderId] {
+		return &RejectError{orderId, RejectDuplicateOrderId}
+	}
+	return nil
+}
+
+// inUse reports whether orderId belongs to an order resting on either side
+// of the book, a remainder held by a MatchContinuation, or a stop, trailing
+// stop or conditional order waiting to be triggered.
+func (ob *OrderBook) inUse(orderId int) bool {
+	if _, ok := ob.AskBook.Get(orderId); ok {
+		return true
+	}
+	if _, ok := ob.BidBook.Get(orderId); ok {
+		return true
+	}
+	if ob.held[orderId] {
+		return true
+	}
+	for _, s := range ob.stops {
+		if s.order.OrderId == orderId {
+			return true
+		}
+	}
+	for _, s := range ob.trailing {
+		if s.order.OrderId == orderId {
+			return true
+		}
+	}
+	for _, c := range ob.conditionals {
+		if c.order.OrderId == orderId {
+			return true
+		}
+	}
+	return false
+}
+
+// nextAutoId returns the first auto id below after that is not in use. It
+// does not reserve the id; callers that place the order record it in
+// lastAutoId.
+func (ob *OrderBook) nextAutoId(after int) int {
+	orderId := after - 1
+	for ob.inUse(orderId) {
+		orderId--
+	}
+	return orderId
+}
+
 type Side uint8
 
 const (
@@ -391,106 +1020,846 @@ const (
 	BID
 )
 
+func (s Side) String() string {
+	if s == ASK {
+		return "ask"
+	}
+	return "bid"
+}
+
+// MatchingMode selects how an incoming order is allocated among the resting
+// orders at a price level.
+type MatchingMode uint8
+
+const (
+	// FIFO fills resting orders strictly in price-time priority.
+	FIFO MatchingMode = iota
+	// ProRataPriority fills the front order of a level in full time
+	// priority, then shares any remaining quantity among the rest of the
+	// level in proportion to their size.
+	ProRataPriority
+	// ProRata shares the quantity taken at each level among all of its
+	// orders in proportion to their size, without regard to time priority.
+	// Rounding is set by SetProRataRounding.
+	ProRata
+)
+
+// HiddenPriority selects how hidden orders are prioritized against displayed
+// orders at the same price level.
+type HiddenPriority uint8
+
+const (
+	// VisibleFirst fills every displayed order at a level before any
+	// hidden order, each group in time priority.
+	VisibleFirst HiddenPriority = iota
+	// TimePriority fills orders at a level strictly by time priority,
+	// regardless of whether they are displayed.
+	TimePriority
+)
+
+// ResidualPolicy selects how a maker order is handled when a fill leaves it
+// with less than the book's minimum residual quantity.
+type ResidualPolicy uint8
+
+const (
+	// LeaveResidual leaves the residual resting as-is.
+	LeaveResidual ResidualPolicy = iota
+	// ConsumeResidual consumes the whole maker order: the residual is
+	// canceled by the book and the order moves to OrderExpired.
+	ConsumeResidual
+)
+
+// TimeInForce selects how long an order remains active.
+type TimeInForce uint8
+
+const (
+	// GTC (good till canceled) rests any unfilled quantity on the book.
+	GTC TimeInForce = iota
+	// IOC (immediate or cancel) cancels any quantity that does not fill
+	// on arrival, moving the order to OrderExpired.
+	IOC
+	// FOK (fill or kill) trades only if its whole quantity can fill on
+	// arrival. Otherwise it moves to OrderExpired without trading, and
+	// the book is left unchanged.
+	FOK
+)
+
 type Trade struct {
-	Price        float32
+	Price        Price
 	Volume       int
 	TakerOrderId int
 	MakerOrderId int
+	// TakerSide is the side of the incoming order, so a BID taker is a
+	// buyer-initiated trade.
+	TakerSide Side
+	// MakerRestTime is how long the maker order had been resting when it
+	// was filled. It is zero if the book has no clock.
+	MakerRestTime time.Duration
 }
 
-func (ob *OrderBook) match(side Side, takerId int, price float32, quantity int) []Trade {
-	trades := []Trade{}
-	var makerBook, takerBook Book
+// fill executes qty between a resting maker order and a taker and returns
+// the resulting trade. The maker is removed from its book once it has been
+// exhausted.
+func (ob *OrderBook) fill(book Book, n *Node, o *Order, taker *Order, qty int) Trade {
+	makerState, takerState := o.state(), taker.state()
+	n.resize(o, o.Quantity-qty)
+	o.Filled += qty
+	taker.Quantity -= qty
+	taker.Filled += qty
+	n.updateSeq++
+	ob.touch(book.Side(), n.Key)
+	if o.OwnerId != 0 {
+		ob.makerVolume[o.OwnerId] += qty
+	}
+	t := Trade{Price: o.Price, Volume: qty, TakerOrderId: taker.OrderId, MakerOrderId: o.OrderId, TakerSide: BID}
+	if book.Side() == BID {
+		t.TakerSide = ASK
+	}
+	if ob.clock != nil && !o.Timestamp.IsZero() {
+		t.MakerRestTime = ob.clock().Sub(o.Timestamp)
+	}
+	ob.emitFill(t, o, taker)
+	if o.Quantity <= 0 {
+		book.Remove(o.OrderId) // calls RemoveLevel when applicable
+	} else if o.DisplayQuantity > 0 {
+		// Replenish an iceberg from its reserve once its displayed slice
+		// is gone, losing time priority
+		if o.shown -= qty; o.shown <= 0 {
+			o.shown = min(o.DisplayQuantity, o.Quantity)
+			if e, ok := book.Get(o.OrderId); ok {
+				n.Level.MoveToBack(e)
+			}
+		}
+	}
+	ob.transition(o, makerState, o.state())
+	ob.transition(taker, takerState, taker.state())
+
+	// Cancel any dust left on the maker rather than leave it at the top of
+	// the book
+	if o.Quantity > 0 && o.Quantity < ob.minResidual && ob.residualPolicy == ConsumeResidual {
+		book.Remove(o.OrderId)
+		ob.transition(o, o.state(), OrderExpired)
+	}
+	return t
+}
+
+// front returns the order at a level with the highest matching priority,
+// passing over any maker with the same id as the taker, or nil if there is
+// none. Under VisibleFirst, that is the oldest displayed order, or the oldest
+// hidden order if the level has no displayed orders.
+func (ob *OrderBook) front(n *Node, taker *Order) *Order {
+	var hidden *Order
+	for e := n.Level.Front(); e != nil; e = e.Next() {
+		o := e.Order()
+		if ob.isSelf(o, taker) {
+			continue
+		}
+		if !o.Hidden || ob.hiddenPriority == TimePriority {
+			return o
+		}
+		if hidden == nil {
+			hidden = o
+		}
+	}
+	return hidden
+}
+
+// isSelf reports whether a maker has the same id as the taker, which should
+// never happen but could if a stale order was left in the book, e.g. during
+// a reprice. Such makers are never matched. Ids are unique on each side, so
+// there is at most one such maker per sweep, and it is reported to
+// OnSelfMatch only the first time it is passed over.
+func (ob *OrderBook) isSelf(maker *Order, taker *Order) bool {
+	if maker.OrderId != taker.OrderId {
+		return false
+	}
+	if ob.onSelfMatch != nil && !ob.selfMatched {
+		ob.onSelfMatch(taker.OrderId)
+	}
+	ob.selfMatched = true
+	return true
+}
+
+// matchFIFO fills up to quantity of the taker against a price level in strict
+// time priority and returns the appended trades.
+func (ob *OrderBook) matchFIFO(trades []Trade, book Book, n *Node, taker *Order, quantity int) []Trade {
+	for quantity > 0 && !ob.takerCanceled {
+		o := ob.front(n, taker)
+		if o == nil {
+			break
+		}
+		if ob.selfTrade(book, o, taker) {
+			continue
+		}
+		qty := max(min(o.visible(), quantity), 0)
+		quantity -= qty
+		trades = ob.record(trades, ob.fill(book, n, o, taker, qty))
+	}
+	return trades
+}
+
+// fillable reports whether the taker would fill in full if it swept the
+// opposite side of the book now, without changing the book. It follows the
+// same limits as sweep and errs on the side of false wherever matching would
+// stop early, e.g. at a level of makers with the taker's own id, or at an
+// order from its own account when self-trade prevention cancels the taker.
+func (ob *OrderBook) fillable(side Side, taker *Order) bool {
+	maker := ASK
 	if side == ASK {
-		makerBook = &ob.BidBook
-		takerBook = &ob.AskBook
-	} else {
-		makerBook = &ob.AskBook
-		takerBook = &ob.BidBook
-	}
-
-	for makerBook.Len() > 0 && ((side == ASK && price <= makerBook.Peek().Price) || (side == BID && price >= makerBook.Peek().Price)) && quantity > 0 {
-		if n, ok := makerBook.GetLevel(makerBook.Peek().Price); ok {
-			for n.Level.Len() > 0 && quantity > 0 {
-				e := n.Level.Front()
-				o := e.Value.(*Order)
-				qty := max(min(o.Quantity, quantity), 0)
-				o.Quantity -= qty
-				quantity -= qty
-				trades = append(trades, Trade{o.Price, qty, takerId, o.OrderId})
-				if o.Quantity <= 0 {
-					makerBook.Remove(o.OrderId) // calls RemoveLevel when applicable
+		maker = BID
+	}
+	remaining := taker.Quantity
+	var ref Price
+	for i, n := range ob.sortedLevels(maker) {
+		if i == 0 {
+			ref = n.Key
+		}
+		if !ob.crosses(side, taker.Price, n.Key) {
+			break
+		}
+		if beyond(ref, n.Key, ob.maxSweepDistance) {
+			break
+		}
+		eligible, sameId := 0, false
+		for e := n.Level.Front(); e != nil; e = e.Next() {
+			o := e.Order()
+			if o.OrderId == taker.OrderId {
+				sameId = true
+				continue
+			}
+			if ob.stpMode != STPNone && o.OwnerId != 0 && o.OwnerId == taker.OwnerId {
+				if ob.stpMode != CancelResting {
+					return false
 				}
+				continue
 			}
+			eligible += o.Quantity
+		}
+		// sweep halts at a level where nothing can match
+		if eligible == 0 && sameId {
+			return false
+		}
+		if remaining -= eligible; remaining <= 0 {
+			return true
 		}
 	}
-	// Create a new limit order for any unfilled quantity
-	if quantity > 0 {
-		takerBook.Push(NewOrder(takerId, price, quantity))
+	return false
+}
+
+// books returns the book an order on side matches against, followed by the
+// book it rests on.
+func (ob *OrderBook) books(side Side) (Book, Book) {
+	if side == ASK {
+		return &ob.BidBook, &ob.AskBook
+	}
+	return &ob.AskBook, &ob.BidBook
+}
+
+// sweepLimits bounds how far a single sweep may go. The zero value places no
+// limits on the sweep.
+type sweepLimits struct {
+	// avgPrice caps the average price of a buy, or floors the average
+	// price of a sell, when hasAvgPrice is set.
+	hasAvgPrice bool
+	avgPrice    Price
+	// maxLevels caps the number of price levels visited when non-zero.
+	maxLevels int
+	// maxDistance caps how far from the initial best opposite price, as a
+	// fraction of that price, the sweep may reach when non-zero. When
+	// hasRef is set, the distance is measured from ref instead.
+	maxDistance float32
+	hasRef      bool
+	ref         Price
+}
+
+// beyond reports whether price is further from ref than the fraction
+// maxDistance of ref allows. A maxDistance of zero allows any distance. The
+// allowed distance is rounded to a whole Price, so that e.g. 2% of 100 is
+// exactly 2.
+func beyond(ref, price Price, maxDistance float32) bool {
+	if maxDistance <= 0 {
+		return false
 	}
+	allowed := PriceFromFloat(ref.Float()*float32Price(maxDistance).Float(), 0)
+	return (price - ref).abs() > allowed.abs()
+}
+
+// sweep fills the taker against the opposite side of the book for as long as
+// the prices cross and the limits allow. halted reports whether the sweep was
+// stopped by a limit while the taker still crossed the book. If self-trade
+// prevention canceled the taker, a streaming insert was stopped, or the
+// taker was blocked by a maker with its own id, takerCanceled is set on
+// return and the taker must not rest.
+func (ob *OrderBook) sweep(side Side, taker *Order, lim sweepLimits) ([]Trade, bool) {
+	trades := []Trade{}
+	ob.takerCanceled = false
+	ob.selfMatched = false
+	makerBook, _ := ob.books(side)
+	filled, levels := 0, 0
+	var notional float64
+	var ref Price
+	if lim.hasRef {
+		ref = lim.ref
+	} else if makerBook.Len() > 0 {
+		ref = makerBook.Peek().Price
+	}
+
+	for makerBook.Len() > 0 && ob.crosses(side, taker.Price, makerBook.Peek().Price) && taker.Quantity > 0 {
+		n, ok := makerBook.GetLevel(makerBook.Peek().Price)
+		if !ok {
+			break
+		}
+		if lim.maxLevels > 0 && levels == lim.maxLevels {
+			return trades, true
+		}
+		if beyond(ref, n.Key, lim.maxDistance) {
+			return trades, true
+		}
+		levels++
+		quantity := taker.Quantity
+		if lim.hasAvgPrice {
+			quantity = min(quantity, avgPriceCapacity(side, lim.avgPrice, n.Key, filled, notional))
+			if quantity <= 0 {
+				return trades, true
+			}
+		}
+
+		before := taker.Quantity
+		switch ob.matchingMode {
+		case ProRataPriority:
+			trades = ob.matchProRata(trades, makerBook, n, taker, quantity, true)
+		case ProRata:
+			trades = ob.matchProRata(trades, makerBook, n, taker, quantity, false)
+		default:
+			trades = ob.matchFIFO(trades, makerBook, n, taker, quantity)
+		}
+		if ob.takerCanceled {
+			return trades, false
+		}
+		// Only a maker with the taker's own id is left at the level.
+		// Nothing behind it can be reached, and the taker would cross it
+		// if it rested, so the taker is canceled
+		if taker.Quantity == before && n.Level.Len() > 0 {
+			ob.takerCanceled = true
+			return trades, false
+		}
+		filled += before - taker.Quantity
+		notional += n.Key.Float() * float64(before-taker.Quantity)
+	}
+	return trades, false
+}
+
+// avgPriceCapacity returns how much can be bought (or sold) at price without
+// the average price of the sweep so far, filled for notional, rising above
+// (or falling below) limit.
+func avgPriceCapacity(side Side, limit Price, price Price, filled int, notional float64) int {
+	if (side == BID && price <= limit) || (side == ASK && price >= limit) {
+		return math.MaxInt
+	}
+	// Solve (notional + q*price) / (filled + q) = limit for q
+	q := (limit.Float()*float64(filled) - notional) / (price.Float() - limit.Float())
+	return int(math.Floor(q))
+}
+
+// match fills the taker against the opposite side of the book for as long as
+// the prices cross, and rests any unfilled quantity on the taker's side.
+func (ob *OrderBook) match(side Side, taker *Order) []Trade {
+	trades := []Trade{}
+
+	// Orders loaded from a snapshot are assumed not to cross, and the
+	// maker heap is not yet ordered, so rest them without matching
+	if ob.loading {
+		if taker.Quantity > 0 {
+			ob.rest(side, taker)
+		}
+		return trades
+	}
+
+	// While paused, orders queue without matching until Resume. IOC and
+	// FOK orders must never rest, so they expire
+	if ob.paused {
+		if taker.TimeInForce == IOC || taker.TimeInForce == FOK {
+			ob.transition(taker, taker.state(), OrderExpired)
+			return trades
+		}
+		if taker.Quantity > 0 {
+			ob.pending = append(ob.pending, taker.OrderId)
+			ob.rest(side, taker)
+		}
+		return trades
+	}
+
+	if taker.TimeInForce == FOK && !ob.fillable(side, taker) {
+		ob.transition(taker, taker.state(), OrderExpired)
+		return trades
+	}
+
+	trades, halted := ob.sweep(side, taker, sweepLimits{maxDistance: ob.maxSweepDistance})
+	if taker.Quantity <= 0 {
+		return trades
+	}
+	if ob.takerCanceled {
+		ob.transition(taker, taker.state(), OrderCancelled)
+		return trades
+	}
+	if taker.TimeInForce == IOC || taker.TimeInForce == FOK {
+		ob.transition(taker, taker.state(), OrderExpired)
+		return trades
+	}
+	// An order stopped by the sweep distance would cross the book at its
+	// own limit, so it rests at the furthest price it reached instead
+	if halted && len(trades) > 0 {
+		taker.Price = trades[len(trades)-1].Price
+	}
+	// Rest any unfilled quantity as a limit order
+	ob.rest(side, taker)
 	return trades
 }
 
+// rest places an unfilled order on its side of the book. An order queued
+// while paused was already reported to OnAdd, so it is not reported again
+// when Resume rests it.
+func (ob *OrderBook) rest(side Side, o *Order) {
+	_, book := ob.books(side)
+	if ob.clock != nil && o.Timestamp.IsZero() {
+		o.Timestamp = ob.clock()
+	}
+	if o.DisplayQuantity > 0 {
+		o.shown = min(o.DisplayQuantity, o.Quantity)
+	}
+	book.Push(o)
+	ob.touch(side, o.Price)
+	if fn := ob.onAdd; fn != nil && !ob.resuming {
+		v := view(side, o)
+		ob.events = append(ob.events, func() { fn(v) })
+	}
+}
+
 // Insert inserts a new bid or ask and returns any resulting trades: it first
 // checks for any price matches on the opposite side of the book, and creates
 // a new limit order for any unfilled quantity. New limit orders are queued
 // behind any existing orders at the same price level.
-func (ob *OrderBook) Insert(orderId int, side Side, price float32, volume int) []Trade {
-	return ob.match(side, orderId, price, volume)
+// A RejectError is returned if the order fails validation, including when an
+// order with the same id is already resting on the same side.
+func (ob *OrderBook) Insert(orderId int, side Side, price float32, volume int) ([]Trade, error) {
+	return ob.insertOrder(side, ob.pool.order(orderId, float32Price(price), volume))
+}
+
+// InsertOrder inserts a new order on side exactly as Insert does, but takes a
+// fully specified Order so that optional attributes such as Hidden can be
+// set. The book takes ownership of o, but never recycles it.
+func (ob *OrderBook) InsertOrder(side Side, o *Order) ([]Trade, error) {
+	o.pooled = false
+	return ob.insertOrder(side, o)
+}
+
+// insertOrder is InsertOrder for an order that may have been taken from the
+// book's pool, such as a triggered stop order.
+func (ob *OrderBook) insertOrder(side Side, o *Order) ([]Trade, error) {
+	if err := ob.admit(side, o); err != nil {
+		return nil, err
+	}
+	trades := ob.match(side, o)
+	ob.publish(trades)
+	return trades, nil
+}
+
+// admit runs the checks a new order must pass before it is matched, and
+// snaps its price to the tick. The book is not changed.
+func (ob *OrderBook) admit(side Side, o *Order) error {
+	if err := ob.validate(o.OrderId, o.Quantity, o.Price); err != nil {
+		return err
+	}
+	if err := ob.checkDuplicate(side, o.OrderId); err != nil {
+		return err
+	}
+	if ob.paused && (o.TimeInForce == IOC || o.TimeInForce == FOK) {
+		return &RejectError{o.OrderId, RejectPaused}
+	}
+	o.Price = ob.snap(o.Price)
+	if ob.rejectSelfCross && ob.selfCrosses(side, o) {
+		return &RejectError{o.OrderId, RejectSelfCross}
+	}
+	return nil
+}
+
+// InsertPostOnly inserts a new bid or ask that may only add liquidity. If it
+// would trade on arrival against the best price on the opposite side, it is
+// rejected with RejectWouldCross and the book is left unchanged; otherwise it
+// rests exactly as Insert would, so no trades are ever returned.
+func (ob *OrderBook) InsertPostOnly(orderId int, side Side, price float32, volume int) ([]Trade, error) {
+	if err := ob.validate(orderId, volume, float32Price(price)); err != nil {
+		return nil, err
+	}
+	makerBook, _ := ob.books(side)
+	if maker := makerBook.Peek(); maker != nil && ob.crosses(side, ob.price(price), maker.Price) {
+		return nil, &RejectError{orderId, RejectWouldCross}
+	}
+	return ob.Insert(orderId, side, price, volume)
+}
+
+// InsertAuto inserts a new bid or ask exactly as Insert does, but has the
+// book assign the order id, which it returns along with any trades.
+//
+// Auto-assigned ids are negative and strictly decreasing (-1, -2, ...), so
+// they never collide with ids supplied by callers as long as those are
+// non-negative. A negative id supplied by a caller is skipped over by the
+// allocator while it is resting or pending, so it is never assigned twice.
+func (ob *OrderBook) InsertAuto(side Side, price float32, volume int) (int, []Trade, error) {
+	orderId := ob.nextAutoId(ob.lastAutoId)
+	trades, err := ob.Insert(orderId, side, price, volume)
+	if err != nil {
+		return 0, nil, err
+	}
+	ob.lastAutoId = orderId
+	return orderId, trades, nil
+}
+
+// InsertMaxAvgPrice inserts a new bid or ask like Insert, but stops sweeping
+// the opposite side of the book before the average price of its executions
+// would rise above maxAvgPrice (for a bid) or fall below it (for an ask).
+// The cap may cut a fill at a price level short. If the sweep is stopped by
+// the cap, the unfilled quantity is canceled rather than rested, since it
+// would otherwise rest crossing the book; if it ends because the order's
+// limit price was reached, the unfilled quantity rests as with Insert.
+func (ob *OrderBook) InsertMaxAvgPrice(orderId int, side Side, price float32, volume int, maxAvgPrice float32) ([]Trade, error) {
+	if err := ob.validate(orderId, volume, float32Price(price)); err != nil {
+		return nil, err
+	}
+	// The average price cap need not be on a tick
+	if !ob.validPrice(float32Price(maxAvgPrice)) {
+		return nil, &RejectError{orderId, RejectInvalidPrice}
+	}
+	if err := ob.checkDuplicate(side, orderId); err != nil {
+		return nil, err
+	}
+	taker := ob.pool.order(orderId, ob.price(price), volume)
+	if ob.loading || ob.paused {
+		trades := ob.match(side, taker)
+		ob.publish(trades)
+		return trades, nil
+	}
+
+	trades, halted := ob.sweep(side, taker, sweepLimits{hasAvgPrice: true, avgPrice: float32Price(maxAvgPrice)})
+	if ob.takerCanceled {
+		ob.transition(taker, taker.state(), OrderCancelled)
+	} else if halted {
+		ob.transition(taker, taker.state(), OrderExpired)
+	} else if taker.Quantity > 0 {
+		ob.rest(side, taker)
+	}
+	ob.publish(trades)
+	return trades, nil
 }
 
 // Update modifies an existing limit order and returns any resulting trades.
 // If the price has changed, it re-checks for any matches on the opposite side
-// of the book. Any modifications, with the exception of solely decreasing the
-// quantity, will reset the order's position to the back of the time queue.
+// of the book. The order keeps its place in the time queue only if the price
+// is unchanged and the quantity is decreased; resubmitting the same quantity
+// counts as a refresh and loses priority:
+//
+//	same price, quantity down:           keeps its position
+//	same price, quantity up or the same: moves to the back of its level
+//	new price, any quantity:             matches if it crosses, then joins
+//	                                     the back of the new level
+//
+// Prices are compared after snapping to the book's tick size, so a change
+// smaller than half a tick leaves the price unchanged. A volume of zero
+// cancels the order; a negative volume or a price that is not positive is
+// rejected with a RejectError.
 func (ob *OrderBook) Update(orderId int, price float32, volume int) ([]Trade, error) {
 	var trades []Trade
-	update := func(book Book, e *list.Element) {
-		o := e.Value.(*Order)
+	// A volume of zero cancels the order, so there is nothing to validate
+	if volume != 0 {
+		if err := ob.validate(orderId, volume, float32Price(price)); err != nil {
+			return trades, err
+		}
+	}
+	newPrice := ob.price(price)
+	update := func(book Book, e Handle) error {
+		o := e.Order()
+		ob.touch(book.Side(), o.Price)
 		if volume <= 0 {
 			book.Remove(o.OrderId)
-			return
+			ob.transition(o, o.state(), OrderCancelled)
+			return nil
 		}
-		if price != o.Price {
-			o.Quantity = volume
-			// TODO A small optimization is possible here by calling
-			// heap.Fix instead of removing when the order being updated is
-			// the only order at its price level.
+		if newPrice != o.Price {
+			// If the new price does not cross, there is nothing to match,
+			// so move the order directly
+			makerBook, _ := ob.books(book.Side())
+			if !ob.paused && (makerBook.Len() == 0 || !ob.crosses(book.Side(), newPrice, makerBook.Peek().Price)) {
+				if l, ok := book.GetLevel(o.Price); ok {
+					l.resize(o, volume)
+				}
+				// Like a new order, it shows a full slice at its new price
+				if o.DisplayQuantity > 0 {
+					o.shown = min(o.DisplayQuantity, o.Quantity)
+				}
+				book.Reprice(o.OrderId, newPrice)
+				ob.touch(book.Side(), newPrice)
+				return nil
+			}
 
 			book.Remove(o.OrderId)
-			// check for matches and insert any remaining quantity
-			trades = ob.match(book.Side(), o.OrderId, price, volume)
-		} else if volume < o.Quantity {
+			o.Price = newPrice
 			o.Quantity = volume
-			return
-		} else {
-			o.Quantity = volume
-			if l, ok := book.GetLevel(o.Price); ok {
-				l.Level.MoveToBack(e)
-			}
+			// check for matches and insert any remaining quantity
+			trades = ob.match(book.Side(), o)
+			return nil
+		}
+
+		l, ok := book.GetLevel(o.Price)
+		if !ok {
+			return fmt.Errorf("Order %d has no price level at %v", o.OrderId, o.Price)
+		}
+		requeue := volume >= o.Quantity
+		l.resize(o, volume)
+		l.updateSeq++
+		if !requeue {
+			return nil
+		}
+		// Look the order up again rather than trusting e across the resize,
+		// and leave it alone if it is already last, e.g. alone at its level
+		if e, ok = book.Get(o.OrderId); !ok || e.Order() != o {
+			return fmt.Errorf("Order %d was lost from its price level", o.OrderId)
+		}
+		if back := l.Level.Back(); back == nil || back.Order() != o {
+			l.Level.MoveToBack(e)
 		}
+		return nil
 	}
 
 	if e, ok := ob.AskBook.Get(orderId); ok {
-		update(&ob.AskBook, e)
-		return trades, nil
+		err := update(&ob.AskBook, e)
+		ob.publish(trades)
+		return trades, err
 	}
 	if e, ok := ob.BidBook.Get(orderId); ok {
-		update(&ob.BidBook, e)
-		return trades, nil
+		err := update(&ob.BidBook, e)
+		ob.publish(trades)
+		return trades, err
 	}
 	// Discard any updates to orders that do not exist
 	// e.g. an update may be late to an order that has already filled
 	return trades, errors.New("Order does not exist")
 }
 
+// Replace cancels and replaces a resting order exactly as Update does, and
+// also returns a copy of the order as it stood before the replace, with its
+// original price and remaining quantity. An error is returned if no such
+// order exists or the new order fails validation, in which case the book is
+// left unchanged.
+func (ob *OrderBook) Replace(orderId int, newPrice float32, newVolume int) (old Order, trades []Trade, err error) {
+	_, e, ok := ob.find(orderId)
+	if !ok {
+		return Order{}, nil, errors.New("Order does not exist")
+	}
+	old = copyOrder(e.Order())
+	trades, err = ob.Update(orderId, newPrice, newVolume)
+	if err != nil {
+		return Order{}, nil, err
+	}
+	return old, trades, nil
+}
+
+// OrderView is a point-in-time copy of every attribute of a resting order.
+type OrderView struct {
+	OrderId int
+	Side    Side
+	Price   Price
+	// OriginalQuantity is the quantity filled so far plus the quantity still
+	// resting, i.e. the size the order was placed (or last updated) with.
+	OriginalQuantity int
+	// Quantity is the quantity still resting on the book.
+	Quantity int
+	Hidden   bool
+	// DisplayQuantity is the iceberg display size, or zero.
+	DisplayQuantity int
+	OwnerId         int
+	TimeInForce     TimeInForce
+	// Timestamp is when the order was placed on the book, or zero if the
+	// book has no clock.
+	Timestamp time.Time
+}
+
+// Inspect returns a copy of every attribute of a resting order, searching
+// both sides of the book. ok is false if the order is not resting.
+func (ob *OrderBook) Inspect(orderId int) (OrderView, bool) {
+	var side Side
+	e, ok := ob.AskBook.Get(orderId)
+	if ok {
+		side = ASK
+	} else if e, ok = ob.BidBook.Get(orderId); ok {
+		side = BID
+	} else {
+		return OrderView{}, false
+	}
+	return view(side, e.Order()), true
+}
+
+// GetOrder returns a resting order and its side, searching both sides of the
+// book. ok is false if the order is not resting. The order is still on the
+// book and must not be modified; use Inspect for a copy. Nor may it be kept
+// once it leaves the book, as the book may then reuse it for a new order.
+func (ob *OrderBook) GetOrder(orderId int) (*Order, Side, bool) {
+	book, e, ok := ob.find(orderId)
+	if !ok {
+		return nil, BID, false
+	}
+	return e.Order(), book.Side(), true
+}
+
+// view copies the attributes of an order resting on side.
+func view(side Side, o *Order) OrderView {
+	return OrderView{
+		OrderId:          o.OrderId,
+		Side:             side,
+		Price:            o.Price,
+		OriginalQuantity: o.Filled + o.Quantity,
+		Quantity:         o.Quantity,
+		Hidden:           o.Hidden,
+		DisplayQuantity:  o.DisplayQuantity,
+		OwnerId:          o.OwnerId,
+		TimeInForce:      o.TimeInForce,
+		Timestamp:        o.Timestamp,
+	}
+}
+
 // Cancel removes an order from the Order Book.
 // An error is returned if no such order exists.
 func (ob *OrderBook) Cancel(orderId int) error {
-	err := ob.AskBook.Remove(orderId)
-	err2 := ob.BidBook.Remove(orderId)
-	if err != nil && err2 != nil {
+	if err := ob.cancel(orderId); err != nil {
+		return err
+	}
+	ob.publish(nil)
+	return nil
+}
+
+// Reduce decreases the quantity of a resting order by the given amount
+// without changing its price or its place in the time queue. Reducing an
+// order to zero cancels it. An error is returned if no such order exists, or
+// if by is not positive or exceeds the order's remaining quantity.
+func (ob *OrderBook) Reduce(orderId int, by int) error {
+	if by <= 0 {
+		return errors.New("Reduction must be positive")
+	}
+	book, e, ok := ob.find(orderId)
+	if !ok {
 		return errors.New("Order does not exist")
 	}
+	o := e.Order()
+	if by > o.Quantity {
+		return errors.New("Reduction exceeds remaining quantity")
+	}
+	if by == o.Quantity {
+		return ob.Cancel(orderId)
+	}
+	if n, ok := book.GetLevel(o.Price); ok {
+		n.resize(o, o.Quantity-by)
+		n.updateSeq++
+	}
+	ob.touch(book.Side(), o.Price)
+	ob.publish(nil)
+	return nil
+}
+
+// CancelAndReturn removes an order from the Order Book exactly as Cancel
+// does and returns a copy of it as it stood, with its remaining quantity and
+// all of its attributes, e.g. so that it can be placed elsewhere.
+// An error is returned if no such order exists.
+func (ob *OrderBook) CancelAndReturn(orderId int) (*Order, error) {
+	_, e, ok := ob.find(orderId)
+	if !ok {
+		return nil, errors.New("Order does not exist")
+	}
+	o := copyOrder(e.Order())
+	if err := ob.Cancel(orderId); err != nil {
+		return nil, err
+	}
+	return &o, nil
+}
+
+// cancel removes an order from the book without publishing an update.
+func (ob *OrderBook) cancel(orderId int) error {
+	book, e, ok := ob.find(orderId)
+	if !ok {
+		return errors.New("Order does not exist")
+	}
+	o := e.Order()
+	// Remove by handle rather than id to avoid looking the order up again
+	if book.Side() == ASK {
+		ob.AskBook.remove(e)
+	} else {
+		ob.BidBook.remove(e)
+	}
+	ob.touch(book.Side(), o.Price)
+	ob.transition(o, o.state(), OrderCancelled)
 	return nil
 }
+
+// find locates a resting order on either side of the book.
+func (ob *OrderBook) find(orderId int) (Book, Handle, bool) {
+	if e, ok := ob.AskBook.Get(orderId); ok {
+		return &ob.AskBook, e, true
+	}
+	if e, ok := ob.BidBook.Get(orderId); ok {
+		return &ob.BidBook, e, true
+	}
+	return nil, nil, false
+}
+
+// BatchMode controls how CancelBatch handles ids that do not exist.
+type BatchMode uint8
+
+const (
+	// AllOrNothing cancels the batch only if every id exists.
+	AllOrNothing BatchMode = iota
+	// BestEffort cancels every id that exists and reports the rest.
+	BestEffort
+)
+
+// CancelBatch removes several orders in one call and returns the ids that
+// were canceled along with an error for each id that could not be.
+// In AllOrNothing mode every id is validated before any order is removed,
+// so a single missing or repeated id leaves the book untouched.
+func (ob *OrderBook) CancelBatch(ids []int, mode BatchMode) ([]int, []error) {
+	var canceled []int
+	var errs []error
+	exists := func(id int) bool {
+		_, ask := ob.AskBook.Get(id)
+		_, bid := ob.BidBook.Get(id)
+		return ask || bid
+	}
+
+	if mode == AllOrNothing {
+		// A repeated id would fail on its second cancel, after the first
+		// had already been applied
+		seen := make(map[int]struct{}, len(ids))
+		for _, id := range ids {
+			if _, ok := seen[id]; ok {
+				errs = append(errs, fmt.Errorf("Order %d is repeated in the batch", id))
+				continue
+			}
+			seen[id] = struct{}{}
+			if !exists(id) {
+				errs = append(errs, fmt.Errorf("Order %d does not exist", id))
+			}
+		}
+		if len(errs) > 0 {
+			return canceled, errs
+		}
+	}
+
+	for _, id := range ids {
+		if err := ob.cancel(id); err != nil {
+			errs = append(errs, fmt.Errorf("Order %d does not exist", id))
+			continue
+		}
+		canceled = append(canceled, id)
+	}
+	if len(canceled) > 0 {
+		ob.publish(nil)
+	}
+	return canceled, errs
+}
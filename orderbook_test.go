@@ -14,9 +14,11 @@
 package orderbook
 
 import (
+	"errors"
 	"fmt"
 	"math/rand"
 	"testing"
+	"time"
 )
 
 // ~1.2us for 1M records
@@ -56,8 +58,8 @@ func TestAskBook(t *testing.T) {
 	for _, order := range orders {
 		t.Run(fmt.Sprintf("%d-%f", order.Id, order.Price), func(t *testing.T) {
 			ob.Insert(order.Id, ASK, order.Price, 1)
-			if ob.AskBook.Peek().Price != order.Peek {
-				t.Errorf("Expected lowest ask %f, got %f", order.Peek, ob.AskBook.Peek().Price)
+			if ob.AskBook.Peek().Price != float32Price(order.Peek) {
+				t.Errorf("Expected lowest ask %f, got %v", order.Peek, ob.AskBook.Peek().Price)
 			}
 		})
 	}
@@ -65,8 +67,8 @@ func TestAskBook(t *testing.T) {
 	for ob.AskBook.Len() > 0 {
 		t.Run(fmt.Sprintf("next-lowest-%f", expected[0]), func(t *testing.T) {
 			o := ob.AskBook.Pop().Peek()
-			if o.Price != expected[0] {
-				t.Errorf("Expected next lowest ask %f, got %f", expected[0], o.Price)
+			if o.Price != float32Price(expected[0]) {
+				t.Errorf("Expected next lowest ask %f, got %v", expected[0], o.Price)
 			}
 			expected = expected[1:]
 		})
@@ -91,8 +93,8 @@ func TestBidBook(t *testing.T) {
 	for _, order := range orders {
 		t.Run(fmt.Sprintf("%d-%f", order.Id, order.Price), func(t *testing.T) {
 			ob.Insert(order.Id, BID, order.Price, 1)
-			if ob.BidBook.Peek().Price != order.Peek {
-				t.Errorf("Expected highest bid %f, got %f", order.Peek, ob.BidBook.Peek().Price)
+			if ob.BidBook.Peek().Price != float32Price(order.Peek) {
+				t.Errorf("Expected highest bid %f, got %v", order.Peek, ob.BidBook.Peek().Price)
 			}
 		})
 	}
@@ -100,10 +102,1439 @@ func TestBidBook(t *testing.T) {
 	for ob.BidBook.Len() > 0 {
 		t.Run(fmt.Sprintf("next-highest-%f", expected[0]), func(t *testing.T) {
 			o := ob.BidBook.Pop().Peek()
-			if o.Price != expected[0] {
-				t.Errorf("Expected next highest bid %f, got %f", expected[0], o.Price)
+			if o.Price != float32Price(expected[0]) {
+				t.Errorf("Expected next highest bid %f, got %v", expected[0], o.Price)
 			}
 			expected = expected[1:]
 		})
 	}
 }
+
+func TestMaxOrderQuantity(t *testing.T) {
+	ob := NewOrderBook()
+	ob.SetMaxOrderQuantity(100)
+
+	if _, err := ob.Insert(1, BID, 10.0, 100); err != nil {
+		t.Errorf("Expected order at the limit to be accepted, got %v", err)
+	}
+	_, err := ob.Insert(2, BID, 10.0, 101)
+	if rerr, ok := err.(*RejectError); !ok || rerr.Reason != RejectMaxQuantity {
+		t.Errorf("Expected RejectMaxQuantity, got %v", err)
+	}
+	if _, ok := ob.BidBook.Get(2); ok {
+		t.Errorf("Expected rejected order not to rest")
+	}
+	if _, err := ob.Update(1, 10.0, 101); err == nil {
+		t.Errorf("Expected oversized update to be rejected")
+	}
+	if e, _ := ob.BidBook.Get(1); e.Order().Quantity != 100 {
+		t.Errorf("Expected rejected update to leave quantity 100, got %d", e.Order().Quantity)
+	}
+
+	ob.SetMaxOrderQuantity(0)
+	if _, err := ob.Insert(3, BID, 10.0, 1000000); err != nil {
+		t.Errorf("Expected no limit when unset, got %v", err)
+	}
+}
+
+func TestCancelBatch(t *testing.T) {
+	setup := func() *OrderBook {
+		ob := NewOrderBook()
+		ob.Insert(1, BID, 10.0, 1)
+		ob.Insert(2, BID, 11.0, 1)
+		ob.Insert(3, ASK, 12.0, 1)
+		return ob
+	}
+
+	t.Run("all-or-nothing", func(t *testing.T) {
+		ob := setup()
+		canceled, errs := ob.CancelBatch([]int{1, 3, 4}, AllOrNothing)
+		if len(canceled) != 0 || len(errs) != 1 {
+			t.Errorf("Expected no cancels and 1 error, got %v and %v", canceled, errs)
+		}
+		if ob.BidBook.Len() != 2 || ob.AskBook.Len() != 1 {
+			t.Errorf("Expected book to be untouched")
+		}
+
+		canceled, errs = ob.CancelBatch([]int{1, 3, 1}, AllOrNothing)
+		if len(canceled) != 0 || len(errs) != 1 {
+			t.Errorf("Expected a repeated id to reject the batch, got %v and %v", canceled, errs)
+		}
+		if ob.BidBook.Len() != 2 || ob.AskBook.Len() != 1 {
+			t.Errorf("Expected book to be untouched by a repeated id")
+		}
+
+		canceled, errs = ob.CancelBatch([]int{1, 3}, AllOrNothing)
+		if len(canceled) != 2 || len(errs) != 0 {
+			t.Errorf("Expected 2 cancels and no errors, got %v and %v", canceled, errs)
+		}
+		if ob.BidBook.Len() != 1 || ob.AskBook.Len() != 0 {
+			t.Errorf("Expected orders 1 and 3 to be canceled")
+		}
+	})
+
+	t.Run("best-effort", func(t *testing.T) {
+		ob := setup()
+		canceled, errs := ob.CancelBatch([]int{1, 4, 3}, BestEffort)
+		if len(canceled) != 2 || canceled[0] != 1 || canceled[1] != 3 {
+			t.Errorf("Expected orders 1 and 3 to be canceled, got %v", canceled)
+		}
+		if len(errs) != 1 {
+			t.Errorf("Expected 1 error, got %v", errs)
+		}
+		if _, ok := ob.BidBook.Get(2); !ok {
+			t.Errorf("Expected order 2 to remain")
+		}
+	})
+}
+
+func TestLevelUpdateSeq(t *testing.T) {
+	ob := NewOrderBook()
+	var last uint64
+	check := func(name string) {
+		n, ok := ob.AskBook.GetLevel(px(100.0))
+		if !ok {
+			t.Fatalf("%s: expected level at 100", name)
+		}
+		if n.UpdateSeq() <= last {
+			t.Errorf("%s: expected update sequence above %d, got %d", name, last, n.UpdateSeq())
+		}
+		last = n.UpdateSeq()
+	}
+
+	ob.Insert(1, ASK, 100.0, 10)
+	check("add")
+	ob.Insert(2, ASK, 100.0, 10)
+	check("add-second")
+	ob.Insert(3, BID, 100.0, 4)
+	check("partial-fill")
+	ob.Update(2, 100.0, 5)
+	check("decrease")
+	ob.Update(1, 100.0, 20)
+	check("requeue")
+	ob.Cancel(2)
+	check("remove")
+	ob.Insert(4, ASK, 101.0, 10)
+	if n, _ := ob.AskBook.GetLevel(px(100.0)); n.UpdateSeq() != last {
+		t.Errorf("Expected changes at other levels not to affect the sequence")
+	}
+}
+
+func TestUpdateRepriceThroughAsks(t *testing.T) {
+	cases := []struct {
+		Price   float32
+		Volume  int
+		Trades  int
+		BestBid float32
+		BestAsk float32
+	}{
+		// Partially through the asks, resting below the next ask
+		{101.5, 5, 2, 101.5, 102.0},
+		// Filled in full before reaching the ask at the new price
+		{102.0, 2, 2, 98.0, 102.0},
+		// Onto an ask level with the remainder left to rest
+		{102.0, 5, 3, 102.0, 103.0},
+		// Through every ask, resting with nothing left opposite
+		{110.0, 10, 4, 110.0, 0},
+	}
+	for _, c := range cases {
+		t.Run(fmt.Sprintf("%f-%d", c.Price, c.Volume), func(t *testing.T) {
+			ob := NewOrderBook()
+			ob.Insert(1, ASK, 100.0, 1)
+			ob.Insert(2, ASK, 101.0, 1)
+			ob.Insert(3, ASK, 102.0, 1)
+			ob.Insert(4, ASK, 103.0, 1)
+			ob.Insert(5, BID, 99.0, 1)
+			ob.Insert(6, BID, 98.0, 1)
+
+			trades, err := ob.Update(5, c.Price, c.Volume)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(trades) != c.Trades {
+				t.Errorf("Expected %d trades, got %d", c.Trades, len(trades))
+			}
+			if ob.BidBook.Peek().Price != float32Price(c.BestBid) {
+				t.Errorf("Expected best bid %f, got %v", c.BestBid, ob.BidBook.Peek().Price)
+			}
+			if c.BestAsk == 0 {
+				if ob.AskBook.Len() != 0 {
+					t.Errorf("Expected the ask book to be exhausted")
+				}
+				return
+			}
+			if ob.AskBook.Peek().Price != float32Price(c.BestAsk) {
+				t.Errorf("Expected best ask %f, got %v", c.BestAsk, ob.AskBook.Peek().Price)
+			}
+			if ob.BidBook.Peek().Price >= ob.AskBook.Peek().Price {
+				t.Errorf("Expected book not to be locked or crossed, got bid %v ask %v", ob.BidBook.Peek().Price, ob.AskBook.Peek().Price)
+			}
+		})
+	}
+}
+
+func TestInspect(t *testing.T) {
+	ob := NewOrderBook()
+	placed := time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC)
+	ob.SetClock(func() time.Time { return placed })
+	ob.Insert(1, ASK, 100.0, 10)
+	ob.Insert(2, BID, 100.0, 4)
+
+	v, ok := ob.Inspect(1)
+	if !ok {
+		t.Fatalf("Expected order 1 to be resting")
+	}
+	expected := OrderView{OrderId: 1, Side: ASK, Price: px(100.0), OriginalQuantity: 10, Quantity: 6, TimeInForce: GTC, Timestamp: placed}
+	if v != expected {
+		t.Errorf("Expected %+v, got %+v", expected, v)
+	}
+	if _, ok := ob.Inspect(2); ok {
+		t.Errorf("Expected filled order 2 not to be resting")
+	}
+
+	// A partially filled taker keeps its fills once it rests
+	ob.Insert(3, BID, 101.0, 10)
+	v, _ = ob.Inspect(3)
+	expected = OrderView{OrderId: 3, Side: BID, Price: px(101.0), OriginalQuantity: 10, Quantity: 4, Timestamp: placed}
+	if v != expected {
+		t.Errorf("Expected %+v, got %+v", expected, v)
+	}
+}
+
+func TestPriceTolerance(t *testing.T) {
+	cases := []struct {
+		Name      string
+		Tolerance float32
+		Expected  []int
+	}{
+		{"exact", 0, []int{2, 3, 1, 4}},
+		// 100.001 and 100.0 are equal within tolerance, so the level
+		// created first comes first regardless of float noise
+		{"tolerant", 0.01, []int{1, 2, 3, 4}},
+	}
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			ob := NewOrderBook()
+			ob.SetPriceTolerance(c.Tolerance)
+			ob.Insert(1, ASK, 100.001, 1)
+			ob.Insert(2, ASK, 100.0, 1)
+			ob.Insert(3, ASK, 100.0, 1)
+			ob.Insert(4, ASK, 101.0, 1)
+			for _, id := range c.Expected {
+				if o := ob.AskBook.Pop(); o.OrderId != id {
+					t.Errorf("Expected order %d, got %d", id, o.OrderId)
+				}
+			}
+		})
+	}
+
+	ob := NewOrderBook()
+	ob.SetPriceTolerance(0.01)
+	ob.Insert(1, ASK, 100.001, 1)
+	if trades, _ := ob.Insert(2, BID, 100.0, 1); len(trades) != 1 {
+		t.Errorf("Expected a bid within tolerance of the ask to cross")
+	}
+}
+
+func TestInsertMaxAvgPrice(t *testing.T) {
+	t.Run("buy-capped", func(t *testing.T) {
+		ob := NewOrderBook()
+		ob.Insert(1, ASK, 100.0, 10)
+		ob.Insert(2, ASK, 102.0, 10)
+		ob.Insert(3, ASK, 106.0, 10)
+
+		// 10@100 and 10@102 average 101; 5@106 brings it to exactly 102
+		trades, err := ob.InsertMaxAvgPrice(4, BID, 110.0, 30, 102.0)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		expected := []Trade{
+			{Price: px(100.0), Volume: 10, TakerOrderId: 4, MakerOrderId: 1, TakerSide: BID},
+			{Price: px(102.0), Volume: 10, TakerOrderId: 4, MakerOrderId: 2, TakerSide: BID},
+			{Price: px(106.0), Volume: 5, TakerOrderId: 4, MakerOrderId: 3, TakerSide: BID},
+		}
+		if len(trades) != len(expected) {
+			t.Fatalf("Expected %d trades, got %+v", len(expected), trades)
+		}
+		for i := range expected {
+			if trades[i] != expected[i] {
+				t.Errorf("Expected trade %+v, got %+v", expected[i], trades[i])
+			}
+		}
+		if _, ok := ob.BidBook.Get(4); ok {
+			t.Errorf("Expected the capped remainder not to rest")
+		}
+		if n, _ := ob.AskBook.GetLevel(px(106.0)); n.Volume() != 5 {
+			t.Errorf("Expected 5 left at 106, got %d", n.Volume())
+		}
+	})
+
+	t.Run("sell-capped", func(t *testing.T) {
+		ob := NewOrderBook()
+		ob.Insert(1, BID, 100.0, 10)
+		ob.Insert(2, BID, 98.0, 10)
+
+		trades, _ := ob.InsertMaxAvgPrice(3, ASK, 90.0, 20, 99.5)
+		if len(trades) != 2 || trades[1].Volume != 3 {
+			t.Errorf("Expected the sweep to stop after 3@98, got %+v", trades)
+		}
+		if _, ok := ob.AskBook.Get(3); ok {
+			t.Errorf("Expected the capped remainder not to rest")
+		}
+	})
+
+	t.Run("limit-reached", func(t *testing.T) {
+		ob := NewOrderBook()
+		ob.Insert(1, ASK, 100.0, 10)
+		ob.Insert(2, ASK, 102.0, 10)
+
+		trades, _ := ob.InsertMaxAvgPrice(3, BID, 101.0, 15, 105.0)
+		if len(trades) != 1 {
+			t.Errorf("Expected 1 trade, got %+v", trades)
+		}
+		if e, ok := ob.BidBook.Get(3); !ok || e.Order().Quantity != 5 {
+			t.Errorf("Expected 5 to rest at the limit price")
+		}
+	})
+}
+
+func TestHiddenPriority(t *testing.T) {
+	cases := []struct {
+		Name     string
+		Priority HiddenPriority
+		Expected []Trade
+	}{
+		{"visible-first", VisibleFirst, []Trade{
+			{Price: px(100.0), Volume: 5, TakerOrderId: 5, MakerOrderId: 1, TakerSide: BID},
+			{Price: px(100.0), Volume: 5, TakerOrderId: 5, MakerOrderId: 3, TakerSide: BID},
+			{Price: px(100.0), Volume: 2, TakerOrderId: 5, MakerOrderId: 2, TakerSide: BID},
+		}},
+		{"time-priority", TimePriority, []Trade{
+			{Price: px(100.0), Volume: 5, TakerOrderId: 5, MakerOrderId: 1, TakerSide: BID},
+			{Price: px(100.0), Volume: 5, TakerOrderId: 5, MakerOrderId: 2, TakerSide: BID},
+			{Price: px(100.0), Volume: 2, TakerOrderId: 5, MakerOrderId: 3, TakerSide: BID},
+		}},
+	}
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			ob := NewOrderBook()
+			ob.SetHiddenPriority(c.Priority)
+			ob.InsertOrder(ASK, &Order{OrderId: 1, Price: px(100.0), Quantity: 5})
+			ob.InsertOrder(ASK, &Order{OrderId: 2, Price: px(100.0), Quantity: 5, Hidden: true})
+			ob.InsertOrder(ASK, &Order{OrderId: 3, Price: px(100.0), Quantity: 5})
+			ob.InsertOrder(ASK, &Order{OrderId: 4, Price: px(100.0), Quantity: 5, Hidden: true})
+
+			trades, _ := ob.Insert(5, BID, 100.0, 12)
+			if len(trades) != len(c.Expected) {
+				t.Fatalf("Expected %d trades, got %+v", len(c.Expected), trades)
+			}
+			for i := range c.Expected {
+				if trades[i] != c.Expected[i] {
+					t.Errorf("Expected trade %+v, got %+v", c.Expected[i], trades[i])
+				}
+			}
+		})
+	}
+}
+
+func TestInsertAuto(t *testing.T) {
+	ob := NewOrderBook()
+	ob.Insert(1, BID, 90.0, 1)
+	seen := make(map[int]bool)
+	last := 0
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		side := Side(r.Intn(2))
+		id, _, err := ob.InsertAuto(side, float32(95+r.Intn(10)), 1+r.Intn(5))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if id >= 0 || id >= last {
+			t.Fatalf("Expected a negative id below %d, got %d", last, id)
+		}
+		if seen[id] {
+			t.Fatalf("Expected unique ids, got %d twice", id)
+		}
+		seen[id] = true
+		last = id
+	}
+
+	// Rejected orders do not consume an id
+	ob.SetMaxOrderQuantity(10)
+	if _, _, err := ob.InsertAuto(BID, 90.0, 11); err == nil {
+		t.Errorf("Expected oversized order to be rejected")
+	}
+	if id, _, _ := ob.InsertAuto(BID, 90.0, 1); id != last-1 {
+		t.Errorf("Expected id %d, got %d", last-1, id)
+	}
+}
+
+func TestInsertAutoSkipsIdsInUse(t *testing.T) {
+	ob := NewOrderBook()
+	// Negative ids supplied by callers, on both sides
+	ob.Insert(-1, BID, 90.0, 1)
+	ob.Insert(-2, ASK, 110.0, 1)
+	ob.InsertStop(-4, BID, 120.0, 120.0, 1)
+
+	var ids []int
+	for i := 0; i < 3; i++ {
+		id, _, err := ob.InsertAuto(BID, 95.0, 1)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	if ids[0] != -3 || ids[1] != -5 || ids[2] != -6 {
+		t.Errorf("Expected ids [-3 -5 -6], got %v", ids)
+	}
+}
+
+func TestMinResidual(t *testing.T) {
+	cases := []struct {
+		Name      string
+		Policy    ResidualPolicy
+		Remaining int
+		Resting   bool
+	}{
+		{"leave", LeaveResidual, 1, true},
+		{"consume", ConsumeResidual, 0, false},
+	}
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			ob := NewOrderBook()
+			ob.SetMinResidual(5, c.Policy)
+			ob.Insert(1, ASK, 100.0, 10)
+			ob.Insert(2, ASK, 101.0, 10)
+
+			trades, _ := ob.Insert(3, BID, 100.0, 9)
+			if len(trades) != 1 || trades[0].Volume != 9 {
+				t.Errorf("Expected a single fill of 9, got %+v", trades)
+			}
+			if _, ok := ob.AskBook.Get(1); ok != c.Resting {
+				t.Errorf("Expected resting %t for the maker, got %t", c.Resting, ok)
+			}
+			if c.Resting && ob.AskBook.Peek().Quantity != c.Remaining {
+				t.Errorf("Expected %d remaining, got %d", c.Remaining, ob.AskBook.Peek().Quantity)
+			}
+			if !c.Resting && ob.AskBook.Peek().Price != px(101.0) {
+				t.Errorf("Expected best ask 101 once the dust is consumed, got %v", ob.AskBook.Peek().Price)
+			}
+
+			// Residuals at or above the minimum are always left
+			ob.Insert(4, BID, 101.0, 5)
+			if _, ok := ob.AskBook.Get(2); !ok {
+				t.Errorf("Expected a residual of 5 to rest")
+			}
+		})
+	}
+}
+
+func BenchmarkUpdateRepriceNoCross(b *testing.B) {
+	ob := NewOrderBook()
+	for n := 0; n < 1000; n++ {
+		ob.Insert(n, BID, 1.0+float32(n), 1)
+		ob.Insert(1000+n, ASK, 2000.0+float32(n), 1)
+	}
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		ob.Update(n%1000, 1.0+float32(n%1000)+float32((n/1000)%2)/2, 1)
+	}
+}
+
+func BenchmarkCancelRandom(b *testing.B) {
+	ob := NewOrderBook()
+	for n := 0; n < b.N; n++ {
+		if n%2 == 0 {
+			ob.Insert(n, BID, float32(rand.Intn(1000)), 1)
+		} else {
+			ob.Insert(n, ASK, 1001.0+float32(rand.Intn(1000)), 1)
+		}
+	}
+	ids := rand.Perm(b.N)
+	b.ResetTimer()
+	for _, id := range ids {
+		ob.Cancel(id)
+	}
+}
+
+func TestUpdateRepriceNoCross(t *testing.T) {
+	ob := NewOrderBook()
+	ob.Insert(1, BID, 97.0, 1)
+	ob.Insert(2, BID, 98.0, 1)
+	ob.Insert(3, BID, 99.0, 1)
+	ob.Insert(4, BID, 96.0, 1)
+	ob.Insert(5, ASK, 101.0, 1)
+
+	// Alone at its level, moved to a new level
+	ob.Update(1, 100.0, 2)
+	// Moved behind an existing order
+	ob.Update(4, 99.0, 1)
+
+	expected := []struct {
+		Id    int
+		Price float32
+	}{{1, 100.0}, {3, 99.0}, {4, 99.0}, {2, 98.0}}
+	if ob.BidBook.LevelsMap[px(97.0)] != nil || ob.BidBook.LevelsMap[px(96.0)] != nil {
+		t.Errorf("Expected the vacated levels to be removed")
+	}
+	for _, e := range expected {
+		o := ob.BidBook.Pop()
+		if o.OrderId != e.Id || o.Price != float32Price(e.Price) {
+			t.Errorf("Expected order %d at %f, got %d at %v", e.Id, e.Price, o.OrderId, o.Price)
+		}
+	}
+	if v, _ := ob.Inspect(5); v.Quantity != 1 {
+		t.Errorf("Expected the ask to be untouched")
+	}
+}
+
+func TestMaxSweepDistance(t *testing.T) {
+	cases := []struct {
+		Name        string
+		TimeInForce TimeInForce
+		Resting     bool
+	}{
+		{"gtc", GTC, true},
+		{"ioc", IOC, false},
+	}
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			ob := NewOrderBook()
+			ob.SetMaxSweepDistance(0.02)
+			for i, price := range []float32{100.0, 101.0, 102.0, 103.0} {
+				ob.Insert(i+1, ASK, price, 5)
+			}
+
+			trades, _ := ob.InsertOrder(BID, &Order{OrderId: 5, Price: px(105.0), Quantity: 20, TimeInForce: c.TimeInForce})
+			filled := 0
+			for _, trade := range trades {
+				if trade.Price > px(102.0) {
+					t.Errorf("Expected no trades beyond 102, got %+v", trade)
+				}
+				filled += trade.Volume
+			}
+			if filled != 15 {
+				t.Errorf("Expected 15 filled, got %d", filled)
+			}
+			if v, ok := ob.Inspect(4); !ok || v.Quantity != 5 {
+				t.Errorf("Expected the ask at 103 to be untouched")
+			}
+			v, ok := ob.Inspect(5)
+			if ok != c.Resting {
+				t.Fatalf("Expected resting %v, got %v", c.Resting, ok)
+			}
+			if ok && (v.Price != px(102.0) || v.Quantity != 5) {
+				t.Errorf("Expected remaining 5 to rest at 102, got %d at %v", v.Quantity, v.Price)
+			}
+		})
+	}
+
+	// An order whose limit is within the cap rests at its limit
+	ob := NewOrderBook()
+	ob.SetMaxSweepDistance(0.02)
+	ob.Insert(1, ASK, 100.0, 5)
+	ob.Insert(2, ASK, 103.0, 5)
+	ob.Insert(3, BID, 101.5, 10)
+	if v, _ := ob.Inspect(3); v.Price != px(101.5) || v.Quantity != 5 {
+		t.Errorf("Expected remaining 5 to rest at 101.5, got %d at %v", v.Quantity, v.Price)
+	}
+}
+
+func TestMakerRestTime(t *testing.T) {
+	now := time.Date(2024, 1, 1, 9, 30, 0, 0, time.UTC)
+	ob := NewOrderBook()
+	ob.Insert(1, ASK, 100.0, 10)
+	ob.SetClock(func() time.Time { return now })
+	ob.Insert(2, ASK, 100.0, 10)
+
+	now = now.Add(1500 * time.Millisecond)
+	trades, _ := ob.Insert(3, BID, 100.0, 15)
+	// Order 1 rested before the clock was set, so has no timestamp
+	if trades[0].MakerOrderId != 1 || trades[0].MakerRestTime != 0 {
+		t.Errorf("Expected no rest time without a timestamp, got %+v", trades[0])
+	}
+	if trades[1].MakerOrderId != 2 || trades[1].MakerRestTime != 1500*time.Millisecond {
+		t.Errorf("Expected order 2 to have rested 1.5s, got %+v", trades[1])
+	}
+
+	now = now.Add(time.Second)
+	trades, _ = ob.Insert(4, BID, 100.0, 5)
+	if trades[0].MakerRestTime != 2500*time.Millisecond {
+		t.Errorf("Expected the partially filled order to have rested 2.5s, got %v", trades[0].MakerRestTime)
+	}
+}
+
+func TestCancelAndReturn(t *testing.T) {
+	ob := NewOrderBook()
+	ob.InsertOrder(ASK, &Order{OrderId: 1, Price: px(100.0), Quantity: 10, Hidden: true, OwnerId: 7})
+	ob.Insert(2, BID, 100.0, 4)
+
+	o, err := ob.CancelAndReturn(1)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if o.OrderId != 1 || o.Price != px(100.0) || o.Quantity != 6 || o.Filled != 4 || !o.Hidden || o.OwnerId != 7 {
+		t.Errorf("Expected order 1 with 6 remaining, got %+v", o)
+	}
+	if _, ok := ob.Inspect(1); ok {
+		t.Errorf("Expected order 1 to be removed")
+	}
+	if _, err := ob.CancelAndReturn(1); err == nil {
+		t.Errorf("Expected error cancelling a missing order")
+	}
+}
+
+func TestSelfMatchById(t *testing.T) {
+	modes := map[string]MatchingMode{"fifo": FIFO, "pro-rata-priority": ProRataPriority}
+	for name, mode := range modes {
+		t.Run(name, func(t *testing.T) {
+			ob := NewOrderBook()
+			ob.SetMatchingMode(mode)
+			skipped := 0
+			ob.OnSelfMatch(func(orderId int) {
+				if orderId != 1 {
+					t.Errorf("Expected order 1 to be skipped, got %d", orderId)
+				}
+				skipped++
+			})
+			ob.Insert(1, ASK, 100.0, 5)
+			ob.Insert(2, ASK, 100.0, 5)
+			ob.Insert(3, ASK, 101.0, 5)
+
+			// A bid reusing id 1 must not trade with the resting ask 1, and
+			// stops at the level rather than sweeping past it
+			trades, _ := ob.Insert(1, BID, 101.0, 8)
+			if len(trades) != 1 || trades[0].MakerOrderId != 2 || trades[0].Volume != 5 {
+				t.Errorf("Expected a single trade of 5 against order 2, got %+v", trades)
+			}
+			if skipped == 0 {
+				t.Errorf("Expected the same-id maker to be reported")
+			}
+			if n := ob.AskBook.LevelsMap[px(100.0)]; n == nil || n.Volume() != 5 {
+				t.Errorf("Expected the same-id maker to be untouched")
+			}
+			if n := ob.AskBook.LevelsMap[px(101.0)]; n == nil || n.Volume() != 5 {
+				t.Errorf("Expected the next level to be untouched")
+			}
+			if skipped != 1 {
+				t.Errorf("Expected the same-id maker to be reported once, got %d", skipped)
+			}
+			// The unfilled 3 would cross the same-id maker if it rested
+			if ob.BidBook.Len() != 0 {
+				t.Errorf("Expected the remainder of the bid to be canceled, got %d bid levels", ob.BidBook.Len())
+			}
+		})
+	}
+}
+
+func TestSelfMatchNotCrossed(t *testing.T) {
+	ob := NewOrderBook()
+	ob.Insert(1, ASK, 100.0, 1)
+	ob.Insert(2, ASK, 101.0, 3)
+	var cancelled []int
+	ob.OnCancel(func(orderId int) { cancelled = append(cancelled, orderId) })
+
+	trades, err := ob.Insert(1, BID, 101.0, 8)
+	if err != nil || len(trades) != 0 {
+		t.Errorf("Expected no trades past the same-id maker, got %+v, %v", trades, err)
+	}
+	if len(cancelled) != 1 || cancelled[0] != 1 {
+		t.Errorf("Expected the bid to be canceled, got %v", cancelled)
+	}
+	if bid, ask := ob.BidBook.Peek(), ob.AskBook.Peek(); bid != nil && ask != nil && bid.Price >= ask.Price {
+		t.Errorf("Expected the book not to be crossed, got bid %v and ask %v", bid.Price, ask.Price)
+	}
+	checkConsistency(t, ob)
+}
+
+func TestIceberg(t *testing.T) {
+	ob := NewOrderBook()
+	ob.InsertOrder(ASK, &Order{Price: px(100.0), Quantity: 100, OrderId: 1, DisplayQuantity: 10})
+	n := ob.AskBook.LevelsMap[px(100.0)]
+	if n.Volume() != 100 || n.VolumeIncluding(false) != 10 {
+		t.Errorf("Expected 100 resting with 10 displayed, got %d and %d", n.Volume(), n.VolumeIncluding(false))
+	}
+
+	trades, _ := ob.Insert(2, BID, 100.0, 100)
+	if len(trades) != 10 {
+		t.Fatalf("Expected 10 fills of the displayed slice, got %+v", trades)
+	}
+	for _, trade := range trades {
+		if trade.MakerOrderId != 1 || trade.Volume != 10 {
+			t.Errorf("Expected a fill of 10 against order 1, got %+v", trade)
+		}
+	}
+	if ob.AskBook.Len() != 0 || ob.BidBook.Len() != 0 {
+		t.Errorf("Expected the iceberg to be fully consumed")
+	}
+}
+
+func TestIcebergRefillLosesPriority(t *testing.T) {
+	for _, mode := range []MatchingMode{FIFO, ProRata} {
+		ob := NewOrderBook()
+		ob.SetMatchingMode(mode)
+		ob.InsertOrder(ASK, &Order{Price: px(100.0), Quantity: 30, OrderId: 1, DisplayQuantity: 10})
+		ob.Insert(2, ASK, 100.0, 10)
+
+		// Both show 10, so the level is consumed in turn either way, and the
+		// refilled iceberg is then behind order 2
+		trades, _ := ob.Insert(3, BID, 100.0, 25)
+		filled := map[int]int{}
+		for _, trade := range trades {
+			filled[trade.MakerOrderId] += trade.Volume
+		}
+		if filled[1] != 15 || filled[2] != 10 {
+			t.Errorf("Expected mode %d to fill 15 and 10, got %v", mode, filled)
+		}
+		o, ok := ob.Inspect(1)
+		if !ok || o.Quantity != 15 || ob.AskBook.LevelsMap[px(100.0)].VolumeIncluding(false) != 5 {
+			t.Errorf("Expected 15 left with 5 displayed, got %+v", o)
+		}
+	}
+}
+
+func TestTimeInForce(t *testing.T) {
+	cases := []struct {
+		Name        string
+		TimeInForce TimeInForce
+		Quantity    int
+		Filled      int
+		Resting     int
+		State       OrderState
+	}{
+		{"ioc with leftover", IOC, 30, 20, 0, OrderExpired},
+		{"fok fully fillable", FOK, 20, 20, 0, OrderFilled},
+		// Nothing trades, not even the 20 that could fill
+		{"fok partially fillable", FOK, 21, 0, 0, OrderExpired},
+		{"gtc with leftover", GTC, 30, 20, 10, OrderPartiallyFilled},
+	}
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			ob := NewOrderBook()
+			ob.Insert(1, ASK, 100.0, 10)
+			ob.Insert(2, ASK, 101.0, 10)
+			ob.Insert(3, ASK, 102.0, 10)
+			var state OrderState
+			ob.OnOrderStateChange(func(orderId int, old, new OrderState) {
+				if orderId == 4 {
+					state = new
+				}
+			})
+
+			trades, _ := ob.InsertOrder(BID, &Order{OrderId: 4, Price: px(101.0), Quantity: c.Quantity, TimeInForce: c.TimeInForce})
+			filled := 0
+			for _, trade := range trades {
+				filled += trade.Volume
+			}
+			if filled != c.Filled {
+				t.Errorf("Expected %d filled, got %d", c.Filled, filled)
+			}
+			resting := 0
+			if v, ok := ob.Inspect(4); ok {
+				resting = v.Quantity
+			}
+			if resting != c.Resting {
+				t.Errorf("Expected %d resting, got %d", c.Resting, resting)
+			}
+			if state != c.State {
+				t.Errorf("Expected state %s, got %s", c.State, state)
+			}
+			if c.Filled == 0 && (ob.AskBook.Len() != 3 || ob.levels(ASK)[px(100.0)].Volume() != 10) {
+				t.Errorf("Expected a killed order to leave the book unchanged")
+			}
+		})
+	}
+}
+
+func TestInsertPostOnly(t *testing.T) {
+	cases := []struct {
+		Name     string
+		Price    float32
+		Rejected bool
+	}{
+		{"above best ask", 101.0, true},
+		{"at best ask", 100.0, true},
+		{"below best ask", 99.5, false},
+	}
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			ob := NewOrderBook()
+			ob.Insert(1, ASK, 100.0, 10)
+			ob.Insert(2, BID, 99.0, 10)
+
+			trades, err := ob.InsertPostOnly(3, BID, c.Price, 5)
+			if len(trades) != 0 {
+				t.Errorf("Expected no trades, got %+v", trades)
+			}
+			var reject *RejectError
+			if c.Rejected && (!errors.As(err, &reject) || reject.Reason != RejectWouldCross) {
+				t.Errorf("Expected RejectWouldCross, got %v", err)
+			}
+			if !c.Rejected && err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+			if _, ok := ob.Inspect(3); ok == c.Rejected {
+				t.Errorf("Expected resting %v, got %v", !c.Rejected, ok)
+			}
+			if v, _ := ob.Inspect(1); v.Quantity != 10 {
+				t.Errorf("Expected the ask to be untouched")
+			}
+		})
+	}
+}
+
+func TestCachedLevelVolume(t *testing.T) {
+	for _, mode := range []MatchingMode{FIFO, ProRata} {
+		r := rand.New(rand.NewSource(7))
+		ob := NewOrderBook()
+		ob.SetMatchingMode(mode)
+		for i := 0; i < 5000; i++ {
+			id := r.Intn(200)
+			price := float32(95 + r.Intn(10))
+			switch r.Intn(4) {
+			case 0:
+				side := ASK
+				if r.Intn(2) == 0 {
+					side = BID
+				}
+				ob.InsertOrder(side, &Order{OrderId: 1000 + i, Price: float32Price(price), Quantity: 1 + r.Intn(50), DisplayQuantity: r.Intn(3) * 5})
+			case 1:
+				ob.Update(id, price, r.Intn(60))
+			case 2:
+				// Resize in place
+				if v, ok := ob.Inspect(id); ok {
+					ob.Update(id, v.Price.float32(), r.Intn(60))
+				}
+			case 3:
+				ob.Insert(id, Side(r.Intn(2)), price, 1+r.Intn(50))
+			}
+			for _, side := range []Side{BID, ASK} {
+				for price, n := range ob.levels(side) {
+					sum := 0
+					for e := n.Level.Front(); e != nil; e = e.Next() {
+						sum += e.Order().Quantity
+					}
+					if n.Volume() != sum {
+						t.Fatalf("Step %d: expected %s level %v to hold %d, cached %d", i, side, price, sum, n.Volume())
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestGetOrder(t *testing.T) {
+	ob := NewOrderBook()
+	ob.Insert(1, BID, 99.0, 10)
+	ob.Insert(2, ASK, 101.0, 5)
+
+	cases := []struct {
+		Name    string
+		OrderId int
+		Side    Side
+		Found   bool
+	}{
+		{"bid", 1, BID, true},
+		{"ask", 2, ASK, true},
+		{"absent", 3, BID, false},
+	}
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			o, side, ok := ob.GetOrder(c.OrderId)
+			if ok != c.Found {
+				t.Fatalf("Expected found %v, got %v", c.Found, ok)
+			}
+			if !ok {
+				if o != nil {
+					t.Errorf("Expected no order, got %+v", o)
+				}
+				return
+			}
+			if o.OrderId != c.OrderId || side != c.Side {
+				t.Errorf("Expected order %d on %s, got %d on %s", c.OrderId, c.Side, o.OrderId, side)
+			}
+		})
+	}
+}
+
+func TestCancelLeavesOtherSide(t *testing.T) {
+	ob := NewOrderBook()
+	ob.Insert(1, BID, 99.0, 10)
+	ob.Insert(2, ASK, 101.0, 5)
+	ob.Insert(3, ASK, 102.0, 5)
+
+	if err := ob.Cancel(1); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(ob.BidBook.OrdersMap) != 0 || len(ob.BidBook.LevelsMap) != 0 || ob.BidBook.Len() != 0 {
+		t.Errorf("Expected the bid to be removed")
+	}
+	if len(ob.AskBook.OrdersMap) != 2 || len(ob.AskBook.LevelsMap) != 2 || ob.AskBook.Len() != 2 {
+		t.Errorf("Expected the ask book to be untouched")
+	}
+	if err := ob.Cancel(1); err == nil {
+		t.Errorf("Expected an error cancelling a missing order")
+	}
+	if len(ob.AskBook.OrdersMap) != 2 {
+		t.Errorf("Expected the ask book to be untouched")
+	}
+}
+
+func TestRemoveLevel(t *testing.T) {
+	ob := NewOrderBook()
+	ob.Insert(1, ASK, 101.0, 5)
+	ob.Insert(2, ASK, 100.0, 5)
+	ob.Insert(3, ASK, 101.0, 7)
+	ob.Insert(4, ASK, 101.0, 9)
+	ob.Insert(5, BID, 99.0, 3)
+
+	orders := ob.AskBook.RemoveLevel(px(101.0))
+	expected := []int{1, 3, 4}
+	if len(orders) != len(expected) {
+		t.Fatalf("Expected %d orders, got %d", len(expected), len(orders))
+	}
+	for i, id := range expected {
+		if orders[i].OrderId != id {
+			t.Errorf("Expected order %d at position %d, got %d", id, i, orders[i].OrderId)
+		}
+		if _, ok := ob.AskBook.Get(id); ok {
+			t.Errorf("Expected order %d to be removed from the map", id)
+		}
+	}
+	if _, ok := ob.AskBook.GetLevel(px(101.0)); ok || ob.AskBook.Len() != 1 || ob.AskBook.Peek().OrderId != 2 {
+		t.Errorf("Expected only the level at 100 to remain")
+	}
+	if ob.AskBook.RemoveLevel(px(101.0)) != nil {
+		t.Errorf("Expected nothing to remove from a missing level")
+	}
+
+	if orders := ob.BidBook.RemoveLevel(px(99.0)); len(orders) != 1 || orders[0].OrderId != 5 || len(ob.BidBook.OrdersMap) != 0 {
+		t.Errorf("Expected to remove order 5 from the bid book, got %v", orders)
+	}
+}
+
+func TestUpdateQueuePosition(t *testing.T) {
+	cases := []struct {
+		Name     string
+		Price    float32
+		Volume   int
+		Level    float32
+		Position int
+	}{
+		{"same price, quantity down", 99.0, 5, 99.0, 0},
+		{"same price, quantity unchanged", 99.0, 10, 99.0, 2},
+		{"same price, quantity up", 99.0, 15, 99.0, 2},
+		{"new price, quantity down", 98.0, 5, 98.0, 1},
+		{"new price, quantity unchanged", 98.0, 10, 98.0, 1},
+		{"new price, quantity up", 98.0, 15, 98.0, 1},
+	}
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			ob := NewOrderBook()
+			ob.Insert(1, BID, 99.0, 10)
+			ob.Insert(2, BID, 99.0, 10)
+			ob.Insert(3, BID, 99.0, 10)
+			ob.Insert(4, BID, 98.0, 10)
+
+			if _, err := ob.Update(1, c.Price, c.Volume); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			e, ok := ob.BidBook.Get(1)
+			if !ok {
+				t.Fatalf("Expected order 1 to be resting")
+			}
+			position := 0
+			for p := e.Prev(); p != nil; p = p.Prev() {
+				position++
+			}
+			if o := e.Order(); o.Price != float32Price(c.Level) || o.Quantity != c.Volume || position != c.Position {
+				t.Errorf("Expected %d at %g in position %d, got %d at %v in position %d",
+					c.Volume, c.Level, c.Position, o.Quantity, o.Price, position)
+			}
+			if n, _ := ob.BidBook.GetLevel(px(99.0)); n.Peek().OrderId == 1 && c.Position != 0 {
+				t.Errorf("Expected order 1 to lose priority")
+			}
+		})
+	}
+}
+
+func TestReduce(t *testing.T) {
+	cases := []struct {
+		Name     string
+		OrderId  int
+		By       int
+		Err      bool
+		Quantity int
+		Resting  bool
+	}{
+		{"partial", 1, 4, false, 6, true},
+		{"to zero", 1, 10, false, 0, false},
+		{"over reduce", 1, 11, true, 10, true},
+		{"zero", 1, 0, true, 10, true},
+		{"negative", 1, -1, true, 10, true},
+		{"missing", 9, 1, true, 10, true},
+	}
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			ob := NewOrderBook()
+			ob.Insert(1, BID, 99.0, 10)
+			ob.Insert(2, BID, 99.0, 5)
+
+			err := ob.Reduce(c.OrderId, c.By)
+			if (err != nil) != c.Err {
+				t.Errorf("Expected error %v, got %v", c.Err, err)
+			}
+			v, ok := ob.Inspect(1)
+			if ok != c.Resting || (ok && v.Quantity != c.Quantity) {
+				t.Errorf("Expected resting %v with %d, got %v with %d", c.Resting, c.Quantity, ok, v.Quantity)
+			}
+			// Order 1 keeps its place at the front of the level
+			n, _ := ob.BidBook.GetLevel(px(99.0))
+			if c.Resting && n.Peek().OrderId != 1 {
+				t.Errorf("Expected order 1 to keep time priority")
+			}
+			if n.Volume() != c.Quantity+5 {
+				t.Errorf("Expected level volume %d, got %d", c.Quantity+5, n.Volume())
+			}
+		})
+	}
+}
+
+func TestReplace(t *testing.T) {
+	ob := NewOrderBook()
+	ob.Insert(1, ASK, 101.0, 5)
+	ob.Insert(2, BID, 99.0, 10)
+
+	// The replacement crosses and trades, but the old order is as it was
+	old, trades, err := ob.Replace(2, 101.0, 8)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if old.OrderId != 2 || old.Price != px(99.0) || old.Quantity != 10 || old.Filled != 0 {
+		t.Errorf("Expected the original order at 99 for 10, got %+v", old)
+	}
+	if len(trades) != 1 || trades[0].Volume != 5 || trades[0].Price != px(101.0) {
+		t.Errorf("Expected a trade of 5 at 101, got %+v", trades)
+	}
+	if v, ok := ob.Inspect(2); !ok || v.Price != px(101.0) || v.Quantity != 3 {
+		t.Errorf("Expected 3 to rest at 101, got %+v", v)
+	}
+
+	// A second replace returns the state left by the first
+	old, _, _ = ob.Replace(2, 100.0, 4)
+	if old.Price != px(101.0) || old.Quantity != 3 || old.Filled != 5 {
+		t.Errorf("Expected the previous state at 101 for 3, got %+v", old)
+	}
+
+	if _, _, err := ob.Replace(9, 100.0, 1); err == nil {
+		t.Errorf("Expected an error replacing a missing order")
+	}
+	ob.SetMaxOrderQuantity(10)
+	if _, _, err := ob.Replace(2, 100.0, 11); err == nil {
+		t.Errorf("Expected an error for an invalid replacement")
+	}
+	if v, _ := ob.Inspect(2); v.Price != px(100.0) || v.Quantity != 4 {
+		t.Errorf("Expected a rejected replace to leave the order unchanged, got %+v", v)
+	}
+}
+
+func TestRejectNonPositive(t *testing.T) {
+	tests := []struct {
+		name   string
+		insert func(ob *OrderBook) error
+		reason RejectReason
+	}{
+		{"zero volume", func(ob *OrderBook) error {
+			_, err := ob.Insert(3, BID, 99.0, 0)
+			return err
+		}, RejectInvalidQuantity},
+		{"negative volume", func(ob *OrderBook) error {
+			_, err := ob.Insert(3, ASK, 101.0, -5)
+			return err
+		}, RejectInvalidQuantity},
+		{"negative price", func(ob *OrderBook) error {
+			_, err := ob.Insert(3, BID, -1.0, 5)
+			return err
+		}, RejectInvalidPrice},
+		{"zero price", func(ob *OrderBook) error {
+			_, err := ob.InsertPostOnly(3, BID, 0, 5)
+			return err
+		}, RejectInvalidPrice},
+		{"update negative volume", func(ob *OrderBook) error {
+			_, err := ob.Update(1, 99.0, -1)
+			return err
+		}, RejectInvalidQuantity},
+		{"update negative price", func(ob *OrderBook) error {
+			_, err := ob.Update(1, -99.0, 10)
+			return err
+		}, RejectInvalidPrice},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ob := NewOrderBook()
+			ob.Insert(1, BID, 99.0, 10)
+			ob.Insert(2, ASK, 101.0, 10)
+
+			var rej *RejectError
+			if err := tt.insert(ob); !errors.As(err, &rej) || rej.Reason != tt.reason {
+				t.Fatalf("Expected a %v rejection, got %v", tt.reason, err)
+			}
+			if ob.OrderCount(BID) != 1 || ob.OrderCount(ASK) != 1 {
+				t.Errorf("Expected the book to be unchanged, got %d bids and %d asks", ob.OrderCount(BID), ob.OrderCount(ASK))
+			}
+			if v, _ := ob.Inspect(1); v.Price != px(99.0) || v.Quantity != 10 {
+				t.Errorf("Expected order 1 unchanged, got %+v", v)
+			}
+		})
+	}
+
+	// A volume of zero still cancels through Update
+	ob := NewOrderBook()
+	ob.Insert(1, BID, 99.0, 10)
+	if _, err := ob.Update(1, 99.0, 0); err != nil {
+		t.Errorf("Expected no error cancelling with zero volume, got %v", err)
+	}
+	if _, ok := ob.Inspect(1); ok {
+		t.Errorf("Expected order 1 to be cancelled")
+	}
+}
+
+func TestInsertDuplicateId(t *testing.T) {
+	ob := NewOrderBook()
+	ob.Insert(1, BID, 99.0, 10)
+	ob.Insert(2, ASK, 101.0, 4)
+
+	// The duplicate would cross, but is rejected before it can trade
+	trades, err := ob.Insert(1, BID, 101.0, 5)
+	var rej *RejectError
+	if !errors.As(err, &rej) || rej.Reason != RejectDuplicateOrderId {
+		t.Fatalf("Expected a duplicate id rejection, got %v", err)
+	}
+	if len(trades) != 0 {
+		t.Errorf("Expected no trades, got %+v", trades)
+	}
+	if v, _ := ob.Inspect(1); v.Price != px(99.0) || v.Quantity != 10 {
+		t.Errorf("Expected order 1 unchanged, got %+v", v)
+	}
+	if v, _ := ob.Inspect(2); v.Quantity != 4 {
+		t.Errorf("Expected order 2 unchanged, got %+v", v)
+	}
+	if n := ob.BidBook.LevelsMap[px(101.0)]; n != nil {
+		t.Errorf("Expected no bid level at 101, got volume %d", n.Volume())
+	}
+}
+
+func TestMaxLevels(t *testing.T) {
+	ob := NewOrderBook()
+	var cancelled []int
+	ob.OnCancel(func(orderId int) { cancelled = append(cancelled, orderId) })
+	ob.SetMaxLevels(BID, 3)
+	ob.Insert(1, BID, 99.0, 1)
+	ob.Insert(2, BID, 98.0, 1)
+	ob.Insert(3, BID, 97.0, 1)
+	ob.Insert(4, BID, 97.0, 1)
+	for i := 0; i < 5; i++ {
+		ob.Insert(10+i, ASK, float32(101+i), 1)
+	}
+
+	// A better level pushes out the worst, with all of its orders
+	ob.Insert(5, BID, 100.0, 1)
+	if ob.LevelCount(BID) != 3 {
+		t.Fatalf("Expected 3 bid levels, got %d", ob.LevelCount(BID))
+	}
+	if _, ok := ob.BidBook.GetLevel(px(97.0)); ok {
+		t.Errorf("Expected the level at 97 to be evicted")
+	}
+	for _, id := range []int{3, 4} {
+		if _, ok := ob.Inspect(id); ok {
+			t.Errorf("Expected order %d to be removed", id)
+		}
+	}
+	if len(cancelled) != 2 || cancelled[0] != 3 || cancelled[1] != 4 {
+		t.Errorf("Expected orders 3 and 4 to be cancelled, got %v", cancelled)
+	}
+
+	// A new level worse than all the others is itself the one evicted
+	ob.Insert(6, BID, 90.0, 1)
+	if _, ok := ob.Inspect(6); ok || ob.LevelCount(BID) != 3 {
+		t.Errorf("Expected the new worst level to be evicted")
+	}
+	// Joining an existing level is not limited
+	ob.Insert(7, BID, 98.0, 1)
+	if v := ob.VolumeAtPrice(BID, 98.0); v != 2 {
+		t.Errorf("Expected 2 at 98, got %d", v)
+	}
+	if p := ob.BidBook.Peek().Price; p != px(100.0) {
+		t.Errorf("Expected best bid 100, got %v", p)
+	}
+
+	// Lowering the cap trims the book straight away, leaving asks alone
+	ob.SetMaxLevels(BID, 1)
+	if ob.LevelCount(BID) != 1 || ob.BidBook.Peek().Price != px(100.0) {
+		t.Errorf("Expected only the best bid level to remain")
+	}
+	ob.SetMaxLevels(ASK, 2)
+	if ob.LevelCount(ASK) != 2 || ob.AskBook.Peek().Price != px(101.0) {
+		t.Errorf("Expected the two best ask levels to remain, got %d", ob.LevelCount(ASK))
+	}
+	if _, ok := ob.AskBook.GetLevel(px(102.0)); !ok {
+		t.Errorf("Expected the level at 102 to remain")
+	}
+}
+
+func TestUpdateRequeueOrder(t *testing.T) {
+	// Each step interleaves inserts and same-price updates at one level, and
+	// the expected queue is checked by sweeping the level one lot at a time
+	tests := []struct {
+		name     string
+		steps    func(ob *OrderBook)
+		expected []int
+	}{
+		{"increase moves to back", func(ob *OrderBook) {
+			ob.Update(1, 100.0, 2)
+		}, []int{2, 3, 1}},
+		{"same quantity moves to back", func(ob *OrderBook) {
+			ob.Update(2, 100.0, 1)
+		}, []int{1, 3, 2}},
+		{"decrease keeps place", func(ob *OrderBook) {
+			ob.Update(1, 100.0, 2)
+			ob.Update(1, 100.0, 1)
+		}, []int{2, 3, 1}},
+		{"last order stays last", func(ob *OrderBook) {
+			ob.Update(3, 100.0, 2)
+		}, []int{1, 2, 3}},
+		{"interleaved with inserts", func(ob *OrderBook) {
+			ob.Update(1, 100.0, 2)
+			ob.Insert(4, ASK, 100.0, 1)
+			ob.Update(2, 100.0, 3)
+			ob.Insert(5, ASK, 100.0, 1)
+			ob.Update(4, 100.0, 1)
+		}, []int{3, 1, 2, 5, 4}},
+		{"every order requeued", func(ob *OrderBook) {
+			ob.Update(1, 100.0, 1)
+			ob.Update(2, 100.0, 1)
+			ob.Update(3, 100.0, 1)
+		}, []int{1, 2, 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ob := NewOrderBook()
+			ob.Insert(1, ASK, 100.0, 1)
+			ob.Insert(2, ASK, 100.0, 1)
+			ob.Insert(3, ASK, 100.0, 1)
+			tt.steps(ob)
+
+			var makers []int
+			for i := 0; ob.AskBook.Len() > 0 && i < 20; i++ {
+				trades, _ := ob.Insert(100+i, BID, 100.0, 1)
+				if len(trades) != 1 {
+					t.Fatalf("Expected one trade per lot, got %+v", trades)
+				}
+				if len(makers) == 0 || makers[len(makers)-1] != trades[0].MakerOrderId {
+					makers = append(makers, trades[0].MakerOrderId)
+				}
+			}
+			if len(makers) != len(tt.expected) {
+				t.Fatalf("Expected match order %v, got %v", tt.expected, makers)
+			}
+			for i := range makers {
+				if makers[i] != tt.expected[i] {
+					t.Errorf("Expected match order %v, got %v", tt.expected, makers)
+					break
+				}
+			}
+			checkConsistency(t, ob)
+		})
+	}
+
+	// An order whose level has gone missing reports an error rather than
+	// silently keeping its place
+	ob := NewOrderBook()
+	ob.Insert(1, ASK, 100.0, 1)
+	delete(ob.AskBook.LevelsMap, px(100.0))
+	if _, err := ob.Update(1, 100.0, 2); err == nil {
+		t.Errorf("Expected an error for an order with no level")
+	}
+}
+
+func TestNegativePrices(t *testing.T) {
+	ob := NewOrderBook()
+	var rej *RejectError
+	if _, err := ob.Insert(1, BID, -1.0, 5); !errors.As(err, &rej) || rej.Reason != RejectInvalidPrice {
+		t.Errorf("Expected negative prices to be rejected by default, got %v", err)
+	}
+
+	ob.SetAllowNegativePrices(true)
+	ob.Insert(1, BID, -2.5, 5)
+	ob.Insert(2, BID, -0.5, 5)
+	ob.Insert(3, BID, -1.0, 5)
+	ob.Insert(4, ASK, 1.0, 5)
+	ob.Insert(5, ASK, -0.25, 5)
+	ob.Insert(6, ASK, 0, 5)
+
+	if p := ob.BidBook.Peek().Price; p != px(-0.5) {
+		t.Errorf("Expected the least negative bid -0.5 to be best, got %v", p)
+	}
+	if p := ob.AskBook.Peek().Price; p != px(-0.25) {
+		t.Errorf("Expected the lowest ask -0.25 to be best, got %v", p)
+	}
+	if s, _ := ob.Spread(); s != 0.25 {
+		t.Errorf("Expected a spread of 0.25, got %v", s)
+	}
+
+	// A sell at -1 crosses the bids at -0.5 and -1 but not at -2.5
+	trades, _ := ob.Insert(7, ASK, -1.0, 12)
+	if len(trades) != 2 || trades[0].Price != px(-0.5) || trades[1].Price != px(-1.0) {
+		t.Fatalf("Expected trades at -0.5 then -1, got %+v", trades)
+	}
+	if v := ob.VolumeAtPrice(ASK, -1.0); v != 2 {
+		t.Errorf("Expected 2 to rest at -1, got %d", v)
+	}
+
+	// A buy at 0 sweeps every ask up to and including zero, best first
+	trades, _ = ob.Insert(8, BID, 0, 20)
+	if len(trades) != 3 || trades[0].Price != px(-1.0) || trades[1].Price != px(-0.25) || trades[2].Price != 0 {
+		t.Errorf("Expected trades at -1, -0.25 then 0, got %+v", trades)
+	}
+	if p := ob.BidBook.Peek().Price; p != 0 {
+		t.Errorf("Expected the remainder to rest at 0, got %v", p)
+	}
+	checkConsistency(t, ob)
+}
+
+func TestClear(t *testing.T) {
+	ob := NewOrderBook()
+	ob.Insert(1, BID, 99.0, 5)
+	ob.Insert(2, BID, 98.0, 5)
+	ob.InsertOrder(ASK, &Order{OrderId: 3, Price: px(101.0), Quantity: 5, OwnerId: 7})
+	ob.Insert(4, BID, 101.0, 2)
+	ob.InsertStop(5, BID, 105.0, 106.0, 1)
+	ob.InsertConditional(BID, NewOrder(6, px(90.0), 1), Trigger{Kind: TriggerSpread, Threshold: 100, Above: true})
+	id, _, _ := ob.InsertAuto(ASK, 102.0, 1)
+	if ob.MakerVolume(7) != 2 || ob.PendingStops() != 1 || ob.PendingConditionals() != 1 {
+		t.Fatalf("Expected maker volume and pending orders before clearing")
+	}
+
+	ob.Clear()
+	for _, side := range []Side{BID, ASK} {
+		if ob.OrderCount(side) != 0 || ob.LevelCount(side) != 0 {
+			t.Errorf("Expected no %s orders or levels, got %d and %d", side, ob.OrderCount(side), ob.LevelCount(side))
+		}
+	}
+	if ob.AskBook.Len() != 0 || ob.BidBook.Len() != 0 {
+		t.Errorf("Expected empty heaps, got %d asks and %d bids", ob.AskBook.Len(), ob.BidBook.Len())
+	}
+	if ob.AskBook.Peek() != nil || ob.BidBook.Peek() != nil {
+		t.Errorf("Expected Peek to find nothing")
+	}
+	if ob.PendingStops() != 0 || ob.PendingConditionals() != 0 {
+		t.Errorf("Expected no pending stop or conditional orders")
+	}
+	if v := ob.MakerVolume(7); v != 0 {
+		t.Errorf("Expected maker volume to be reset, got %d", v)
+	}
+
+	// The book is usable again, and ids carry on
+	ob.Insert(1, BID, 99.0, 5)
+	if trades, _ := ob.Insert(3, ASK, 99.0, 2); len(trades) != 1 || trades[0].Volume != 2 {
+		t.Errorf("Expected a trade of 2 after clearing, got %+v", trades)
+	}
+	if next, _, _ := ob.InsertAuto(ASK, 102.0, 1); next != id-1 {
+		t.Errorf("Expected auto id %d, got %d", id-1, next)
+	}
+	checkConsistency(t, ob)
+}
+
+func TestOrderTimestamps(t *testing.T) {
+	now := time.Date(2024, 1, 1, 9, 30, 0, 0, time.UTC)
+	ob := NewOrderBook()
+	ob.Insert(1, ASK, 101.0, 1)
+	if o := ob.OldestOrder(ASK); o != nil {
+		t.Errorf("Expected no oldest order without timestamps, got %+v", o)
+	}
+
+	ob.SetClock(func() time.Time { return now })
+	for i := 2; i <= 6; i++ {
+		now = now.Add(time.Millisecond)
+		ob.Insert(i, ASK, float32(100+i%2), 1)
+	}
+	// A requeue moves an order back without changing its timestamp
+	ob.Update(2, 100.0, 1)
+
+	for _, price := range []float64{100.0, 101.0} {
+		n, _ := ob.AskBook.GetLevel(px(price))
+		var prev time.Time
+		for e := n.Level.Front(); e != nil; e = e.Next() {
+			o := e.Order()
+			if o.OrderId == 1 || o.OrderId == 2 {
+				continue
+			}
+			if o.Timestamp.IsZero() {
+				t.Errorf("Expected order %d to be timestamped", o.OrderId)
+			}
+			if o.Timestamp.Before(prev) {
+				t.Errorf("Expected non-decreasing timestamps at %v, got %v after %v", price, o.Timestamp, prev)
+			}
+			prev = o.Timestamp
+		}
+	}
+
+	o := ob.OldestOrder(ASK)
+	if o == nil || o.OrderId != 2 {
+		t.Fatalf("Expected order 2 to be the oldest, got %+v", o)
+	}
+	if age := o.Age(now); age != 4*time.Millisecond {
+		t.Errorf("Expected order 2 to be 4ms old, got %v", age)
+	}
+	if o, _, _ := ob.GetOrder(1); o.Age(now) != 0 {
+		t.Errorf("Expected no age without a timestamp, got %v", o.Age(now))
+	}
+	if o := ob.OldestOrder(BID); o != nil {
+		t.Errorf("Expected no oldest bid, got %+v", o)
+	}
+}
+
+func TestLotSize(t *testing.T) {
+	ob := NewOrderBook()
+	ob.SetLotSize(10, 5)
+	ob.Insert(1, ASK, 101.0, 50)
+
+	tests := []struct {
+		name   string
+		volume int
+		reason RejectReason
+	}{
+		{"minimum", 10, 0},
+		{"whole lots above minimum", 25, 0},
+		{"below minimum", 5, RejectMinQuantity},
+		{"off step", 12, RejectOffLot},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ob.Insert(10+i, BID, 99.0, tt.volume)
+			var rej *RejectError
+			if tt.reason == 0 {
+				if err != nil {
+					t.Errorf("Expected %d to be accepted, got %v", tt.volume, err)
+				}
+				if v, ok := ob.Inspect(10 + i); !ok || v.Quantity != tt.volume {
+					t.Errorf("Expected %d to rest, got %+v", tt.volume, v)
+				}
+			} else if !errors.As(err, &rej) || rej.Reason != tt.reason {
+				t.Errorf("Expected a %v rejection, got %v", tt.reason, err)
+			}
+		})
+	}
+
+	// Updates are checked too, except a volume of zero, which cancels
+	var rej *RejectError
+	if _, err := ob.Update(10, 99.0, 13); !errors.As(err, &rej) || rej.Reason != RejectOffLot {
+		t.Errorf("Expected an off-lot update to be rejected, got %v", err)
+	}
+	if _, err := ob.Update(10, 99.0, 20); err != nil {
+		t.Errorf("Expected an update in whole lots to be accepted, got %v", err)
+	}
+	if _, err := ob.Update(10, 99.0, 0); err != nil {
+		t.Errorf("Expected zero volume to cancel, got %v", err)
+	}
+}
@@ -0,0 +1,96 @@
+package orderbook
+
+// OutcomeKind classifies what happened to an order on submission.
+type OutcomeKind uint8
+
+const (
+	// FullyRested orders did not trade and rest in full.
+	FullyRested OutcomeKind = iota
+	// PartiallyFilledResting orders traded in part and rest the remainder.
+	PartiallyFilledResting
+	// PartiallyFilledNotResting orders traded in part and the remainder
+	// was canceled, e.g. by IOC.
+	PartiallyFilledNotResting
+	// FullyFilled orders traded their whole quantity.
+	FullyFilled
+	// Unfilled orders neither traded nor rest, e.g. an IOC order with
+	// nothing to match against.
+	Unfilled
+	// Rejected orders failed validation and never reached the book.
+	Rejected
+	// Queued orders arrived while the book was paused and rest without
+	// matching until Resume.
+	Queued
+)
+
+func (k OutcomeKind) String() string {
+	switch k {
+	case FullyRested:
+		return "fully rested"
+	case PartiallyFilledResting:
+		return "partially filled, resting"
+	case PartiallyFilledNotResting:
+		return "partially filled, not resting"
+	case FullyFilled:
+		return "fully filled"
+	case Unfilled:
+		return "unfilled"
+	case Rejected:
+		return "rejected"
+	case Queued:
+		return "queued"
+	}
+	return "unknown"
+}
+
+// InsertReport describes the result of submitting an order.
+type InsertReport struct {
+	Trades  []Trade
+	Outcome OutcomeKind
+	// Filled is the quantity traded on submission.
+	Filled int
+	// Resting is the quantity left resting on the book.
+	Resting int
+	// Exhausted is set when the order consumed all of the liquidity on
+	// the opposite side of the book and still had quantity left over,
+	// whether that then rested or was canceled.
+	Exhausted bool
+}
+
+// Submit inserts an order exactly as InsertOrder does and reports the
+// outcome along with the trades, so that callers need not derive it from
+// the trade volumes. If the order fails validation the outcome is Rejected
+// and the RejectError is also returned.
+func (ob *OrderBook) Submit(side Side, o *Order) (InsertReport, error) {
+	o.pooled = false
+	filled := o.Filled
+	if err := ob.admit(side, o); err != nil {
+		return InsertReport{Outcome: Rejected}, err
+	}
+	trades := ob.match(side, o)
+	// Judged before publishing, as the stops and conditional orders that
+	// publish triggers may add liquidity back to the opposite side
+	makerBook, _ := ob.books(side)
+	exhausted := o.Filled > filled && o.Quantity > 0 && makerBook.Len() == 0
+	ob.publish(trades)
+
+	r := InsertReport{Trades: trades, Filled: o.Filled - filled, Exhausted: exhausted}
+	if _, _, ok := ob.find(o.OrderId); ok {
+		r.Resting = o.Quantity
+	}
+	switch {
+	case ob.paused && r.Resting > 0:
+		r.Outcome = Queued
+	case o.Quantity <= 0:
+		r.Outcome = FullyFilled
+	case r.Filled == 0 && r.Resting > 0:
+		r.Outcome = FullyRested
+	case r.Filled == 0:
+		r.Outcome = Unfilled
+	case r.Resting > 0:
+		r.Outcome = PartiallyFilledResting
+	default:
+		r.Outcome = PartiallyFilledNotResting
+	}
+	return r, nil
+}
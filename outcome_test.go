@@ -0,0 +1,108 @@
+// Copyright 2024 Lane A. Shetron
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package orderbook
+
+import (
+	"testing"
+)
+
+func TestSubmit(t *testing.T) {
+	cases := []struct {
+		Name    string
+		Order   *Order
+		Paused  bool
+		Outcome OutcomeKind
+		Filled  int
+		Resting int
+	}{
+		{"non-crossing", &Order{OrderId: 10, Price: px(99.0), Quantity: 5}, false, FullyRested, 0, 5},
+		{"partial rests", &Order{OrderId: 10, Price: px(100.0), Quantity: 15}, false, PartiallyFilledResting, 10, 5},
+		{"ioc partial", &Order{OrderId: 10, Price: px(100.0), Quantity: 15, TimeInForce: IOC}, false, PartiallyFilledNotResting, 10, 0},
+		{"ioc unfilled", &Order{OrderId: 10, Price: px(99.0), Quantity: 5, TimeInForce: IOC}, false, Unfilled, 0, 0},
+		{"complete fill", &Order{OrderId: 10, Price: px(101.0), Quantity: 12}, false, FullyFilled, 12, 0},
+		{"rejected", &Order{OrderId: 10, Price: px(101.0), Quantity: 1000}, false, Rejected, 0, 0},
+		{"paused", &Order{OrderId: 10, Price: px(101.0), Quantity: 12}, true, Queued, 0, 12},
+		{"paused ioc", &Order{OrderId: 10, Price: px(101.0), Quantity: 12, TimeInForce: IOC}, true, Rejected, 0, 0},
+	}
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			ob := NewOrderBook()
+			ob.SetMaxOrderQuantity(100)
+			ob.Insert(1, ASK, 100.0, 10)
+			ob.Insert(2, ASK, 101.0, 10)
+			if c.Paused {
+				ob.Pause()
+			}
+
+			r, err := ob.Submit(BID, c.Order)
+			if (err != nil) != (c.Outcome == Rejected) {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if r.Outcome != c.Outcome || r.Filled != c.Filled || r.Resting != c.Resting {
+				t.Errorf("Expected %s with %d filled and %d resting, got %s with %d filled and %d resting",
+					c.Outcome, c.Filled, c.Resting, r.Outcome, r.Filled, r.Resting)
+			}
+		})
+	}
+}
+
+func TestSubmitExhausted(t *testing.T) {
+	cases := []struct {
+		Name        string
+		TimeInForce TimeInForce
+		Quantity    int
+		Exhausted   bool
+		Resting     int
+	}{
+		{"gtc rests", GTC, 30, true, 10},
+		{"ioc cancels", IOC, 30, true, 0},
+		{"exact fill", GTC, 20, false, 0},
+		{"partial sweep", GTC, 15, false, 0},
+	}
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			ob := NewOrderBook()
+			ob.Insert(1, ASK, 100.0, 10)
+			ob.Insert(2, ASK, 101.0, 10)
+			ob.Insert(3, BID, 99.0, 10)
+
+			r, _ := ob.Submit(BID, &Order{OrderId: 4, Price: px(105.0), Quantity: c.Quantity, TimeInForce: c.TimeInForce})
+			if r.Exhausted != c.Exhausted || r.Resting != c.Resting {
+				t.Errorf("Expected exhausted %v with %d resting, got %v with %d resting", c.Exhausted, c.Resting, r.Exhausted, r.Resting)
+			}
+			if c.Resting > 0 && ob.BidBook.Peek().OrderId != 4 {
+				t.Errorf("Expected the remainder to rest as the best bid")
+			}
+		})
+	}
+
+	// Nothing to consume is not exhaustion
+	ob := NewOrderBook()
+	if r, _ := ob.Submit(ASK, NewOrder(1, px(100.0), 5)); r.Exhausted {
+		t.Errorf("Expected an order into an empty book not to be flagged")
+	}
+
+	// A stop triggered by the sweep adds asks back afterwards, which does not
+	// undo the exhaustion
+	ob = NewOrderBook()
+	ob.Insert(1, ASK, 100.0, 10)
+	ob.InsertStop(2, ASK, 100.0, 110.0, 5)
+	r, _ := ob.Submit(BID, NewOrder(3, px(105.0), 15))
+	if !r.Exhausted || r.Resting != 5 {
+		t.Errorf("Expected exhausted with 5 resting, got %v with %d resting", r.Exhausted, r.Resting)
+	}
+	if ob.AskBook.Len() != 1 {
+		t.Errorf("Expected the triggered stop to rest on the ask side")
+	}
+}
@@ -0,0 +1,58 @@
+package orderbook
+
+// Pause suspends continuous matching. Until Resume is called, new and
+// repriced orders rest on the book without matching, even if they cross.
+// IOC and FOK orders, which must never rest, are rejected with RejectPaused.
+func (ob *OrderBook) Pause() {
+	ob.paused = true
+}
+
+// Resume restarts continuous matching and uncrosses the book: each order
+// that was inserted or repriced while paused is taken off the book and
+// matched again in the order it arrived, exactly as if it had arrived after
+// the pause. It returns the resulting trades. An order that rests again is
+// not reported to OnAdd a second time.
+func (ob *OrderBook) Resume() []Trade {
+	ob.paused = false
+	pending := ob.pending
+	ob.pending = nil
+
+	// An order repriced while paused is queued by its latest arrival
+	type arrival struct {
+		side Side
+		o    *Order
+	}
+	var orders []arrival
+	seen := make(map[int]bool)
+	for i := len(pending) - 1; i >= 0; i-- {
+		id := pending[i]
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		if e, ok := ob.AskBook.Get(id); ok {
+			orders = append(orders, arrival{ASK, e.Order()})
+		} else if e, ok := ob.BidBook.Get(id); ok {
+			orders = append(orders, arrival{BID, e.Order()})
+		}
+	}
+
+	// Take every queued order off the book first, so that none of them can
+	// be matched against an order that arrived after it
+	for _, a := range orders {
+		if a.side == ASK {
+			ob.AskBook.Remove(a.o.OrderId)
+		} else {
+			ob.BidBook.Remove(a.o.OrderId)
+		}
+		ob.touch(a.side, a.o.Price)
+	}
+	trades := []Trade{}
+	ob.resuming = true
+	for i := len(orders) - 1; i >= 0; i-- {
+		trades = append(trades, ob.match(orders[i].side, orders[i].o)...)
+	}
+	ob.resuming = false
+	ob.publish(trades)
+	return trades
+}
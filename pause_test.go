@@ -0,0 +1,98 @@
+// Copyright 2024 Lane A. Shetron
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package orderbook
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPauseResume(t *testing.T) {
+	ob := NewOrderBook()
+	ob.Insert(1, ASK, 101.0, 5)
+	ob.Insert(2, BID, 99.0, 5)
+
+	ob.Pause()
+	if trades, _ := ob.Insert(3, BID, 102.0, 3); len(trades) != 0 {
+		t.Errorf("Expected no trades while paused, got %+v", trades)
+	}
+	ob.Insert(4, ASK, 98.0, 4)
+	ob.Insert(5, BID, 100.0, 1)
+	ob.Insert(6, ASK, 110.0, 1)
+	ob.Insert(7, BID, 100.5, 1)
+	ob.Cancel(7)
+	if ob.BidBook.Peek().Price < ob.AskBook.Peek().Price {
+		t.Fatalf("Expected the book to be crossed while paused")
+	}
+
+	trades := ob.Resume()
+	// Replayed in arrival order: 3 lifts order 1, then 4 hits order 2,
+	// since order 5 has not yet arrived at that point in the replay
+	expected := []Trade{
+		{Price: px(101.0), Volume: 3, TakerOrderId: 3, MakerOrderId: 1, TakerSide: BID},
+		{Price: px(99.0), Volume: 4, TakerOrderId: 4, MakerOrderId: 2, TakerSide: ASK},
+	}
+	if len(trades) != len(expected) {
+		t.Fatalf("Expected %d trades, got %+v", len(expected), trades)
+	}
+	for i := range expected {
+		if trades[i] != expected[i] {
+			t.Errorf("Expected trade %+v, got %+v", expected[i], trades[i])
+		}
+	}
+	if ob.BidBook.Peek().Price >= ob.AskBook.Peek().Price {
+		t.Errorf("Expected the book to be uncrossed after Resume")
+	}
+	if trades, _ := ob.Insert(8, BID, 101.0, 1); len(trades) != 1 {
+		t.Errorf("Expected matching to continue after Resume")
+	}
+}
+
+func TestPausedImmediateOrders(t *testing.T) {
+	ob := NewOrderBook()
+	ob.Insert(1, ASK, 101.0, 5)
+	ob.Pause()
+	for i, tif := range []TimeInForce{IOC, FOK} {
+		_, err := ob.InsertOrder(BID, &Order{OrderId: 10 + i, Price: px(101.0), Quantity: 5, TimeInForce: tif})
+		var reject *RejectError
+		if !errors.As(err, &reject) || reject.Reason != RejectPaused {
+			t.Errorf("Expected %v to be rejected while paused, got %v", tif, err)
+		}
+	}
+	if ob.BidBook.Len() != 0 {
+		t.Errorf("Expected no immediate order to rest while paused")
+	}
+	if trades := ob.Resume(); len(trades) != 0 || ob.TotalVolume(ASK) != 5 {
+		t.Errorf("Expected nothing to match on Resume, got %+v", trades)
+	}
+}
+
+func TestResumeAddsOnce(t *testing.T) {
+	ob := NewOrderBook()
+	added := make(map[int]int)
+	ob.OnAdd(func(v OrderView) { added[v.OrderId]++ })
+	ob.Insert(1, ASK, 101.0, 5)
+	ob.Pause()
+	ob.Insert(2, BID, 100.0, 5)
+	ob.Insert(3, BID, 101.0, 8)
+	ob.Resume()
+	for _, id := range []int{1, 2, 3} {
+		if added[id] != 1 {
+			t.Errorf("Expected order %d to be added once, got %d", id, added[id])
+		}
+	}
+	if v, _ := ob.Inspect(3); v.Quantity != 3 {
+		t.Errorf("Expected order 3 to rest with 3 after Resume, got %d", v.Quantity)
+	}
+}
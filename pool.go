@@ -0,0 +1,119 @@
+package orderbook
+
+import "sync"
+
+// pool recycles the orders and price levels of a single OrderBook, which
+// shares it with its AskBook and BidBook. Orders are recycled only if the
+// book allocated them itself, i.e. for Insert and the other methods that
+// take an id, price and volume, once they reach a terminal state; an Order
+// passed in by the caller, as to InsertOrder or LoadOrders, always stays the
+// caller's. Levels are recycled only if they use the default queue, once
+// they are removed from their book by Remove or RemoveLevel. A level handed
+// back by PopLevel belongs to the caller.
+//
+// Objects are not reused straight away: they are retired while an operation
+// runs and only returned to the pools once it has published its update, so
+// that nothing the operation, or a callback, is still reading can change
+// underneath it. Callers must not keep a *Order or *Node obtained from
+// GetOrder, GetLevel, LevelsMap, Peek or the iterators once the order or
+// level has left the book; the copies returned by CancelAndReturn, Replace
+// and TopOrders, and by the queries of SyncOrderBook, are never recycled.
+//
+// Everything taken from a pool is reset first, so no field of an earlier
+// order or level carries over.
+type pool struct {
+	orders sync.Pool
+	nodes  sync.Pool
+
+	retiredOrders []*Order
+	retiredNodes  []*Node
+}
+
+func newPool() *pool {
+	return &pool{
+		orders: sync.Pool{New: func() interface{} { return new(Order) }},
+		nodes: sync.Pool{New: func() interface{} {
+			n := NewNode(0)
+			return &n
+		}},
+	}
+}
+
+// order returns a new order, reused from the pool if p is not nil.
+func (p *pool) order(orderId int, price Price, quantity int) *Order {
+	if p == nil {
+		return NewOrder(orderId, price, quantity)
+	}
+	o := p.orders.Get().(*Order)
+	*o = Order{
+		Price:    price,
+		Quantity: quantity,
+		OrderId:  orderId,
+		pooled:   true,
+	}
+	return o
+}
+
+// node returns a new level using the given queue constructor, or with the
+// default queue reused from the pool if it is nil and p is not.
+func (p *pool) node(price Price, newQueue func() LevelQueue) *Node {
+	if p == nil || newQueue != nil {
+		return newNode(price, newQueue)
+	}
+	n := p.nodes.Get().(*Node)
+	q := n.Level.(listQueue)
+	q.l.Init()
+	*n = Node{
+		Level:  q,
+		Key:    price,
+		pooled: true,
+	}
+	return n
+}
+
+// retireOrder marks an order that has reached a terminal state to be
+// returned to the pool, if the book allocated it.
+func (p *pool) retireOrder(o *Order) {
+	if p == nil || !o.pooled {
+		return
+	}
+	o.pooled = false
+	p.retiredOrders = append(p.retiredOrders, o)
+}
+
+// retireNode marks a level removed from its book to be returned to the
+// pool, if it was taken from it.
+func (p *pool) retireNode(n *Node) {
+	if p == nil || !n.pooled {
+		return
+	}
+	n.pooled = false
+	p.retiredNodes = append(p.retiredNodes, n)
+}
+
+// release returns everything retired so far to the pools.
+func (p *pool) release() {
+	if p == nil {
+		return
+	}
+	for i, o := range p.retiredOrders {
+		p.orders.Put(o)
+		p.retiredOrders[i] = nil
+	}
+	p.retiredOrders = p.retiredOrders[:0]
+	for i, n := range p.retiredNodes {
+		// Let go of the orders still linked into a removed level
+		n.Level.(listQueue).l.Init()
+		p.nodes.Put(n)
+		p.retiredNodes[i] = nil
+	}
+	p.retiredNodes = p.retiredNodes[:0]
+}
+
+// copyOrder returns a copy of o for the caller to keep, which the book will
+// never recycle.
+func copyOrder(o *Order) Order {
+	c := *o
+	c.pooled = false
+	return c
+}
@@ -0,0 +1,110 @@
+// Copyright 2024 Lane A. Shetron
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package orderbook
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPoolResetsReused(t *testing.T) {
+	p := newPool()
+	var o *Order
+	var n *Node
+	// A sync.Pool may drop what is put into it, so retry until both an
+	// order and a level come back
+	for i := 0; i < 100 && (o == nil || n == nil); i++ {
+		old := p.order(1, px(99.5), 10)
+		*old = Order{Price: px(99.5), Quantity: 3, OrderId: 1, Filled: 7, Hidden: true, DisplayQuantity: 2,
+			OwnerId: 5, TimeInForce: IOC, Timestamp: time.Unix(1000, 0), shown: 2, pooled: true}
+		oldLevel := p.node(px(99.5), nil)
+		oldLevel.Level.PushBack(old)
+		oldLevel.volume, oldLevel.seq, oldLevel.updateSeq, oldLevel.index = 3, 4, 5, 6
+		p.retireOrder(old)
+		p.retireNode(oldLevel)
+		p.release()
+		if c := p.order(2, px(101.0), 20); c == old {
+			o = c
+		}
+		if c := p.node(px(101.0), nil); c == oldLevel {
+			n = c
+		}
+	}
+	if o == nil || n == nil {
+		t.Fatalf("Expected an order and a level to be reused")
+	}
+	if want := (Order{Price: px(101.0), Quantity: 20, OrderId: 2, pooled: true}); *o != want {
+		t.Errorf("Expected %+v, got %+v", want, *o)
+	}
+	if n.Key != px(101.0) || n.volume != 0 || n.seq != 0 || n.updateSeq != 0 || n.index != 0 {
+		t.Errorf("Expected a fresh level at 101, got %+v", *n)
+	}
+	if n.Level.Len() != 0 || n.Peek() != nil {
+		t.Errorf("Expected an empty queue, got %d orders", n.Level.Len())
+	}
+}
+
+func TestBookReusesOrders(t *testing.T) {
+	now := time.Unix(1000, 0)
+	ob := NewOrderBook()
+	ob.SetClock(func() time.Time { return now })
+	var orderReused, levelReused bool
+	for i := 0; i < 100 && !(orderReused && levelReused); i++ {
+		bidId, askId, _, _ := ob.Quote(7, 99.0, 10, 101.0, 10)
+		old, _, _ := ob.GetOrder(bidId)
+		oldLevel, _ := ob.BidBook.GetLevel(px(99.0))
+		ob.Insert(1, ASK, 99.0, 10)
+
+		now = now.Add(time.Second)
+		ob.Insert(2, BID, 98.0, 5)
+		o, _, _ := ob.GetOrder(2)
+		if o == old {
+			orderReused = true
+			if o.Filled != 0 || o.OwnerId != 0 || !o.Timestamp.Equal(now) {
+				t.Errorf("Expected a fresh order, got %+v", *o)
+			}
+		}
+		if n, _ := ob.BidBook.GetLevel(px(98.0)); n == oldLevel {
+			levelReused = true
+			if n.Key != px(98.0) || n.Volume() != 5 || n.UpdateSeq() != 1 || n.Level.Len() != 1 {
+				t.Errorf("Expected a fresh level at 98, got %+v", *n)
+			}
+		}
+		ob.Cancel(2)
+		ob.Cancel(askId)
+		checkConsistency(t, ob)
+	}
+	if !orderReused || !levelReused {
+		t.Errorf("Expected orders and levels to be reused")
+	}
+}
+
+func TestCallerOrdersNotRecycled(t *testing.T) {
+	ob := NewOrderBook()
+	o := NewOrder(1, px(99.0), 10)
+	o.OwnerId = 3
+	ob.InsertOrder(BID, o)
+	ob.Insert(2, ASK, 99.0, 10)
+	for i := 0; i < 100; i++ {
+		ob.Insert(10+i, BID, 98.0, 1)
+		if got, _, _ := ob.GetOrder(10 + i); got == o {
+			t.Fatalf("Expected the caller's order never to be reused")
+		}
+		ob.Cancel(10 + i)
+	}
+	if o.OrderId != 1 || o.Filled != 10 || o.OwnerId != 3 {
+		t.Errorf("Expected the caller's order to be left as it filled, got %+v", *o)
+	}
+}
@@ -0,0 +1,96 @@
+package orderbook
+
+import (
+	"math"
+	"strconv"
+)
+
+// Price is an exact price, held as a whole number of units of 1/PriceScale.
+// Order prices, level keys and trade prices are all Prices, so equal prices
+// are always equal, hash to the same level and order exactly, however they
+// were computed in floating point. The methods that take float32 prices
+// convert them on the way in.
+type Price int64
+
+// PriceScale is the number of Price units in a price of 1, which makes the
+// smallest representable increment 1e-8.
+const PriceScale = 100000000
+
+// priceLimit is the largest magnitude of a Price. It leaves room to add two
+// prices together without overflow, and maxPrice is the same limit as a
+// price the book accepts.
+const (
+	priceLimit = 1 << 62
+	maxPrice   = priceLimit / PriceScale
+)
+
+// PriceFromFloat returns the Price nearest f, first snapped to the nearest
+// whole number of ticks if tick is positive. Prices too large in magnitude
+// for a Price are clamped to the largest one.
+func PriceFromFloat(f float64, tick float64) Price {
+	if tick > 0 {
+		f = math.Round(f/tick) * tick
+	}
+	u := math.Round(f * PriceScale)
+	if u > priceLimit {
+		return priceLimit
+	} else if u < -priceLimit {
+		return -priceLimit
+	}
+	return Price(u)
+}
+
+// Float returns the price as a float64.
+func (p Price) Float() float64 {
+	return float64(p) / PriceScale
+}
+
+// String formats the price as the shortest decimal that represents it.
+func (p Price) String() string {
+	return strconv.FormatFloat(p.Float(), 'g', -1, 64)
+}
+
+// float32 returns the price as a float32, for the methods that report prices
+// as float32.
+func (p Price) float32() float32 {
+	return float32(p.Float())
+}
+
+// abs returns the magnitude of the price.
+func (p Price) abs() Price {
+	if p < 0 {
+		return -p
+	}
+	return p
+}
+
+// float32Price returns the Price of the shortest decimal that rounds to f as
+// a float32, so that e.g. the float32 nearest 100.1 becomes exactly 100.1
+// rather than 100.09999847.
+func float32Price(f float32) Price {
+	scaled := float64(f)
+	for places := 1.0; places < PriceScale; places *= 10 {
+		if d := math.Round(float64(f)*places) / places; float32(d) == f {
+			scaled = d
+			break
+		}
+	}
+	return PriceFromFloat(scaled, 0)
+}
+
+// price converts an incoming float32 price to a Price, snapped to the book's
+// tick size if it has one.
+func (ob *OrderBook) price(f float32) Price {
+	if ob.tick > 0 {
+		return PriceFromFloat(float64(f), ob.tick)
+	}
+	return float32Price(f)
+}
+
+// snap moves a Price to the nearest tick, if the book has a tick size.
+func (ob *OrderBook) snap(p Price) Price {
+	if ob.tick > 0 {
+		return PriceFromFloat(p.Float(), ob.tick)
+	}
+	return p
+}
@@ -0,0 +1,70 @@
+// Copyright 2024 Lane A. Shetron
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package orderbook
+
+import "testing"
+
+// px is the exact Price of a price written as a float.
+func px(f float64) Price {
+	return PriceFromFloat(f, 0)
+}
+
+func TestPriceExact(t *testing.T) {
+	if a, b := PriceFromFloat(0.1+0.2, 0), PriceFromFloat(0.3, 0); a != b {
+		t.Errorf("Expected 0.1+0.2 and 0.3 to be the same price, got %v and %v", a, b)
+	}
+	if p := float32Price(100.1); p != px(100.1) {
+		t.Errorf("Expected the float32 100.1 to be exactly 100.1, got %v", p)
+	}
+	if p := PriceFromFloat(100.26, 0.05); p != px(100.25) {
+		t.Errorf("Expected 100.25, got %v", p)
+	}
+	if p := px(99.5); p.String() != "99.5" || p.Float() != 99.5 {
+		t.Errorf("Expected 99.5, got %v", p)
+	}
+	if p := PriceFromFloat(1e30, 0); p != priceLimit {
+		t.Errorf("Expected a clamped price, got %v", p)
+	}
+}
+
+func TestPriceLevelsMatch(t *testing.T) {
+	ob := NewOrderBook()
+	// The same price reached through different float arithmetic
+	ob.Insert(1, BID, 0.3, 5)
+	ob.InsertOrder(BID, NewOrder(2, PriceFromFloat(0.1+0.2, 0), 5))
+	if n := len(ob.BidBook.LevelsMap); n != 1 {
+		t.Errorf("Expected a single level, got %d", n)
+	}
+	if n, ok := ob.BidBook.GetLevel(px(0.3)); !ok || n.Volume() != 10 {
+		t.Errorf("Expected 10 at 0.3, got %v", n)
+	}
+	trades, _ := ob.Insert(3, ASK, 0.3, 10)
+	if len(trades) != 2 || trades[0].Price != px(0.3) || trades[1].Price != px(0.3) {
+		t.Errorf("Expected two trades at 0.3, got %+v", trades)
+	}
+}
+
+func TestPriceRange(t *testing.T) {
+	ob := NewOrderBook()
+	if _, err := ob.Insert(1, BID, float32(maxPrice)*2, 5); err == nil {
+		t.Errorf("Expected a price beyond the Price range to be rejected")
+	}
+	if _, err := ob.Insert(2, BID, 1e10, 5); err != nil {
+		t.Errorf("Expected a large price to be accepted, got %v", err)
+	}
+	if p := ob.BidBook.Peek().Price; p != px(1e10) {
+		t.Errorf("Expected 1e10, got %v", p)
+	}
+}
@@ -0,0 +1,127 @@
+package orderbook
+
+import "sort"
+
+// RoundingPolicy selects how pro-rata matching distributes the units lost
+// when proportional shares are rounded down to whole quantities.
+type RoundingPolicy uint8
+
+const (
+	// RoundBySize gives the leftover units to the largest orders first,
+	// with ties going to the order with time priority.
+	RoundBySize RoundingPolicy = iota
+	// RoundLargestRemainder gives the leftover units to the orders whose
+	// exact shares had the largest fractional parts, with ties going to the
+	// order with time priority.
+	RoundLargestRemainder
+)
+
+// SetProRataRounding selects how pro-rata matching rounds fractional
+// allocations. The default is RoundBySize. With either policy the
+// allocations at a level always sum to exactly the quantity being filled.
+func (ob *OrderBook) SetProRataRounding(policy RoundingPolicy) {
+	ob.rounding = policy
+}
+
+// matchProRata fills up to quantity of the taker against a price level by
+// allocating it among the resting orders in proportion to their size, and
+// returns the appended trades. If priority is set, the order at the front of
+// the level is first filled in full time priority and only the remainder is
+// shared.
+func (ob *OrderBook) matchProRata(trades []Trade, book Book, n *Node, taker *Order, quantity int, priority bool) []Trade {
+	if priority {
+		o := ob.front(n, taker)
+		for o != nil && ob.selfTrade(book, o, taker) {
+			if ob.takerCanceled {
+				return trades
+			}
+			o = ob.front(n, taker)
+		}
+		if o != nil {
+			qty := max(min(o.visible(), quantity), 0)
+			quantity -= qty
+			trades = ob.record(trades, ob.fill(book, n, o, taker, qty))
+		}
+	}
+	if n.Level.Len() == 0 || quantity <= 0 {
+		return trades
+	}
+
+	orders := make([]*Order, 0, n.Level.Len())
+	total := 0
+	for e := n.Level.Front(); e != nil; {
+		o := e.Order()
+		// Self-trade prevention may remove o, so advance first
+		e = e.Next()
+		if ob.isSelf(o, taker) {
+			continue
+		}
+		if ob.selfTrade(book, o, taker) {
+			if ob.takerCanceled {
+				return trades
+			}
+			continue
+		}
+		orders = append(orders, o)
+		total += o.visible()
+	}
+	if len(orders) == 0 {
+		return trades
+	}
+
+	// The whole level is consumed, so there is nothing to apportion
+	if total <= quantity {
+		for _, o := range orders {
+			if ob.takerCanceled {
+				break
+			}
+			trades = ob.record(trades, ob.fill(book, n, o, taker, o.visible()))
+		}
+		return trades
+	}
+
+	alloc := allocateProRata(orders, total, quantity, ob.rounding)
+	for i, o := range orders {
+		if ob.takerCanceled {
+			break
+		}
+		if alloc[i] > 0 {
+			trades = ob.record(trades, ob.fill(book, n, o, taker, alloc[i]))
+		}
+	}
+	return trades
+}
+
+// allocateProRata divides quantity among orders in proportion to their
+// matchable size, which for an iceberg is only its displayed slice.
+// Each order first receives its share rounded down; the units lost to
+// rounding are then handed out one at a time in the order given by policy.
+// The allocations always sum to exactly quantity, which must be less than
+// total.
+func allocateProRata(orders []*Order, total int, quantity int, policy RoundingPolicy) []int {
+	alloc := make([]int, len(orders))
+	remainder := make([]int64, len(orders))
+	assigned := 0
+	for i, o := range orders {
+		share := int64(quantity) * int64(o.visible())
+		alloc[i] = int(share / int64(total))
+		remainder[i] = share % int64(total)
+		assigned += alloc[i]
+	}
+
+	rank := make([]int, len(orders))
+	for i := range rank {
+		rank[i] = i
+	}
+	sort.SliceStable(rank, func(a, b int) bool {
+		if policy == RoundLargestRemainder {
+			return remainder[rank[a]] > remainder[rank[b]]
+		}
+		return orders[rank[a]].visible() > orders[rank[b]].visible()
+	})
+	for i := 0; assigned < quantity; i++ {
+		alloc[rank[i%len(rank)]]++
+		assigned++
+	}
+	return alloc
+}
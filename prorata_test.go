@@ -0,0 +1,210 @@
+// Copyright 2024 Lane A. Shetron
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package orderbook
+
+import (
+	"testing"
+)
+
+func TestProRataPriority(t *testing.T) {
+	cases := []struct {
+		Name     string
+		Mode     MatchingMode
+		Expected map[int]int
+	}{
+		{"fifo", FIFO, map[int]int{1: 10, 2: 30, 3: 10}},
+		// The front order fills in full, then 40 is shared 30:60
+		{"pro-rata-priority", ProRataPriority, map[int]int{1: 10, 2: 13, 3: 27}},
+	}
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			ob := NewOrderBook()
+			ob.SetMatchingMode(c.Mode)
+			ob.Insert(1, ASK, 100.0, 10)
+			ob.Insert(2, ASK, 100.0, 30)
+			ob.Insert(3, ASK, 100.0, 60)
+
+			trades, _ := ob.Insert(4, BID, 100.0, 50)
+			if trades[0].MakerOrderId != 1 || trades[0].Volume != 10 {
+				t.Errorf("Expected front order to fill first, got %+v", trades[0])
+			}
+			total := 0
+			for _, trade := range trades {
+				if trade.Volume != c.Expected[trade.MakerOrderId] {
+					t.Errorf("Expected order %d to fill %d, got %d", trade.MakerOrderId, c.Expected[trade.MakerOrderId], trade.Volume)
+				}
+				total += trade.Volume
+			}
+			if total != 50 {
+				t.Errorf("Expected 50 filled, got %d", total)
+			}
+			if ob.AskBook.Peek().Price != px(100.0) || ob.BidBook.Len() != 0 {
+				t.Errorf("Expected remaining asks at 100 and no resting bid")
+			}
+		})
+	}
+}
+
+func TestProRata(t *testing.T) {
+	cases := []struct {
+		Name     string
+		Mode     MatchingMode
+		Expected map[int]int
+	}{
+		{"fifo", FIFO, map[int]int{1: 20, 2: 30, 3: 0}},
+		// Exact shares 5, 15, 30
+		{"pro-rata", ProRata, map[int]int{1: 5, 2: 15, 3: 30}},
+	}
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			ob := NewOrderBook()
+			ob.SetMatchingMode(c.Mode)
+			ob.Insert(1, ASK, 100.0, 20)
+			ob.Insert(2, ASK, 100.0, 60)
+			ob.Insert(3, ASK, 100.0, 120)
+
+			trades, _ := ob.Insert(4, BID, 100.0, 50)
+			filled := map[int]int{}
+			for _, trade := range trades {
+				filled[trade.MakerOrderId] += trade.Volume
+			}
+			for id, vol := range c.Expected {
+				if filled[id] != vol {
+					t.Errorf("Expected order %d to fill %d, got %d", id, vol, filled[id])
+				}
+			}
+		})
+	}
+
+	// The unit lost to rounding goes to the largest order
+	ob := NewOrderBook()
+	ob.SetMatchingMode(ProRata)
+	ob.Insert(1, ASK, 100.0, 10)
+	ob.Insert(2, ASK, 100.0, 20)
+	ob.Insert(3, ASK, 100.0, 30)
+	trades, _ := ob.Insert(4, BID, 100.0, 7)
+	filled := map[int]int{}
+	for _, trade := range trades {
+		filled[trade.MakerOrderId] += trade.Volume
+	}
+	if filled[1] != 1 || filled[2] != 2 || filled[3] != 4 {
+		t.Errorf("Expected fills 1, 2 and 4, got %v", filled)
+	}
+}
+
+func TestProRataPriorityAcrossLevels(t *testing.T) {
+	ob := NewOrderBook()
+	ob.SetMatchingMode(ProRataPriority)
+	ob.Insert(1, ASK, 100.0, 5)
+	ob.Insert(2, ASK, 100.0, 5)
+	ob.Insert(3, ASK, 101.0, 20)
+	ob.Insert(4, ASK, 101.0, 20)
+
+	trades, _ := ob.Insert(5, BID, 101.0, 30)
+	// The second order at 100 is consumed outright, and the front order at
+	// 101 absorbs the rest before anything is shared with order 4
+	expected := []Trade{
+		{Price: px(100.0), Volume: 5, TakerOrderId: 5, MakerOrderId: 1, TakerSide: BID},
+		{Price: px(100.0), Volume: 5, TakerOrderId: 5, MakerOrderId: 2, TakerSide: BID},
+		{Price: px(101.0), Volume: 20, TakerOrderId: 5, MakerOrderId: 3, TakerSide: BID},
+	}
+	if len(trades) != len(expected) {
+		t.Fatalf("Expected %d trades, got %+v", len(expected), trades)
+	}
+	for i := range expected {
+		if trades[i] != expected[i] {
+			t.Errorf("Expected trade %+v, got %+v", expected[i], trades[i])
+		}
+	}
+}
+
+func TestProRataRounding(t *testing.T) {
+	cases := []struct {
+		Name     string
+		Sizes    []int
+		Quantity int
+		BySize   []int
+		Largest  []int
+	}{
+		{"equal sizes", []int{1, 1, 1}, 2, []int{1, 1, 0}, []int{1, 1, 0}},
+		// Exact shares 0.7, 1.75, 4.55
+		{"skewed", []int{10, 25, 65}, 7, []int{0, 2, 5}, []int{1, 2, 4}},
+		// Exact shares 1.5, 1.5, 2.0
+		{"halves", []int{3, 3, 4}, 5, []int{1, 1, 3}, []int{2, 1, 2}},
+		// Exact shares 2.77, 4.35, 5.15, 6.73
+		{"primes", []int{7, 11, 13, 17}, 19, []int{2, 4, 6, 7}, []int{3, 4, 5, 7}},
+	}
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			orders := make([]*Order, len(c.Sizes))
+			total := 0
+			for i, size := range c.Sizes {
+				orders[i] = NewOrder(i+1, px(100.0), size)
+				total += size
+			}
+			for _, p := range []struct {
+				Policy   RoundingPolicy
+				Expected []int
+			}{{RoundBySize, c.BySize}, {RoundLargestRemainder, c.Largest}} {
+				alloc := allocateProRata(orders, total, c.Quantity, p.Policy)
+				for i := range alloc {
+					if alloc[i] != p.Expected[i] {
+						t.Errorf("Expected policy %d to allocate %v, got %v", p.Policy, p.Expected, alloc)
+						break
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestProRataConservation(t *testing.T) {
+	sizes := []int{7, 11, 13, 17, 1, 29}
+	orders := make([]*Order, len(sizes))
+	total := 0
+	for i, size := range sizes {
+		orders[i] = NewOrder(i+1, px(100.0), size)
+		total += size
+	}
+	for _, policy := range []RoundingPolicy{RoundBySize, RoundLargestRemainder} {
+		for quantity := 1; quantity < total; quantity++ {
+			sum := 0
+			for i, a := range allocateProRata(orders, total, quantity, policy) {
+				if a < 0 || a > sizes[i] {
+					t.Errorf("Expected allocation within order size %d, got %d", sizes[i], a)
+				}
+				sum += a
+			}
+			if sum != quantity {
+				t.Errorf("Expected policy %d to allocate exactly %d, got %d", policy, quantity, sum)
+			}
+		}
+	}
+
+	// End to end, the fills at a level sum to the taker quantity
+	ob := NewOrderBook()
+	ob.SetMatchingMode(ProRataPriority)
+	ob.SetProRataRounding(RoundLargestRemainder)
+	for i, size := range sizes {
+		ob.Insert(i+1, ASK, 100.0, size)
+	}
+	trades, _ := ob.Insert(100, BID, 100.0, 31)
+	filled := 0
+	for _, trade := range trades {
+		filled += trade.Volume
+	}
+	if filled != 31 || ob.AskBook.Peek() == nil || ob.levels(ASK)[px(100.0)].Volume() != total-31 {
+		t.Errorf("Expected 31 filled and %d resting, got %d filled", total-31, filled)
+	}
+}
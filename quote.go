@@ -0,0 +1,58 @@
+package orderbook
+
+// QuoteMode selects how Quote treats a quote that would trade on arrival.
+type QuoteMode uint8
+
+const (
+	// QuotePostOnly rejects the whole quote if either side would cross the
+	// opposite side of the book.
+	QuotePostOnly QuoteMode = iota
+	// QuoteMarketable allows either side of a quote to trade on arrival
+	// like an ordinary Insert.
+	QuoteMarketable
+)
+
+// SetQuoteMode selects how Quote handles marketable quotes. The default is
+// QuotePostOnly.
+func (ob *OrderBook) SetQuoteMode(mode QuoteMode) {
+	ob.quoteMode = mode
+}
+
+// Quote submits a two-sided quote for an account as a single operation. Both
+// orders are given auto-assigned ids as with InsertAuto and attributed to
+// accountId. Both sides go through the same checks as InsertOrder, including
+// self-cross rejection, before either is placed, so a quote is never left
+// half placed: if either side is rejected, or in QuotePostOnly mode would
+// cross the book, a RejectError is returned and the book is unchanged. A quote whose bid is at or above its ask is always
+// rejected. In QuoteMarketable mode the bid is matched before the ask.
+func (ob *OrderBook) Quote(accountId int, bidPrice float32, bidVol int, askPrice float32, askVol int) (bidId, askId int, trades []Trade, err error) {
+	bidId = ob.nextAutoId(ob.lastAutoId)
+	askId = ob.nextAutoId(bidId)
+	bid := ob.pool.order(bidId, float32Price(bidPrice), bidVol)
+	bid.OwnerId = accountId
+	ask := ob.pool.order(askId, float32Price(askPrice), askVol)
+	ask.OwnerId = accountId
+	if err := ob.admit(BID, bid); err != nil {
+		return 0, 0, nil, err
+	}
+	if err := ob.admit(ASK, ask); err != nil {
+		return 0, 0, nil, err
+	}
+	if bid.Price >= ask.Price {
+		return 0, 0, nil, &RejectError{bidId, RejectWouldCross}
+	}
+	if ob.quoteMode == QuotePostOnly {
+		if best := ob.AskBook.Peek(); best != nil && ob.crosses(BID, bid.Price, best.Price) {
+			return 0, 0, nil, &RejectError{bidId, RejectWouldCross}
+		}
+		if best := ob.BidBook.Peek(); best != nil && ob.crosses(ASK, ask.Price, best.Price) {
+			return 0, 0, nil, &RejectError{askId, RejectWouldCross}
+		}
+	}
+
+	ob.lastAutoId = askId
+	trades = ob.match(BID, bid)
+	trades = append(trades, ob.match(ASK, ask)...)
+	ob.publish(trades)
+	return bidId, askId, trades, nil
+}
@@ -0,0 +1,96 @@
+// Copyright 2024 Lane A. Shetron
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package orderbook
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestQuote(t *testing.T) {
+	ob := NewOrderBook()
+	ob.Insert(1, BID, 99.0, 5)
+	ob.Insert(2, ASK, 101.0, 5)
+
+	bidId, askId, trades, err := ob.Quote(7, 99.5, 10, 100.5, 10)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(trades) != 0 || bidId != -1 || askId != -2 {
+		t.Errorf("Expected quote -1/-2 with no trades, got %d/%d with %d trades", bidId, askId, len(trades))
+	}
+	for _, id := range []int{bidId, askId} {
+		if v, ok := ob.Inspect(id); !ok || v.OwnerId != 7 || v.Quantity != 10 {
+			t.Errorf("Expected order %d resting for account 7, got %+v", id, v)
+		}
+	}
+
+	cases := []struct {
+		Name     string
+		BidPrice float32
+		AskPrice float32
+		OrderId  int
+	}{
+		{"bid crosses best ask", 100.5, 102.0, -3},
+		{"ask crosses best bid", 98.0, 99.5, -4},
+		{"bid above own ask", 100.0, 100.0, -3},
+	}
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			before := ob.State()
+			_, _, _, err := ob.Quote(7, c.BidPrice, 1, c.AskPrice, 1)
+			var reject *RejectError
+			if !errors.As(err, &reject) || reject.Reason != RejectWouldCross || reject.OrderId != c.OrderId {
+				t.Errorf("Expected order %d rejected as crossing, got %v", c.OrderId, err)
+			}
+			if diff := DiffSnapshots(before, ob.State()); len(diff) > 0 {
+				t.Errorf("Expected book unchanged, got %v", diff)
+			}
+		})
+	}
+
+	// Rejected quotes do not consume ids
+	if bidId, _, _, _ := ob.Quote(8, 99.0, 1, 101.0, 1); bidId != -3 {
+		t.Errorf("Expected next quote to be assigned -3, got %d", bidId)
+	}
+
+	ob.SetQuoteMode(QuoteMarketable)
+	_, _, trades, err = ob.Quote(9, 100.5, 4, 102.0, 4)
+	if err != nil || len(trades) != 1 || trades[0].MakerOrderId != askId || trades[0].Volume != 4 {
+		t.Errorf("Expected marketable bid to trade 4 against %d, got %v (%v)", askId, trades, err)
+	}
+}
+
+func TestQuoteSelfCross(t *testing.T) {
+	ob := NewOrderBook()
+	ob.SetQuoteMode(QuoteMarketable)
+	ob.SetRejectSelfCross(true)
+	ob.InsertOrder(ASK, &Order{OrderId: 1, Price: px(101.0), Quantity: 5, OwnerId: 7})
+	ob.InsertOrder(BID, &Order{OrderId: 2, Price: px(98.0), Quantity: 5, OwnerId: 8})
+
+	before := ob.State()
+	_, askId, _, err := ob.Quote(7, 101.0, 1, 102.0, 1)
+	var reject *RejectError
+	if !errors.As(err, &reject) || reject.Reason != RejectSelfCross {
+		t.Errorf("Expected the quote to be rejected as a self-cross, got %v", err)
+	}
+	if diff := DiffSnapshots(before, ob.State()); len(diff) > 0 || askId != 0 {
+		t.Errorf("Expected book unchanged, got %v", diff)
+	}
+
+	// Another account's quote may trade
+	if _, _, trades, err := ob.Quote(8, 101.0, 1, 102.0, 1); err != nil || len(trades) != 1 {
+		t.Errorf("Expected account 8's bid to trade, got %v (%v)", trades, err)
+	}
+}
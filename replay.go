@@ -0,0 +1,54 @@
+package orderbook
+
+import "fmt"
+
+// EventType identifies the operation recorded by a BookEvent.
+type EventType uint8
+
+const (
+	EventInsert EventType = iota
+	EventUpdate
+	EventCancel
+)
+
+// BookEvent is a recorded operation on an OrderBook, so that a book can be
+// rebuilt by replaying an event log. Side is only used by EventInsert, and
+// Price and Volume are ignored by EventCancel.
+type BookEvent struct {
+	Seq     uint64
+	Type    EventType
+	OrderId int
+	Side    Side
+	Price   float32
+	Volume  int
+}
+
+// Apply performs the operation recorded by an event and returns any
+// resulting trades.
+func (ob *OrderBook) Apply(ev BookEvent) ([]Trade, error) {
+	switch ev.Type {
+	case EventInsert:
+		return ob.Insert(ev.OrderId, ev.Side, ev.Price, ev.Volume)
+	case EventUpdate:
+		return ob.Update(ev.OrderId, ev.Price, ev.Volume)
+	case EventCancel:
+		return nil, ob.Cancel(ev.OrderId)
+	}
+	return nil, fmt.Errorf("Unknown event type %d", ev.Type)
+}
+
+// ReplayUntil rebuilds the book as it stood at sequence seq by applying, in
+// order, every event in the log up to and including seq to a new book.
+// Events are expected in increasing sequence order; replay stops at the first
+// event past seq. Events that failed when originally applied fail again and
+// are skipped, exactly as they were then.
+func ReplayUntil(events []BookEvent, seq uint64) *OrderBook {
+	ob := NewOrderBook()
+	for _, ev := range events {
+		if ev.Seq > seq {
+			break
+		}
+		ob.Apply(ev)
+	}
+	return ob
+}
@@ -0,0 +1,57 @@
+// Copyright 2024 Lane A. Shetron
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package orderbook
+
+import (
+	"testing"
+)
+
+func TestReplayUntil(t *testing.T) {
+	events := []BookEvent{
+		{1, EventInsert, 1, ASK, 101.0, 5},
+		{2, EventInsert, 2, ASK, 102.0, 5},
+		{3, EventInsert, 3, BID, 99.0, 5},
+		{4, EventInsert, 4, BID, 101.0, 3},
+		{5, EventUpdate, 3, 0, 100.0, 4},
+		{6, EventCancel, 2, 0, 0, 0},
+		{7, EventInsert, 5, BID, 102.0, 10},
+	}
+
+	expected := NewOrderBook()
+	for _, ev := range events[:4] {
+		if _, err := expected.Apply(ev); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	ob := ReplayUntil(events, 4)
+
+	for _, id := range []int{1, 2, 3, 4, 5} {
+		a, aok := expected.Inspect(id)
+		b, bok := ob.Inspect(id)
+		if a != b || aok != bok {
+			t.Errorf("Expected order %d to be %+v (%t), got %+v (%t)", id, a, aok, b, bok)
+		}
+	}
+	if v, _ := ob.Inspect(1); v.Quantity != 2 {
+		t.Errorf("Expected order 1 to have 2 remaining at seq 4, got %d", v.Quantity)
+	}
+
+	ob = ReplayUntil(events, 6)
+	if _, ok := ob.Inspect(2); ok {
+		t.Errorf("Expected order 2 to be canceled by seq 6")
+	}
+	if v, _ := ob.Inspect(3); v.Price != px(100.0) || v.Quantity != 4 {
+		t.Errorf("Expected order 3 to be repriced by seq 6, got %+v", v)
+	}
+}
@@ -0,0 +1,55 @@
+package orderbook
+
+import (
+	"errors"
+	"math"
+)
+
+// Seed fills the book with synthetic liquidity for simulations: levels price
+// levels on each side, each holding a single order of sizePerLevel, at whole
+// multiples of tickSize: the best bid at the highest multiple at or below
+// refPrice, the best ask one tick above it, and further levels a tick apart
+// outwards, so the spread is one tick around refPrice. The orders are given
+// auto-assigned ids as with InsertAuto.
+//
+// An error is returned, and nothing is inserted, if any argument is not
+// positive, if sizePerLevel or any of the seeded prices fails validation,
+// for example because tickSize is not a multiple of the book's tick under
+// TickReject, or if the seeded liquidity would cross orders already in the
+// book.
+func (ob *OrderBook) Seed(refPrice float32, levels int, tickSize float32, sizePerLevel int) error {
+	if levels <= 0 || tickSize <= 0 || sizePerLevel <= 0 {
+		return errors.New("Seed requires positive levels, tick size and size")
+	}
+	// Allow for float32 rounding when refPrice is itself on a tick
+	best := math.Floor(float64(refPrice)/float64(tickSize) + 1e-6)
+	price := func(i int, side Side) float32 {
+		ticks := best - float64(i)
+		if side == ASK {
+			ticks = best + 1 + float64(i)
+		}
+		return float32(ticks * float64(tickSize))
+	}
+	prices := make([]Price, 0, 2*levels)
+	for i := 0; i < levels; i++ {
+		prices = append(prices, float32Price(price(i, BID)), float32Price(price(i, ASK)))
+	}
+	if err := ob.validate(ob.nextAutoId(ob.lastAutoId), sizePerLevel, prices...); err != nil {
+		return err
+	}
+	if ask := ob.AskBook.Peek(); ask != nil && ob.crosses(BID, ob.price(price(0, BID)), ask.Price) {
+		return errors.New("Seeded bids would cross the book")
+	}
+	if bid := ob.BidBook.Peek(); bid != nil && ob.crosses(ASK, ob.price(price(0, ASK)), bid.Price) {
+		return errors.New("Seeded asks would cross the book")
+	}
+
+	for i := 0; i < levels; i++ {
+		for _, side := range []Side{BID, ASK} {
+			ob.lastAutoId = ob.nextAutoId(ob.lastAutoId)
+			ob.match(side, ob.pool.order(ob.lastAutoId, ob.price(price(i, side)), sizePerLevel))
+		}
+	}
+	ob.publish(nil)
+	return nil
+}
@@ -0,0 +1,81 @@
+// Copyright 2024 Lane A. Shetron
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package orderbook
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSeed(t *testing.T) {
+	ob := NewOrderBook()
+	if err := ob.Seed(100.0, 3, 0.5, 10); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := map[Side][]float32{
+		BID: {100.0, 99.5, 99.0},
+		ASK: {100.5, 101.0, 101.5},
+	}
+	for side, prices := range expected {
+		levels := ob.sortedLevels(side)
+		if len(levels) != len(prices) {
+			t.Fatalf("Expected %d %s levels, got %d", len(prices), side, len(levels))
+		}
+		for i, n := range levels {
+			if n.Key != float32Price(prices[i]) || n.Volume() != 10 {
+				t.Errorf("Expected %s level 10 @ %v, got %d @ %v", side, prices[i], n.Volume(), n.Key)
+			}
+		}
+	}
+	if spread := ob.AskBook.Peek().Price - ob.BidBook.Peek().Price; spread != px(0.5) {
+		t.Errorf("Expected a spread of one tick, got %v", spread)
+	}
+
+	if err := ob.Seed(101.0, 1, 0.5, 10); err == nil {
+		t.Errorf("Expected an error seeding across the existing book")
+	}
+	if err := ob.Seed(100.0, 0, 0.5, 10); err == nil {
+		t.Errorf("Expected an error seeding no levels")
+	}
+	if ob.BidBook.Len() != 3 || ob.AskBook.Len() != 3 {
+		t.Errorf("Expected failed seeds to leave the book unchanged")
+	}
+}
+
+func TestSeedOnTicks(t *testing.T) {
+	ob := NewOrderBook()
+	ob.SetTickSize(0.25, TickReject)
+	if err := ob.Seed(100.1, 2, 0.5, 1); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for side, prices := range map[Side][]float32{BID: {100.0, 99.5}, ASK: {100.5, 101.0}} {
+		for i, n := range ob.sortedLevels(side) {
+			if n.Key != float32Price(prices[i]) {
+				t.Errorf("Expected %s level %d at %v, got %v", side, i, prices[i], n.Key)
+			}
+		}
+	}
+
+	// A spacing off the book's tick is rejected, even for the best levels
+	ob = NewOrderBook()
+	ob.SetTickSize(0.25, TickReject)
+	var reject *RejectError
+	if err := ob.Seed(100.0, 2, 0.3, 1); !errors.As(err, &reject) || reject.Reason != RejectOffTick {
+		t.Errorf("Expected off-tick levels to be rejected, got %v", err)
+	}
+	if ob.BidBook.Len() != 0 || ob.AskBook.Len() != 0 {
+		t.Errorf("Expected a rejected seed to leave the book empty")
+	}
+}
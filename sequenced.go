@@ -0,0 +1,49 @@
+package orderbook
+
+// LastAppliedSequence returns the sequence number of the last update accepted
+// by InsertSequenced, UpdateSequenced or CancelSequenced, or zero if none has
+// been applied.
+func (ob *OrderBook) LastAppliedSequence() uint64 {
+	return ob.lastApplied
+}
+
+// sequenced applies op if seq is strictly greater than the last applied
+// sequence. The last applied sequence only advances when op succeeds, so an
+// update that fails can be corrected and resubmitted with the same seq.
+func (ob *OrderBook) sequenced(seq uint64, op func() ([]Trade, error)) ([]Trade, error) {
+	if seq <= ob.lastApplied {
+		return nil, &SequenceError{Seq: seq, LastApplied: ob.lastApplied}
+	}
+	trades, err := op()
+	if err != nil {
+		return trades, err
+	}
+	ob.lastApplied = seq
+	return trades, nil
+}
+
+// InsertSequenced is Insert guarded by a feed sequence number. It returns a
+// *SequenceError without touching the book if seq is not strictly greater
+// than the last applied sequence.
+func (ob *OrderBook) InsertSequenced(seq uint64, orderId int, side Side, price float32, volume int) ([]Trade, error) {
+	return ob.sequenced(seq, func() ([]Trade, error) {
+		return ob.Insert(orderId, side, price, volume)
+	})
+}
+
+// UpdateSequenced is Update guarded by a feed sequence number, as with
+// InsertSequenced.
+func (ob *OrderBook) UpdateSequenced(seq uint64, orderId int, price float32, volume int) ([]Trade, error) {
+	return ob.sequenced(seq, func() ([]Trade, error) {
+		return ob.Update(orderId, price, volume)
+	})
+}
+
+// CancelSequenced is Cancel guarded by a feed sequence number, as with
+// InsertSequenced.
+func (ob *OrderBook) CancelSequenced(seq uint64, orderId int) error {
+	_, err := ob.sequenced(seq, func() ([]Trade, error) {
+		return nil, ob.Cancel(orderId)
+	})
+	return err
+}
@@ -0,0 +1,76 @@
+// Copyright 2024 Lane A. Shetron
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package orderbook
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSequenced(t *testing.T) {
+	ob := NewOrderBook()
+	if _, err := ob.InsertSequenced(1, 1, BID, 99.0, 5); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := ob.InsertSequenced(3, 2, ASK, 101.0, 5); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	before := ob.State()
+
+	tests := []struct {
+		name string
+		op   func() error
+	}{
+		{"out of order update", func() error {
+			_, err := ob.UpdateSequenced(2, 1, 100.0, 8)
+			return err
+		}},
+		{"duplicate insert", func() error {
+			_, err := ob.InsertSequenced(3, 3, ASK, 99.0, 5)
+			return err
+		}},
+		{"stale cancel", func() error {
+			return ob.CancelSequenced(1, 2)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.op()
+			var seqErr *SequenceError
+			if !errors.As(err, &seqErr) {
+				t.Fatalf("Expected a SequenceError, got %v", err)
+			}
+			if seqErr.LastApplied != 3 {
+				t.Errorf("Expected last applied 3, got %d", seqErr.LastApplied)
+			}
+			if diff := DiffSnapshots(before, ob.State()); len(diff) > 0 {
+				t.Errorf("Expected book unchanged, got %v", diff)
+			}
+		})
+	}
+
+	// A failed operation does not consume its sequence number
+	if err := ob.CancelSequenced(4, 42); err == nil {
+		t.Errorf("Expected error cancelling unknown order")
+	}
+	if seq := ob.LastAppliedSequence(); seq != 3 {
+		t.Errorf("Expected last applied 3, got %d", seq)
+	}
+	if err := ob.CancelSequenced(4, 2); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if seq := ob.LastAppliedSequence(); seq != 4 {
+		t.Errorf("Expected last applied 4, got %d", seq)
+	}
+}
@@ -0,0 +1,69 @@
+package orderbook
+
+// SimulateInsert returns the trades that Insert would produce for a new
+// order of volume at price on side, without changing the book. The order is
+// matched exactly as Insert would match it, with the book's matching mode,
+// self-trade prevention and other settings, but against copies of the
+// resting orders it crosses; nothing is removed, rested, published or
+// reported to callbacks. The trades have a TakerOrderId of zero. It returns
+// nil if the order would be rejected.
+func (ob *OrderBook) SimulateInsert(side Side, price float32, volume int) []Trade {
+	// An unused auto id can never collide with a resting order
+	orderId := ob.nextAutoId(ob.lastAutoId)
+	sim := ob.crossingCopy(side, ob.price(price))
+	trades, err := sim.Insert(orderId, side, price, volume)
+	if err != nil {
+		return nil
+	}
+	for i := range trades {
+		trades[i].TakerOrderId = 0
+	}
+	return trades
+}
+
+// crossingCopy returns a scratch book with the same settings as ob, holding
+// copies of the orders on the opposite side of side that price crosses, in
+// the same priority. It has no callbacks or pending orders of any kind.
+func (ob *OrderBook) crossingCopy(side Side, price Price) *OrderBook {
+	sim := *ob
+	sim.AskBook = AskBook{
+		Orders:   AskOrders{tolerance: ob.AskBook.Orders.tolerance},
+		newQueue: ob.AskBook.newQueue,
+	}
+	sim.BidBook = BidBook{
+		Orders:   BidOrders{tolerance: ob.BidBook.Orders.tolerance},
+		newQueue: ob.BidBook.newQueue,
+	}
+	sim.Init()
+	sim.onSelfMatch = nil
+	sim.onStateChange = nil
+	sim.onUpdate = nil
+	sim.onTrade = nil
+	sim.onAdd = nil
+	sim.onCancel = nil
+	sim.onFill = nil
+	sim.events = nil
+	sim.touched = nil
+	sim.pending = nil
+	sim.conditionals = nil
+	sim.stops = nil
+	sim.stopPrices = nil
+	sim.stream = nil
+	sim.trailing = nil
+
+	makerSide := ASK
+	if side == ASK {
+		makerSide = BID
+	}
+	_, makerBook := sim.books(makerSide)
+	for _, n := range ob.sortedLevels(makerSide) {
+		if !ob.crosses(side, price, n.Key) {
+			break
+		}
+		for e := n.Level.Front(); e != nil; e = e.Next() {
+			c := *e.Order()
+			makerBook.Push(&c)
+		}
+	}
+	return &sim
+}
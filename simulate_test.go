@@ -0,0 +1,92 @@
+// Copyright 2024 Lane A. Shetron
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package orderbook
+
+import (
+	"testing"
+)
+
+func TestSimulateInsert(t *testing.T) {
+	setups := map[string]func(ob *OrderBook){
+		"fifo": func(ob *OrderBook) {},
+		"pro-rata": func(ob *OrderBook) {
+			ob.SetMatchingMode(ProRata)
+		},
+		"min residual": func(ob *OrderBook) {
+			ob.SetMinResidual(3, ConsumeResidual)
+		},
+		"sweep distance": func(ob *OrderBook) {
+			ob.SetMaxSweepDistance(0.015)
+		},
+	}
+	orders := []struct {
+		side   Side
+		price  float32
+		volume int
+	}{
+		{BID, 101.0, 12},
+		{BID, 103.0, 40},
+		{BID, 99.0, 5},
+		{ASK, 98.0, 25},
+		{ASK, 95.0, 100},
+	}
+	for name, setup := range setups {
+		t.Run(name, func(t *testing.T) {
+			build := func() *OrderBook {
+				ob := NewOrderBook()
+				setup(ob)
+				ob.Insert(1, ASK, 100.0, 5)
+				ob.InsertOrder(ASK, &Order{OrderId: 2, Price: px(100.0), Quantity: 20, DisplayQuantity: 4})
+				ob.InsertOrder(ASK, &Order{OrderId: 3, Price: px(101.0), Quantity: 6, Hidden: true})
+				ob.Insert(4, ASK, 102.0, 8)
+				ob.Insert(5, BID, 99.0, 10)
+				ob.Insert(6, BID, 98.0, 7)
+				ob.InsertOrder(BID, &Order{OrderId: 7, Price: px(98.0), Quantity: 9, DisplayQuantity: 3})
+				return ob
+			}
+			for _, o := range orders {
+				ob := build()
+				before := ob.State()
+				seq := ob.Sequence()
+				simulated := ob.SimulateInsert(o.side, o.price, o.volume)
+				if diffs := DiffSnapshots(before, ob.State()); diffs != nil || ob.Sequence() != seq {
+					t.Fatalf("Expected the book to be unchanged, got %v", diffs)
+				}
+
+				actual, _ := ob.Insert(100, o.side, o.price, o.volume)
+				if len(simulated) != len(actual) {
+					t.Fatalf("Expected %+v for %s %d at %v, got %+v", actual, o.side, o.volume, o.price, simulated)
+				}
+				for i := range actual {
+					actual[i].TakerOrderId = 0
+					if simulated[i] != actual[i] {
+						t.Errorf("Expected trade %d to be %+v, got %+v", i, actual[i], simulated[i])
+					}
+				}
+			}
+		})
+	}
+
+	// No callbacks fire and rejected orders produce nothing
+	ob := NewOrderBook()
+	ob.Insert(1, ASK, 100.0, 5)
+	ob.OnTrade(func(Trade) { t.Errorf("Expected no trade callbacks") })
+	ob.OnIncrementalUpdate(func(IncrementalUpdate) { t.Errorf("Expected no updates") })
+	if trades := ob.SimulateInsert(BID, 100.0, 3); len(trades) != 1 || trades[0].Volume != 3 {
+		t.Errorf("Expected a trade of 3, got %+v", trades)
+	}
+	if trades := ob.SimulateInsert(BID, 100.0, 0); trades != nil {
+		t.Errorf("Expected nothing for a rejected order, got %+v", trades)
+	}
+}
@@ -0,0 +1,117 @@
+package orderbook
+
+// MatchContinuation is the unfilled remainder of an order being matched in
+// slices. It is returned by MatchSlice and ResumeMatch while the order still
+// crosses the book, and is consumed by passing it to ResumeMatch. While it is
+// outstanding, the order's id is reserved and cannot be used by a new order.
+type MatchContinuation struct {
+	side   Side
+	taker  *Order
+	levels int
+	// ref is the best opposite price when matching began, from which the
+	// book's sweep distance is measured across every slice, and last is the
+	// price of the latest fill, if traded is set.
+	ref    Price
+	last   Price
+	traded bool
+	used   bool
+}
+
+// OrderId returns the id of the order being matched.
+func (c *MatchContinuation) OrderId() int {
+	return c.taker.OrderId
+}
+
+// Remaining returns the quantity of the order that is still unfilled.
+func (c *MatchContinuation) Remaining() int {
+	return c.taker.Quantity
+}
+
+// MatchSlice inserts a new bid or ask like Insert, but matches it against at
+// most levels price levels, bounding the latency of a single call. If the
+// order still crosses the book after that, its remainder is held, neither
+// matched nor resting, in the returned continuation, which ResumeMatch
+// processes in further slices. Otherwise the continuation is nil and any
+// unfilled quantity rests as with Insert. The book's sweep distance applies
+// across all the slices as it does to a single Insert, so the fills across
+// all slices are the same as a single Insert would produce against an
+// unchanged book.
+func (ob *OrderBook) MatchSlice(orderId int, side Side, price float32, volume int, levels int) ([]Trade, *MatchContinuation, error) {
+	if err := ob.validate(orderId, volume, float32Price(price)); err != nil {
+		return nil, nil, err
+	}
+	if err := ob.checkDuplicate(side, orderId); err != nil {
+		return nil, nil, err
+	}
+	taker := ob.pool.order(orderId, ob.price(price), volume)
+	if ob.loading || ob.paused || levels <= 0 {
+		trades := ob.match(side, taker)
+		ob.publish(trades)
+		return trades, nil, nil
+	}
+	c := &MatchContinuation{side: side, taker: taker, levels: levels}
+	makerBook, _ := ob.books(side)
+	if maker := makerBook.Peek(); maker != nil {
+		c.ref = maker.Price
+	}
+	trades, c := ob.matchSlice(c)
+	return trades, c, nil
+}
+
+// ResumeMatch matches the next slice of an order held by a continuation, and
+// returns a new continuation if the order still crosses the book afterwards.
+// Each continuation can be resumed only once; resuming it again does nothing
+// and returns no trades. If the book has been paused since the last slice,
+// the remainder is queued as Insert would queue it.
+func (ob *OrderBook) ResumeMatch(c *MatchContinuation) ([]Trade, *MatchContinuation) {
+	if c.used {
+		return nil, nil
+	}
+	delete(ob.held, c.taker.OrderId)
+	if ob.paused {
+		trades := ob.match(c.side, c.taker)
+		ob.publish(trades)
+		return trades, nil
+	}
+	return ob.matchSlice(c)
+}
+
+func (ob *OrderBook) matchSlice(c *MatchContinuation) ([]Trade, *MatchContinuation) {
+	c.used = true
+	trades, halted := ob.sweep(c.side, c.taker, sweepLimits{
+		maxLevels:   c.levels,
+		maxDistance: ob.maxSweepDistance,
+		hasRef:      true,
+		ref:         c.ref,
+	})
+	if len(trades) > 0 {
+		c.last, c.traded = trades[len(trades)-1].Price, true
+	}
+	if ob.takerCanceled {
+		ob.transition(c.taker, c.taker.state(), OrderCancelled)
+		ob.publish(trades)
+		return trades, nil
+	}
+	// Stopped by the level cap, the order goes on in the next slice; stopped
+	// by the sweep distance, it rests at the furthest price it reached, as
+	// with Insert
+	makerBook, _ := ob.books(c.side)
+	if halted && !beyond(c.ref, makerBook.Peek().Price, ob.maxSweepDistance) {
+		next := *c
+		next.used = false
+		if ob.held == nil {
+			ob.held = make(map[int]bool)
+		}
+		ob.held[c.taker.OrderId] = true
+		ob.publish(trades)
+		return trades, &next
+	}
+	if halted && c.traded {
+		c.taker.Price = c.last
+	}
+	if c.taker.Quantity > 0 {
+		ob.rest(c.side, c.taker)
+	}
+	ob.publish(trades)
+	return trades, nil
+}
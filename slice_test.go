@@ -0,0 +1,136 @@
+// Copyright 2024 Lane A. Shetron
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package orderbook
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMatchSlice(t *testing.T) {
+	setup := func() *OrderBook {
+		ob := NewOrderBook()
+		for i := 0; i < 10; i++ {
+			ob.Insert(2*i, ASK, 100.0+float32(i), 3)
+			ob.Insert(2*i+1, ASK, 100.0+float32(i), 2)
+		}
+		return ob
+	}
+
+	single := setup()
+	expected, _ := single.Insert(100, BID, 107.0, 42)
+
+	sliced := setup()
+	trades, c, err := sliced.MatchSlice(100, BID, 107.0, 42, 3)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	slices := 1
+	for c != nil {
+		if _, ok := sliced.BidBook.Get(100); ok {
+			t.Errorf("Expected the remainder not to rest between slices")
+		}
+		var next []Trade
+		next, c = sliced.ResumeMatch(c)
+		trades = append(trades, next...)
+		slices++
+	}
+	if slices != 3 {
+		t.Errorf("Expected 3 slices of at most 3 levels, got %d", slices)
+	}
+
+	if len(trades) != len(expected) {
+		t.Fatalf("Expected %d trades, got %d", len(expected), len(trades))
+	}
+	for i := range expected {
+		if trades[i] != expected[i] {
+			t.Errorf("Expected trade %+v, got %+v", expected[i], trades[i])
+		}
+	}
+	for _, ob := range []*OrderBook{single, sliced} {
+		if e, ok := ob.BidBook.Get(100); !ok || e.Order().Quantity != 2 {
+			t.Errorf("Expected 2 to rest at 107")
+		}
+		if ob.AskBook.Peek().Price != px(108.0) {
+			t.Errorf("Expected best ask 108, got %v", ob.AskBook.Peek().Price)
+		}
+	}
+}
+
+func TestMatchSliceSweepDistance(t *testing.T) {
+	setup := func() *OrderBook {
+		ob := NewOrderBook()
+		ob.SetMaxSweepDistance(0.05)
+		for i := 0; i < 10; i++ {
+			ob.Insert(i, ASK, 100.0+float32(i), 2)
+		}
+		return ob
+	}
+
+	single := setup()
+	expected, _ := single.Insert(100, BID, 109.0, 30)
+
+	sliced := setup()
+	trades, c, _ := sliced.MatchSlice(100, BID, 109.0, 30, 2)
+	for c != nil {
+		var next []Trade
+		next, c = sliced.ResumeMatch(c)
+		trades = append(trades, next...)
+	}
+	if len(trades) != len(expected) {
+		t.Fatalf("Expected %d trades, got %+v", len(expected), trades)
+	}
+	for i := range expected {
+		if trades[i] != expected[i] {
+			t.Errorf("Expected trade %+v, got %+v", expected[i], trades[i])
+		}
+	}
+	for _, ob := range []*OrderBook{single, sliced} {
+		if v, ok := ob.Inspect(100); !ok || v.Price != px(105.0) || v.Quantity != 18 {
+			t.Errorf("Expected 18 to rest at 105, got %+v", v)
+		}
+	}
+}
+
+func TestMatchContinuationReuse(t *testing.T) {
+	ob := NewOrderBook()
+	for i := 0; i < 4; i++ {
+		ob.Insert(i, ASK, 100.0+float32(i), 2)
+	}
+	_, c, _ := ob.MatchSlice(100, BID, 102.0, 10, 1)
+	if c == nil {
+		t.Fatalf("Expected a continuation")
+	}
+
+	// The held remainder's id is reserved
+	var reject *RejectError
+	if _, err := ob.Insert(100, BID, 90.0, 1); !errors.As(err, &reject) || reject.Reason != RejectDuplicateOrderId {
+		t.Errorf("Expected the held id to be rejected, got %v", err)
+	}
+
+	next := c
+	for next != nil {
+		_, next = ob.ResumeMatch(next)
+	}
+	if v, ok := ob.Inspect(100); !ok || v.Quantity != 4 {
+		t.Fatalf("Expected 4 to rest, got %+v", v)
+	}
+	if trades, again := ob.ResumeMatch(c); len(trades) != 0 || again != nil {
+		t.Errorf("Expected a used continuation to do nothing, got %+v", trades)
+	}
+	if v, _ := ob.Inspect(100); v.Quantity != 4 || ob.TotalVolume(BID) != 4 {
+		t.Errorf("Expected the resting order to be unchanged, got %+v", v)
+	}
+	checkConsistency(t, ob)
+}
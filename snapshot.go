@@ -0,0 +1,154 @@
+package orderbook
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// snapshotOrder is a resting order as persisted by Snapshot.
+type snapshotOrder struct {
+	OrderId         int         `json:"id"`
+	Quantity        int         `json:"quantity"`
+	Filled          int         `json:"filled,omitempty"`
+	Hidden          bool        `json:"hidden,omitempty"`
+	DisplayQuantity int         `json:"displayQuantity,omitempty"`
+	Shown           int         `json:"shown,omitempty"`
+	OwnerId         int         `json:"ownerId,omitempty"`
+	TimeInForce     TimeInForce `json:"timeInForce,omitempty"`
+	// Timestamp is in Unix nanoseconds, or zero if the order has none.
+	Timestamp int64 `json:"timestamp,omitempty"`
+}
+
+// snapshotLevel is a price level with its orders in time priority.
+type snapshotLevel struct {
+	Price  float64         `json:"price"`
+	Orders []snapshotOrder `json:"orders"`
+}
+
+// bookSnapshot is the persisted form of a book, with the levels on each side
+// ordered from best to worst.
+type bookSnapshot struct {
+	Sequence    uint64          `json:"sequence"`
+	LastApplied uint64          `json:"lastApplied,omitempty"`
+	LastAutoId  int             `json:"lastAutoId,omitempty"`
+	Bids        []snapshotLevel `json:"bids"`
+	Asks        []snapshotLevel `json:"asks"`
+}
+
+// Snapshot serializes every resting order as JSON, with all of its
+// attributes and its place in the time queue at its level, along with the
+// book's sequence numbers. Configuration set through the Set* methods and
+// registered callbacks are not included.
+func (ob *OrderBook) Snapshot() ([]byte, error) {
+	return json.Marshal(ob.snapshot())
+}
+
+// Restore replaces the resting orders and sequence numbers of the book with
+// those from a Snapshot, reconstructing the exact time priority of every
+// order. The book's configuration and callbacks are kept, and no events or
+// updates are emitted. An error is returned, and the book is left
+// unchanged, if the snapshot is malformed.
+func (ob *OrderBook) Restore(data []byte) error {
+	var s bookSnapshot
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	return ob.restore(s)
+}
+
+func (ob *OrderBook) snapshot() bookSnapshot {
+	return bookSnapshot{
+		Sequence:    ob.sequence,
+		LastApplied: ob.lastApplied,
+		LastAutoId:  ob.lastAutoId,
+		Bids:        snapshotLevels(ob.sortedLevels(BID)),
+		Asks:        snapshotLevels(ob.sortedLevels(ASK)),
+	}
+}
+
+func snapshotLevels(nodes []*Node) []snapshotLevel {
+	levels := make([]snapshotLevel, 0, len(nodes))
+	for _, n := range nodes {
+		l := snapshotLevel{Price: n.Key.Float(), Orders: make([]snapshotOrder, 0, n.Level.Len())}
+		for e := n.Level.Front(); e != nil; e = e.Next() {
+			o := e.Order()
+			so := snapshotOrder{
+				OrderId:         o.OrderId,
+				Quantity:        o.Quantity,
+				Filled:          o.Filled,
+				Hidden:          o.Hidden,
+				DisplayQuantity: o.DisplayQuantity,
+				Shown:           o.shown,
+				OwnerId:         o.OwnerId,
+				TimeInForce:     o.TimeInForce,
+			}
+			if !o.Timestamp.IsZero() {
+				so.Timestamp = o.Timestamp.UnixNano()
+			}
+			l.Orders = append(l.Orders, so)
+		}
+		levels = append(levels, l)
+	}
+	return levels
+}
+
+func (ob *OrderBook) restore(s bookSnapshot) error {
+	// Check everything before touching the book
+	seen := make(map[int]bool)
+	for _, levels := range [][]snapshotLevel{s.Bids, s.Asks} {
+		for _, l := range levels {
+			if len(l.Orders) == 0 {
+				return fmt.Errorf("Snapshot level %g has no orders", l.Price)
+			}
+			for _, o := range l.Orders {
+				if o.Quantity <= 0 {
+					return fmt.Errorf("Snapshot order %d has no quantity", o.OrderId)
+				}
+				if seen[o.OrderId] {
+					return fmt.Errorf("Snapshot order %d is duplicated", o.OrderId)
+				}
+				seen[o.OrderId] = true
+			}
+		}
+	}
+	if ob.paused {
+		return errors.New("Cannot restore while paused")
+	}
+
+	ob.AskBook.clear()
+	ob.BidBook.clear()
+	ob.BeginLoad()
+	for _, side := range []Side{BID, ASK} {
+		_, book := ob.books(side)
+		levels := s.Bids
+		if side == ASK {
+			levels = s.Asks
+		}
+		for _, l := range levels {
+			for _, so := range l.Orders {
+				o := &Order{
+					Price:           PriceFromFloat(l.Price, 0),
+					Quantity:        so.Quantity,
+					OrderId:         so.OrderId,
+					Filled:          so.Filled,
+					Hidden:          so.Hidden,
+					DisplayQuantity: so.DisplayQuantity,
+					OwnerId:         so.OwnerId,
+					TimeInForce:     so.TimeInForce,
+					shown:           so.Shown,
+				}
+				if so.Timestamp != 0 {
+					o.Timestamp = time.Unix(0, so.Timestamp)
+				}
+				book.Push(o)
+			}
+		}
+	}
+	ob.EndLoad()
+	ob.sequence = s.Sequence
+	ob.lastApplied = s.LastApplied
+	ob.lastAutoId = s.LastAutoId
+	return nil
+}
@@ -0,0 +1,115 @@
+// Copyright 2024 Lane A. Shetron
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package orderbook
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSnapshotRestore(t *testing.T) {
+	clock := time.Unix(1700000000, 0)
+	ob := NewOrderBook()
+	ob.SetClock(func() time.Time { return clock })
+	ob.Insert(1, BID, 99.0, 10)
+	ob.Insert(2, BID, 99.0, 20)
+	ob.Insert(3, BID, 98.5, 5)
+	ob.InsertOrder(BID, &Order{OrderId: 4, Price: px(99.0), Quantity: 7, Hidden: true, OwnerId: 3})
+	ob.Insert(5, ASK, 101.0, 15)
+	ob.InsertOrder(ASK, &Order{OrderId: 6, Price: px(100.5), Quantity: 40, DisplayQuantity: 10})
+	ob.Insert(7, ASK, 101.0, 8)
+	// Partly fill the iceberg and move order 1 to the back of its level
+	ob.Insert(8, BID, 100.5, 4)
+	ob.Update(1, 99.0, 12)
+	ob.InsertAuto(BID, 97.0, 1)
+
+	data, err := ob.Snapshot()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	restored := NewOrderBook()
+	if err := restored.Restore(data); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	bids, asks := ob.DepthSnapshot(10)
+	rBids, rAsks := restored.DepthSnapshot(10)
+	if !equalLevels(bids, rBids) || !equalLevels(asks, rAsks) {
+		t.Errorf("Expected depth %v %v, got %v %v", bids, asks, rBids, rAsks)
+	}
+	if diffs := DiffSnapshots(ob.State(), restored.State()); diffs != nil {
+		t.Errorf("Expected identical state, got %v", diffs)
+	}
+	if restored.Sequence() != ob.Sequence() {
+		t.Errorf("Expected sequence %d, got %d", ob.Sequence(), restored.Sequence())
+	}
+	if v, _ := restored.Inspect(4); !v.Hidden || v.OwnerId != 3 {
+		t.Errorf("Expected order attributes to be restored, got %+v", v)
+	}
+	if id, _, _ := restored.InsertAuto(BID, 97.0, 1); id != -2 {
+		t.Errorf("Expected auto ids to continue at -2, got %d", id)
+	}
+	restored.Cancel(-2)
+
+	for _, side := range []Side{BID, ASK} {
+		var book, rBook Book = &ob.BidBook, &restored.BidBook
+		if side == ASK {
+			book, rBook = &ob.AskBook, &restored.AskBook
+		}
+		for book.Len() > 0 {
+			o, r := book.Pop(), rBook.Pop()
+			if r == nil || o.OrderId != r.OrderId || o.Quantity != r.Quantity || o.visible() != r.visible() || !o.Timestamp.Equal(r.Timestamp) {
+				t.Fatalf("Expected to pop %+v, got %+v", o, r)
+			}
+		}
+		if rBook.Len() != 0 {
+			t.Errorf("Expected no orders left after popping")
+		}
+	}
+}
+
+func TestRestoreInvalid(t *testing.T) {
+	cases := []struct {
+		Name string
+		Data string
+	}{
+		{"malformed", `{"bids": [`},
+		{"duplicate", `{"bids": [{"price": 99, "orders": [{"id": 1, "quantity": 5}]}], "asks": [{"price": 101, "orders": [{"id": 1, "quantity": 5}]}]}`},
+		{"empty order", `{"bids": [{"price": 99, "orders": [{"id": 1, "quantity": 0}]}]}`},
+	}
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			ob := NewOrderBook()
+			ob.Insert(1, BID, 98.0, 5)
+			if err := ob.Restore([]byte(c.Data)); err == nil {
+				t.Errorf("Expected an error")
+			}
+			if v, ok := ob.Inspect(1); !ok || v.Price != px(98.0) {
+				t.Errorf("Expected the book to be unchanged")
+			}
+		})
+	}
+}
+
+func equalLevels(a, b []Level) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,194 @@
+package orderbook
+
+import (
+	"fmt"
+	"sort"
+)
+
+// QueuedOrder is an order's place in the time queue at a price level.
+type QueuedOrder struct {
+	OrderId  int
+	Quantity int
+}
+
+// LevelState is a price level with its orders in time priority.
+type LevelState struct {
+	Price  Price
+	Volume int
+	Orders []QueuedOrder
+}
+
+// BookState is a point-in-time copy of the whole book, with the levels on
+// each side ordered from best to worst. It shares no memory with the book.
+type BookState struct {
+	Bids []LevelState
+	Asks []LevelState
+}
+
+// State returns a copy of the current state of the book. Prices are exact,
+// whatever the display precision, so that distinct levels stay distinct and
+// states can be compared.
+func (ob *OrderBook) State() BookState {
+	return BookState{
+		Bids: ob.levelStates(BID),
+		Asks: ob.levelStates(ASK),
+	}
+}
+
+func (ob *OrderBook) levelStates(side Side) []LevelState {
+	var levels []LevelState
+	for _, n := range ob.sortedLevels(side) {
+		l := LevelState{Price: n.Key, Orders: make([]QueuedOrder, 0, n.Level.Len())}
+		for e := n.Level.Front(); e != nil; e = e.Next() {
+			o := e.Order()
+			l.Orders = append(l.Orders, QueuedOrder{o.OrderId, o.Quantity})
+			l.Volume += o.Quantity
+		}
+		levels = append(levels, l)
+	}
+	return levels
+}
+
+// LevelView is a price level with a copy of each of its orders in time
+// priority.
+type LevelView struct {
+	Price  Price
+	Volume int
+	Orders []OrderView
+}
+
+// BookView is a point-in-time copy of the whole book with every attribute of
+// every resting order, the levels on each side ordered from best to worst.
+// It is made only of values and shares no memory with the book, so it may
+// be read from any goroutine while the book carries on changing.
+type BookView struct {
+	// Sequence is the book's sequence number when the view was taken.
+	Sequence uint64
+	Bids     []LevelView
+	Asks     []LevelView
+}
+
+// BookView returns a deep copy of the current book. As with State, prices
+// are exact rather than rounded to the display precision.
+func (ob *OrderBook) BookView() BookView {
+	return BookView{
+		Sequence: ob.sequence,
+		Bids:     ob.levelViews(BID),
+		Asks:     ob.levelViews(ASK),
+	}
+}
+
+func (ob *OrderBook) levelViews(side Side) []LevelView {
+	nodes := ob.sortedLevels(side)
+	levels := make([]LevelView, 0, len(nodes))
+	for _, n := range nodes {
+		l := LevelView{Price: n.Key, Volume: n.Volume(), Orders: make([]OrderView, 0, n.Level.Len())}
+		for e := n.Level.Front(); e != nil; e = e.Next() {
+			l.Orders = append(l.Orders, view(side, e.Order()))
+		}
+		levels = append(levels, l)
+	}
+	return levels
+}
+
+// DiffSnapshots compares two book states and describes every difference
+// between them: levels present in only one, levels whose volume differs, and
+// levels whose queues differ in their orders or their ordering. It returns
+// nil if the states are identical.
+func DiffSnapshots(a, b BookState) []string {
+	diffs := diffLevels(BID, a.Bids, b.Bids)
+	return append(diffs, diffLevels(ASK, a.Asks, b.Asks)...)
+}
+
+func diffLevels(side Side, a, b []LevelState) []string {
+	var diffs []string
+	index := make(map[Price]LevelState, len(b))
+	for _, l := range b {
+		index[l.Price] = l
+	}
+	for _, l := range a {
+		other, ok := index[l.Price]
+		if !ok {
+			diffs = append(diffs, fmt.Sprintf("%s level %v: only in a", side, l.Price))
+			continue
+		}
+		delete(index, l.Price)
+		if l.Volume != other.Volume {
+			diffs = append(diffs, fmt.Sprintf("%s level %v: volume %d != %d", side, l.Price, l.Volume, other.Volume))
+		}
+		if !equalQueues(l.Orders, other.Orders) {
+			diffs = append(diffs, fmt.Sprintf("%s level %v: queue %v != %v", side, l.Price, l.Orders, other.Orders))
+		}
+	}
+	// Preserve b's ordering for levels missing from a
+	for _, l := range b {
+		if _, ok := index[l.Price]; ok {
+			diffs = append(diffs, fmt.Sprintf("%s level %v: only in b", side, l.Price))
+		}
+	}
+	return diffs
+}
+
+func equalQueues(a, b []QueuedOrder) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// LevelChange is a price level whose aggregate volume differs between two
+// books. OldVolume is zero for a level that was added, and NewVolume is zero
+// for one that was removed.
+type LevelChange struct {
+	Side      Side
+	Price     Price
+	OldVolume int
+	NewVolume int
+}
+
+// Diff compares the aggregate volume at every price level of prev and curr
+// and returns a LevelChange for each level that was added, removed or
+// changed volume, bids then asks, each side ordered from best to worst
+// price. It returns nil if the books have the same levels and volumes.
+func Diff(prev, curr *OrderBook) []LevelChange {
+	changes := diffVolumes(BID, prev.levelVolumes(BID), curr.levelVolumes(BID))
+	return append(changes, diffVolumes(ASK, prev.levelVolumes(ASK), curr.levelVolumes(ASK))...)
+}
+
+func (ob *OrderBook) levelVolumes(side Side) map[Price]int {
+	levels := ob.BidBook.LevelsMap
+	if side == ASK {
+		levels = ob.AskBook.LevelsMap
+	}
+	volumes := make(map[Price]int, len(levels))
+	for price, n := range levels {
+		volumes[price] = n.Volume()
+	}
+	return volumes
+}
+
+func diffVolumes(side Side, prev, curr map[Price]int) []LevelChange {
+	var changes []LevelChange
+	for price, old := range prev {
+		if v := curr[price]; v != old {
+			changes = append(changes, LevelChange{side, price, old, v})
+		}
+	}
+	for price, v := range curr {
+		if _, ok := prev[price]; !ok {
+			changes = append(changes, LevelChange{side, price, 0, v})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		if side == BID {
+			return changes[i].Price > changes[j].Price
+		}
+		return changes[i].Price < changes[j].Price
+	})
+	return changes
+}
@@ -0,0 +1,156 @@
+// Copyright 2024 Lane A. Shetron
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package orderbook
+
+import (
+	"testing"
+)
+
+func TestState(t *testing.T) {
+	ob := NewOrderBook()
+	ob.Insert(1, BID, 99.0, 5)
+	ob.Insert(2, BID, 100.0, 3)
+	ob.Insert(3, BID, 100.0, 4)
+	ob.Insert(4, ASK, 101.0, 2)
+
+	s := ob.State()
+	expected := BookState{
+		Bids: []LevelState{
+			{px(100.0), 7, []QueuedOrder{{2, 3}, {3, 4}}},
+			{px(99.0), 5, []QueuedOrder{{1, 5}}},
+		},
+		Asks: []LevelState{
+			{px(101.0), 2, []QueuedOrder{{4, 2}}},
+		},
+	}
+	if diffs := DiffSnapshots(expected, s); diffs != nil {
+		t.Errorf("Expected identical states, got %v", diffs)
+	}
+}
+
+func TestDiffSnapshots(t *testing.T) {
+	ob := NewOrderBook()
+	ob.Insert(1, BID, 99.0, 5)
+	ob.Insert(2, BID, 100.0, 3)
+	ob.Insert(3, BID, 100.0, 4)
+	ob.Insert(4, ASK, 101.0, 2)
+	before := ob.State()
+
+	ob.Insert(5, ASK, 102.0, 1) // added level
+	ob.Update(4, 101.0, 1)      // volume change
+	ob.Update(2, 100.0, 3)      // reordered queue, same volume
+	ob.Cancel(1)                // removed level
+	after := ob.State()
+
+	diffs := DiffSnapshots(before, after)
+	expected := []string{
+		"bid level 100: queue [{2 3} {3 4}] != [{3 4} {2 3}]",
+		"bid level 99: only in a",
+		"ask level 101: volume 2 != 1",
+		"ask level 101: queue [{4 2}] != [{4 1}]",
+		"ask level 102: only in b",
+	}
+	if len(diffs) != len(expected) {
+		t.Fatalf("Expected %d differences, got %q", len(expected), diffs)
+	}
+	for i := range expected {
+		if diffs[i] != expected[i] {
+			t.Errorf("Expected %q, got %q", expected[i], diffs[i])
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	prev := NewOrderBook()
+	prev.Insert(1, BID, 99.0, 5)
+	prev.Insert(2, BID, 98.0, 5)
+	prev.Insert(3, ASK, 101.0, 5)
+	prev.Insert(4, ASK, 102.0, 5)
+
+	if changes := Diff(prev, prev); changes != nil {
+		t.Errorf("Expected no changes for the same book, got %+v", changes)
+	}
+
+	curr := NewOrderBook()
+	curr.Insert(1, BID, 99.0, 8)
+	curr.Insert(5, BID, 97.0, 2)
+	curr.Insert(3, ASK, 101.0, 5)
+	curr.Insert(6, ASK, 100.5, 1)
+	curr.Insert(4, ASK, 102.0, 3)
+
+	expected := []LevelChange{
+		{BID, px(99.0), 5, 8},
+		{BID, px(98.0), 5, 0},
+		{BID, px(97.0), 0, 2},
+		{ASK, px(100.5), 0, 1},
+		{ASK, px(102.0), 5, 3},
+	}
+	changes := Diff(prev, curr)
+	if len(changes) != len(expected) {
+		t.Fatalf("Expected %d changes, got %+v", len(expected), changes)
+	}
+	for i, c := range changes {
+		if c != expected[i] {
+			t.Errorf("Expected change %d to be %+v, got %+v", i, expected[i], c)
+		}
+	}
+
+	// An empty side reports every level as removed
+	changes = Diff(curr, NewOrderBook())
+	if len(changes) != 5 {
+		t.Errorf("Expected every level to be removed, got %+v", changes)
+	}
+	for _, c := range changes {
+		if c.NewVolume != 0 || c.OldVolume == 0 {
+			t.Errorf("Expected a removal, got %+v", c)
+		}
+	}
+}
+
+func TestBookView(t *testing.T) {
+	ob := NewOrderBook()
+	ob.Insert(1, BID, 99.0, 5)
+	ob.InsertOrder(BID, &Order{OrderId: 2, Price: px(99.0), Quantity: 10, Hidden: true, OwnerId: 7})
+	ob.Insert(3, BID, 98.0, 4)
+	ob.InsertOrder(ASK, &Order{OrderId: 4, Price: px(101.0), Quantity: 20, DisplayQuantity: 5})
+
+	v := ob.BookView()
+	if v.Sequence != ob.Sequence() {
+		t.Errorf("Expected sequence %d, got %d", ob.Sequence(), v.Sequence)
+	}
+	if len(v.Bids) != 2 || v.Bids[0].Price != px(99.0) || v.Bids[0].Volume != 15 || len(v.Bids[0].Orders) != 2 {
+		t.Fatalf("Expected the best bid level at 99 with 2 orders, got %+v", v.Bids)
+	}
+	if o := v.Bids[0].Orders[1]; o.OrderId != 2 || !o.Hidden || o.OwnerId != 7 || o.Side != BID {
+		t.Errorf("Expected order 2 with its attributes, got %+v", o)
+	}
+	if len(v.Asks) != 1 || v.Asks[0].Orders[0].DisplayQuantity != 5 {
+		t.Errorf("Expected the iceberg ask, got %+v", v.Asks)
+	}
+
+	// Changing the book leaves the view as it was
+	ob.Update(1, 99.0, 1)
+	ob.Cancel(3)
+	ob.Insert(5, BID, 101.0, 6)
+	ob.Insert(6, BID, 100.0, 1)
+	if len(v.Bids) != 2 || v.Bids[0].Volume != 15 || v.Bids[0].Orders[0].Quantity != 5 || v.Bids[1].Orders[0].OrderId != 3 {
+		t.Errorf("Expected the view's bids to be unchanged, got %+v", v.Bids)
+	}
+	if v.Asks[0].Volume != 20 || v.Asks[0].Orders[0].Quantity != 20 {
+		t.Errorf("Expected the view's asks to be unchanged, got %+v", v.Asks)
+	}
+	if w := ob.BookView(); w.Asks[0].Orders[0].Quantity != 14 || len(w.Bids) != 2 || w.Bids[0].Price != px(100.0) {
+		t.Errorf("Expected a new view to reflect the changes, got %+v", w)
+	}
+}
@@ -0,0 +1,203 @@
+package orderbook
+
+import (
+	"errors"
+	"sort"
+)
+
+// stopOrder is a stop-limit order held outside the book until the market
+// trades through its stop price.
+type stopOrder struct {
+	side      Side
+	order     *Order
+	stopPrice Price
+}
+
+// triggered reports whether a trade at price activates the stop: at or above
+// the stop price for a buy, at or below it for a sell.
+func (s stopOrder) triggered(price Price) bool {
+	if s.side == BID {
+		return price >= s.stopPrice
+	}
+	return price <= s.stopPrice
+}
+
+// trailingStop is a stop whose stop price follows the market at a fixed
+// offset, moving only in the order's favor. stop is unset until the side it
+// tracks has a best price.
+type trailingStop struct {
+	side   Side
+	order  *Order
+	offset Price
+	stop   Price
+	armed  bool
+}
+
+// InsertStop holds a stop-limit order outside the book until a trade at or
+// through stopPrice: at or above it for a buy stop and at or below it for a
+// sell stop. It is then inserted as a limit order at limitPrice as with
+// Insert, and any trades are reported through the book's updates. Stops are
+// only triggered by trades made after they are submitted. A RejectError is
+// returned if the volume or either price is invalid, or if orderId is
+// already used by a resting or pending order. Checks that depend on the
+// state of the book, such as self-cross rejection, are made when the stop
+// activates, and a stop that fails them then is dropped.
+func (ob *OrderBook) InsertStop(orderId int, side Side, stopPrice, limitPrice float32, volume int) error {
+	if err := ob.validate(orderId, volume, float32Price(stopPrice), float32Price(limitPrice)); err != nil {
+		return err
+	}
+	if ob.inUse(orderId) {
+		return &RejectError{orderId, RejectDuplicateOrderId}
+	}
+	ob.stops = append(ob.stops, stopOrder{side, ob.pool.order(orderId, ob.price(limitPrice), volume), ob.price(stopPrice)})
+	return nil
+}
+
+// InsertTrailingStop holds an order outside the book with a stop price that
+// trails the market by trailOffset and never retreats. A sell stop trails
+// the best bid, rising with it, and triggers once the best bid falls to the
+// stop price; a buy stop trails the best ask, falling with it, and triggers
+// once the best ask rises to the stop price. The stop is recomputed at the
+// end of every operation that changes the book. Once triggered, the order is
+// inserted as with Insert at the best price that triggered it, so that it is
+// marketable, and any remainder rests there. A RejectError is returned if
+// the volume is invalid, if trailOffset is not a positive amount within the
+// range of prices the book accepts, or if orderId is already used by a resting or pending order. The price the
+// order will take is unknown until it triggers, so it is only checked then,
+// and a stop whose order is rejected at that point is dropped.
+func (ob *OrderBook) InsertTrailingStop(orderId int, side Side, trailOffset float32, volume int) error {
+	if err := ob.validate(orderId, volume); err != nil {
+		return err
+	}
+	if !(trailOffset > 0) || float64(trailOffset) >= maxPrice {
+		return &RejectError{orderId, RejectInvalidOffset}
+	}
+	if ob.inUse(orderId) {
+		return &RejectError{orderId, RejectDuplicateOrderId}
+	}
+	ob.trailing = append(ob.trailing, trailingStop{side: side, order: ob.pool.order(orderId, 0, volume), offset: float32Price(trailOffset)})
+	ob.checkTrailing()
+	return nil
+}
+
+// TrailingStopPrice returns the current stop price of a pending trailing
+// stop. ok is false if there is no such order, or if the side of the book it
+// trails has not yet had a best price.
+func (ob *OrderBook) TrailingStopPrice(orderId int) (float32, bool) {
+	for _, s := range ob.trailing {
+		if s.order.OrderId == orderId {
+			return s.stop.float32(), s.armed
+		}
+	}
+	return 0, false
+}
+
+// CancelStop removes a stop or trailing stop order that has not yet been
+// triggered. An error is returned if no such order is pending.
+func (ob *OrderBook) CancelStop(orderId int) error {
+	for i, s := range ob.stops {
+		if s.order.OrderId == orderId {
+			ob.stops = append(ob.stops[:i], ob.stops[i+1:]...)
+			return nil
+		}
+	}
+	for i, s := range ob.trailing {
+		if s.order.OrderId == orderId {
+			ob.trailing = append(ob.trailing[:i], ob.trailing[i+1:]...)
+			return nil
+		}
+	}
+	return errors.New("Stop order does not exist")
+}
+
+// PendingStops returns the number of stop and trailing stop orders waiting
+// to be triggered.
+func (ob *OrderBook) PendingStops() int {
+	return len(ob.stops) + len(ob.trailing)
+}
+
+// checkStops activates the stop orders triggered by each trade in turn. The
+// stops triggered by a single trade are activated in the order the market
+// reached them, buy stops from the lowest stop price and sell stops from the
+// highest, with ties in the order they were submitted. Trades made by the
+// activated orders are checked in turn by the same pass.
+func (ob *OrderBook) checkStops(trades []Trade) {
+	for _, t := range trades {
+		ob.stopPrices = append(ob.stopPrices, t.Price)
+	}
+	if ob.stopping {
+		return
+	}
+	ob.stopping = true
+	defer func() { ob.stopping = false }()
+	for len(ob.stopPrices) > 0 && len(ob.stops) > 0 {
+		price := ob.stopPrices[0]
+		ob.stopPrices = ob.stopPrices[1:]
+
+		var fired []stopOrder
+		pending := ob.stops[:0]
+		for _, s := range ob.stops {
+			if s.triggered(price) {
+				fired = append(fired, s)
+			} else {
+				pending = append(pending, s)
+			}
+		}
+		ob.stops = pending
+		sort.SliceStable(fired, func(i, j int) bool {
+			if fired[i].side != fired[j].side {
+				return fired[i].side == BID
+			}
+			if fired[i].side == BID {
+				return fired[i].stopPrice < fired[j].stopPrice
+			}
+			return fired[i].stopPrice > fired[j].stopPrice
+		})
+		for _, s := range fired {
+			ob.insertOrder(s.side, s.order)
+		}
+	}
+	ob.stopPrices = ob.stopPrices[:0]
+}
+
+// checkTrailing moves every trailing stop up to the current best price and
+// inserts those that are triggered, in the order they were submitted.
+// Inserting one changes the book, so the stops are checked again from the
+// start after each activation.
+func (ob *OrderBook) checkTrailing() {
+	if ob.trailingCheck {
+		return
+	}
+	ob.trailingCheck = true
+	defer func() { ob.trailingCheck = false }()
+	for i := 0; i < len(ob.trailing); {
+		s := &ob.trailing[i]
+		// A sell stop trails the bids and a buy stop the asks
+		best := ob.BidBook.Peek()
+		if s.side == BID {
+			best = ob.AskBook.Peek()
+		}
+		if best == nil {
+			i++
+			continue
+		}
+		triggered := s.armed && ((s.side == ASK && best.Price <= s.stop) || (s.side == BID && best.Price >= s.stop))
+		if !triggered {
+			if s.side == ASK {
+				if stop := best.Price - s.offset; !s.armed || stop > s.stop {
+					s.stop = stop
+				}
+			} else if stop := best.Price + s.offset; !s.armed || stop < s.stop {
+				s.stop = stop
+			}
+			s.armed = true
+			i++
+			continue
+		}
+		o, side := s.order, s.side
+		o.Price = best.Price
+		ob.trailing = append(ob.trailing[:i], ob.trailing[i+1:]...)
+		ob.insertOrder(side, o)
+		i = 0
+	}
+}
@@ -0,0 +1,193 @@
+// Copyright 2024 Lane A. Shetron
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package orderbook
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestInsertStop(t *testing.T) {
+	ob := NewOrderBook()
+	ob.Insert(1, ASK, 101.0, 5)
+	ob.Insert(2, ASK, 102.0, 5)
+	ob.Insert(3, ASK, 103.0, 10)
+	ob.Insert(4, BID, 99.0, 5)
+	ob.Insert(5, BID, 98.0, 5)
+	ob.Insert(6, BID, 97.0, 10)
+
+	// A buy stop above the market and a sell stop below it
+	ob.InsertStop(10, BID, 102.0, 103.0, 4)
+	ob.InsertStop(11, ASK, 98.0, 97.0, 3)
+	var trades []Trade
+	ob.OnTrade(func(t Trade) { trades = append(trades, t) })
+
+	// Trading at 101 does not reach the buy stop
+	ob.Insert(20, BID, 101.0, 5)
+	if ob.PendingStops() != 2 || len(trades) != 1 {
+		t.Fatalf("Expected both stops pending after a trade at 101, got %d pending and %+v", ob.PendingStops(), trades)
+	}
+
+	// Trading at 102 triggers the buy stop, which lifts the rest of 102 and
+	// then trades at 103
+	ob.Insert(21, BID, 102.0, 3)
+	if ob.PendingStops() != 1 {
+		t.Fatalf("Expected the buy stop to trigger, got %d pending", ob.PendingStops())
+	}
+	last := trades[len(trades)-1]
+	if last.TakerOrderId != 10 || last.Price != px(103.0) || last.Volume != 2 {
+		t.Errorf("Expected the buy stop to finish at 103, got %+v", last)
+	}
+
+	// Selling down through 98 triggers the sell stop, which trades at 97
+	trades = nil
+	ob.Insert(22, ASK, 98.0, 10)
+	if ob.PendingStops() != 0 {
+		t.Fatalf("Expected the sell stop to trigger, got %d pending", ob.PendingStops())
+	}
+	last = trades[len(trades)-1]
+	if last.TakerOrderId != 11 || last.Price != px(97.0) || last.Volume != 3 {
+		t.Errorf("Expected the sell stop to trade at 97, got %+v", last)
+	}
+}
+
+func TestStopActivationOrder(t *testing.T) {
+	ob := NewOrderBook()
+	ob.Insert(1, ASK, 100.0, 1)
+	ob.Insert(2, ASK, 110.0, 100)
+	// Submitted out of price order, so activation follows the stop prices
+	ob.InsertStop(10, BID, 100.0, 90.0, 1)
+	ob.InsertStop(11, BID, 98.0, 90.0, 1)
+	ob.InsertStop(12, BID, 99.0, 90.0, 1)
+	ob.InsertStop(13, BID, 105.0, 90.0, 1)
+	ob.InsertStop(14, ASK, 95.0, 120.0, 1)
+
+	var added []int
+	ob.OnAdd(func(o OrderView) {
+		added = append(added, o.OrderId)
+	})
+	ob.Insert(20, BID, 100.0, 1)
+	expected := []int{11, 12, 10}
+	if len(added) != len(expected) {
+		t.Fatalf("Expected %v to activate, got %v", expected, added)
+	}
+	for i := range expected {
+		if added[i] != expected[i] {
+			t.Errorf("Expected activation order %v, got %v", expected, added)
+			break
+		}
+	}
+	if err := ob.CancelStop(13); err != nil || ob.PendingStops() != 1 {
+		t.Errorf("Expected to cancel the untriggered buy stop")
+	}
+	if err := ob.CancelStop(10); err == nil {
+		t.Errorf("Expected an error cancelling an activated stop")
+	}
+}
+
+func TestTrailingStop(t *testing.T) {
+	cases := []struct {
+		Name   string
+		Side   Side
+		Offset float32
+		// Prices at which orders join the tracked side, moving the market in
+		// the stop's favor, and the stop price after each
+		Moves []float32
+		Stops []float32
+		Start float32
+		Fill  float32
+		// The opposite side of the book is set well away from the market
+		Bid, Ask float32
+	}{
+		{"sell", ASK, 2.0, []float32{102.0, 103.0}, []float32{100.0, 101.0}, 98.0, 100.0, 100.0, 110.0},
+		{"buy", BID, 1.5, []float32{100.0, 99.0}, []float32{101.5, 100.5}, 102.5, 101.0, 90.0, 101.0},
+	}
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			ob := NewOrderBook()
+			tracked := BID
+			if c.Side == BID {
+				tracked = ASK
+			}
+			ob.Insert(1, BID, c.Bid, 10)
+			ob.Insert(2, ASK, c.Ask, 10)
+			ob.InsertTrailingStop(10, c.Side, c.Offset, 5)
+			if s, _ := ob.TrailingStopPrice(10); s != c.Start {
+				t.Errorf("Expected to start at %g, got %g", c.Start, s)
+			}
+
+			for i, price := range c.Moves {
+				ob.Insert(20+i, tracked, price, 10)
+				if s, _ := ob.TrailingStopPrice(10); s != c.Stops[i] {
+					t.Errorf("Expected the stop to move to %g, got %g", c.Stops[i], s)
+				}
+			}
+			// Retreating part way does not move the stop back
+			ob.Cancel(21)
+			if s, _ := ob.TrailingStopPrice(10); s != c.Stops[1] || ob.PendingStops() != 1 {
+				t.Errorf("Expected the stop to hold at %g, got %g", c.Stops[1], s)
+			}
+
+			// The reversal to the original touch triggers it
+			var trades []Trade
+			ob.OnTrade(func(t Trade) { trades = append(trades, t) })
+			ob.Cancel(20)
+			if ob.PendingStops() != 0 {
+				t.Fatalf("Expected the stop to trigger")
+			}
+			if len(trades) != 1 || trades[0].TakerOrderId != 10 || trades[0].Price != float32Price(c.Fill) || trades[0].Volume != 5 {
+				t.Errorf("Expected the stop to fill 5 at %g, got %+v", c.Fill, trades)
+			}
+		})
+	}
+}
+
+func TestStopOrderIds(t *testing.T) {
+	ob := NewOrderBook()
+	ob.Insert(1, BID, 99.0, 5)
+	ob.InsertStop(2, BID, 105.0, 105.0, 5)
+	for _, id := range []int{1, 2} {
+		var reject *RejectError
+		if err := ob.InsertStop(id, ASK, 90.0, 90.0, 1); !errors.As(err, &reject) || reject.Reason != RejectDuplicateOrderId {
+			t.Errorf("Expected a stop with id %d to be rejected as a duplicate, got %v", id, err)
+		}
+	}
+	if ob.PendingStops() != 1 {
+		t.Errorf("Expected 1 pending stop, got %d", ob.PendingStops())
+	}
+}
+
+func TestTrailingStopValidation(t *testing.T) {
+	ob := NewOrderBook()
+	for _, offset := range []float32{0, -1.0, float32(math.NaN()), float32(math.Inf(1))} {
+		var reject *RejectError
+		if err := ob.InsertTrailingStop(1, ASK, offset, 5); !errors.As(err, &reject) || reject.Reason != RejectInvalidOffset {
+			t.Errorf("Expected offset %v to be rejected, got %v", offset, err)
+		}
+	}
+
+	ob.Insert(1, BID, 99.0, 5)
+	ob.InsertStop(2, BID, 105.0, 105.0, 5)
+	ob.InsertTrailingStop(3, ASK, 1.0, 5)
+	for _, id := range []int{1, 2, 3} {
+		var reject *RejectError
+		if err := ob.InsertTrailingStop(id, BID, 1.0, 1); !errors.As(err, &reject) || reject.Reason != RejectDuplicateOrderId {
+			t.Errorf("Expected a trailing stop with id %d to be rejected as a duplicate, got %v", id, err)
+		}
+	}
+	if ob.PendingStops() != 2 {
+		t.Errorf("Expected 2 pending stops, got %d", ob.PendingStops())
+	}
+}
@@ -0,0 +1,43 @@
+package orderbook
+
+// STPMode selects how self-trade prevention resolves an incoming order that
+// would trade against a resting order from the same account.
+type STPMode uint8
+
+const (
+	// STPNone allows orders from the same account to trade.
+	STPNone STPMode = iota
+	// CancelResting cancels the resting order and continues matching.
+	CancelResting
+	// CancelTaker cancels the rest of the incoming order; it keeps any
+	// trades it has already made but does not rest.
+	CancelTaker
+	// CancelBoth cancels the resting order and the rest of the incoming
+	// order.
+	CancelBoth
+)
+
+// SetSelfTradePrevention selects how orders from the same account are kept
+// from trading with each other, by comparing OwnerId. Orders without an
+// OwnerId are never affected. The default is STPNone.
+func (ob *OrderBook) SetSelfTradePrevention(mode STPMode) {
+	ob.stpMode = mode
+}
+
+// selfTrade applies self-trade prevention to a maker about to be matched
+// against the taker, and reports whether the maker must be passed over. If
+// the taker is to be canceled, takerCanceled is set and matching must stop.
+func (ob *OrderBook) selfTrade(book Book, maker *Order, taker *Order) bool {
+	if ob.stpMode == STPNone || maker.OwnerId == 0 || maker.OwnerId != taker.OwnerId {
+		return false
+	}
+	if ob.stpMode == CancelResting || ob.stpMode == CancelBoth {
+		book.Remove(maker.OrderId)
+		ob.touch(book.Side(), maker.Price)
+		ob.transition(maker, maker.state(), OrderCancelled)
+	}
+	if ob.stpMode == CancelTaker || ob.stpMode == CancelBoth {
+		ob.takerCanceled = true
+	}
+	return true
+}
@@ -0,0 +1,107 @@
+// Copyright 2024 Lane A. Shetron
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package orderbook
+
+import (
+	"testing"
+)
+
+func TestSelfTradePrevention(t *testing.T) {
+	cases := []struct {
+		Name         string
+		Mode         STPMode
+		Filled       int
+		TakerResting int
+		// OwnResting reports whether the taker account's resting ask is left
+		OwnResting bool
+		TakerState OrderState
+	}{
+		{"none", STPNone, 30, 0, false, OrderFilled},
+		// The own ask is canceled and the taker goes on to fill against order 3
+		{"cancel resting", CancelResting, 25, 5, false, OrderPartiallyFilled},
+		{"cancel taker", CancelTaker, 10, 0, true, OrderCancelled},
+		{"cancel both", CancelBoth, 10, 0, false, OrderCancelled},
+	}
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			ob := NewOrderBook()
+			ob.SetSelfTradePrevention(c.Mode)
+			ob.InsertOrder(ASK, &Order{Price: px(100.0), Quantity: 10, OrderId: 1, OwnerId: 8})
+			ob.InsertOrder(ASK, &Order{Price: px(100.0), Quantity: 10, OrderId: 2, OwnerId: 7})
+			ob.InsertOrder(ASK, &Order{Price: px(101.0), Quantity: 15, OrderId: 3, OwnerId: 9})
+			var states []OrderState
+			ob.OnOrderStateChange(func(orderId int, old, new OrderState) {
+				if orderId == 4 {
+					states = append(states, new)
+				}
+			})
+
+			trades, err := ob.InsertOrder(BID, &Order{Price: px(101.0), Quantity: 30, OrderId: 4, OwnerId: 7})
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			filled := 0
+			for _, trade := range trades {
+				if c.Mode != STPNone && trade.MakerOrderId == 2 {
+					t.Errorf("Expected no trade against own order, got %+v", trade)
+				}
+				filled += trade.Volume
+			}
+			if filled != c.Filled {
+				t.Errorf("Expected %d filled, got %d", c.Filled, filled)
+			}
+			if _, ok := ob.Inspect(2); ok != c.OwnResting {
+				t.Errorf("Expected own resting order present %v, got %v", c.OwnResting, ok)
+			}
+			resting := 0
+			if o, ok := ob.Inspect(4); ok {
+				resting = o.Quantity
+			}
+			if resting != c.TakerResting {
+				t.Errorf("Expected %d of the taker resting, got %d", c.TakerResting, resting)
+			}
+			if len(states) == 0 || states[len(states)-1] != c.TakerState {
+				t.Errorf("Expected taker to end in state %v, got %v", c.TakerState, states)
+			}
+		})
+	}
+}
+
+func TestSelfTradePreventionProRata(t *testing.T) {
+	ob := NewOrderBook()
+	ob.SetMatchingMode(ProRataPriority)
+	ob.SetSelfTradePrevention(CancelResting)
+	ob.InsertOrder(ASK, &Order{Price: px(100.0), Quantity: 10, OrderId: 1, OwnerId: 7})
+	ob.InsertOrder(ASK, &Order{Price: px(100.0), Quantity: 10, OrderId: 2, OwnerId: 8})
+	ob.InsertOrder(ASK, &Order{Price: px(100.0), Quantity: 10, OrderId: 3, OwnerId: 7})
+	ob.InsertOrder(ASK, &Order{Price: px(100.0), Quantity: 10, OrderId: 4, OwnerId: 9})
+
+	trades, _ := ob.InsertOrder(BID, &Order{Price: px(100.0), Quantity: 15, OrderId: 5, OwnerId: 7})
+	filled := 0
+	for _, trade := range trades {
+		if trade.MakerOrderId == 1 || trade.MakerOrderId == 3 {
+			t.Errorf("Expected no trade against own order, got %+v", trade)
+		}
+		filled += trade.Volume
+	}
+	if filled != 15 {
+		t.Errorf("Expected 15 filled, got %d", filled)
+	}
+	if _, ok := ob.Inspect(1); ok {
+		t.Errorf("Expected own order 1 to be canceled")
+	}
+	if _, ok := ob.Inspect(3); ok {
+		t.Errorf("Expected own order 3 to be canceled")
+	}
+}
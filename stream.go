@@ -0,0 +1,81 @@
+package orderbook
+
+// tradeStream holds the state of an InsertStream while it is matching.
+type tradeStream struct {
+	yield  func(Trade) bool
+	last   Trade
+	trades int
+}
+
+// record adds a trade to those of the current match, or hands it to the
+// yield function of a streaming insert instead of collecting it. If yield
+// returns false the taker is canceled, which stops the match.
+func (ob *OrderBook) record(trades []Trade, t Trade) []Trade {
+	s := ob.stream
+	if s == nil {
+		return append(trades, t)
+	}
+	s.last = t
+	s.trades++
+	// Stop orders only need the trade prices
+	if len(ob.stops) > 0 {
+		ob.stopPrices = append(ob.stopPrices, t.Price)
+	}
+	if !s.yield(t) {
+		ob.takerCanceled = true
+	}
+	return trades
+}
+
+// InsertStream inserts a new bid or ask like Insert, but passes each trade to
+// yield as it happens rather than collecting them, so that a large crossing
+// order does not build up a slice of every trade. yield is called during
+// matching, before any of the book's callbacks and while the book is part
+// way through the insert, so it must not call back into the book.
+//
+// If yield returns false, matching stops straight after that trade, even
+// part way through a price level, and any unfilled quantity is canceled
+// rather than rested, since it may still cross the book. The order is
+// reported as canceled to OnCancel and OnStateChange. Otherwise any
+// unfilled quantity rests as with Insert.
+//
+// The trades are not included in the IncrementalUpdate published for the
+// insert, though OnTrade and OnFill are still called for each of them and
+// stop orders are triggered by them as usual. A RejectError is returned if
+// the order fails validation, as with Insert.
+func (ob *OrderBook) InsertStream(orderId int, side Side, price float32, volume int, yield func(Trade) bool) error {
+	if err := ob.validate(orderId, volume, float32Price(price)); err != nil {
+		return err
+	}
+	if err := ob.checkDuplicate(side, orderId); err != nil {
+		return err
+	}
+	taker := ob.pool.order(orderId, ob.price(price), volume)
+	if ob.rejectSelfCross && ob.selfCrosses(side, taker) {
+		return &RejectError{orderId, RejectSelfCross}
+	}
+	// Nothing trades while loading or paused
+	if ob.loading || ob.paused {
+		ob.publish(ob.match(side, taker))
+		return nil
+	}
+
+	s := &tradeStream{yield: yield}
+	ob.stream = s
+	_, halted := ob.sweep(side, taker, sweepLimits{maxDistance: ob.maxSweepDistance})
+	ob.stream = nil
+	if taker.Quantity > 0 {
+		if ob.takerCanceled {
+			ob.transition(taker, taker.state(), OrderCancelled)
+		} else {
+			// As with match, an order stopped by the sweep distance
+			// rests at the furthest price it reached
+			if halted && s.trades > 0 {
+				taker.Price = s.last.Price
+			}
+			ob.rest(side, taker)
+		}
+	}
+	ob.publish(nil)
+	return nil
+}
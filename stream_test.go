@@ -0,0 +1,124 @@
+// Copyright 2024 Lane A. Shetron
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package orderbook
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestInsertStream(t *testing.T) {
+	setup := func() *OrderBook {
+		ob := NewOrderBook()
+		ob.Insert(1, ASK, 101.0, 5)
+		ob.Insert(2, ASK, 101.0, 5)
+		ob.Insert(3, ASK, 102.0, 10)
+		ob.Insert(4, ASK, 104.0, 10)
+		return ob
+	}
+
+	// The streamed trades are the same as Insert returns, one call each
+	expected, _ := setup().Insert(10, BID, 103.0, 25)
+	ob := setup()
+	var streamed []Trade
+	err := ob.InsertStream(10, BID, 103.0, 25, func(t Trade) bool {
+		streamed = append(streamed, t)
+		return true
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !reflect.DeepEqual(streamed, expected) {
+		t.Errorf("Expected trades %+v, got %+v", expected, streamed)
+	}
+	// The remainder rests as with Insert
+	if o, side, ok := ob.GetOrder(10); !ok || side != BID || o.Quantity != 5 || o.Price != px(103.0) {
+		t.Errorf("Expected 5 left resting at 103, got %+v", o)
+	}
+	checkConsistency(t, ob)
+
+	if err := ob.InsertStream(11, BID, 103.0, 0, func(Trade) bool { return true }); err == nil {
+		t.Errorf("Expected an invalid order to be rejected")
+	}
+}
+
+func TestInsertStreamStop(t *testing.T) {
+	ob := NewOrderBook()
+	ob.Insert(1, ASK, 101.0, 5)
+	ob.Insert(2, ASK, 101.0, 5)
+	ob.Insert(3, ASK, 102.0, 10)
+	var cancelled []int
+	ob.OnCancel(func(orderId int) { cancelled = append(cancelled, orderId) })
+	var updates []IncrementalUpdate
+	ob.OnIncrementalUpdate(func(u IncrementalUpdate) { updates = append(updates, u) })
+
+	// Stopping after the first trade leaves the rest of the level alone
+	calls := 0
+	ob.InsertStream(10, BID, 102.0, 15, func(t Trade) bool {
+		calls++
+		return false
+	})
+	if calls != 1 {
+		t.Errorf("Expected yield to be called once, got %d", calls)
+	}
+	if _, _, ok := ob.GetOrder(10); ok {
+		t.Errorf("Expected the remainder not to rest")
+	}
+	if !reflect.DeepEqual(cancelled, []int{10}) {
+		t.Errorf("Expected the remainder to be canceled, got %v", cancelled)
+	}
+	if ob.TotalVolume(ASK) != 15 || ob.OrderCount(ASK) != 2 {
+		t.Errorf("Expected 15 left on 2 asks, got %d on %d", ob.TotalVolume(ASK), ob.OrderCount(ASK))
+	}
+	if len(updates) != 1 || len(updates[0].Trades) != 0 || len(updates[0].Asks) != 1 {
+		t.Errorf("Expected one update with the ask level and no trades, got %+v", updates)
+	}
+	checkConsistency(t, ob)
+
+	// Stopping on the trade that fills the order cancels nothing
+	cancelled = nil
+	ob.InsertStream(11, BID, 102.0, 5, func(t Trade) bool { return false })
+	if len(cancelled) != 0 || ob.TotalVolume(ASK) != 10 {
+		t.Errorf("Expected a full fill, got %v canceled and %d left", cancelled, ob.TotalVolume(ASK))
+	}
+
+	// Streamed trades still trigger stop orders
+	ob.InsertStop(20, BID, 102.0, 102.0, 4)
+	ob.InsertStream(12, BID, 102.0, 1, func(t Trade) bool { return true })
+	if ob.PendingStops() != 0 || ob.TotalVolume(ASK) != 5 {
+		t.Errorf("Expected the stop to trigger, got %d pending and %d left", ob.PendingStops(), ob.TotalVolume(ASK))
+	}
+	checkConsistency(t, ob)
+}
+
+func TestInsertStreamProRata(t *testing.T) {
+	ob := NewOrderBook()
+	ob.SetMatchingMode(ProRata)
+	ob.Insert(1, ASK, 101.0, 10)
+	ob.Insert(2, ASK, 101.0, 30)
+
+	// The stop takes effect part way through a pro rata allocation
+	var streamed []Trade
+	ob.InsertStream(10, BID, 101.0, 20, func(t Trade) bool {
+		streamed = append(streamed, t)
+		return false
+	})
+	if len(streamed) != 1 || streamed[0].MakerOrderId != 1 || streamed[0].Volume != 5 {
+		t.Errorf("Expected a single trade of 5 with order 1, got %+v", streamed)
+	}
+	if ob.TotalVolume(ASK) != 35 {
+		t.Errorf("Expected 35 left, got %d", ob.TotalVolume(ASK))
+	}
+	checkConsistency(t, ob)
+}
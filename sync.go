@@ -0,0 +1,893 @@
+package orderbook
+
+import (
+	"sync"
+	"time"
+)
+
+// SyncOrderBook is an OrderBook that is safe for concurrent use. It embeds
+// the book it guards and wraps every one of its methods, each taking the
+// lock, exclusively for operations that change the book and shared for
+// queries. Where an OrderBook method would return a resting order, it
+// returns a copy, and trades are copied so that they are not shared with the
+// book's callbacks. The embedded book's fields, such as AskBook and BidBook,
+// are not guarded, and may only be used inside WithLock.
+//
+// Callbacks registered on the book, the clock and the level queue factory
+// are called while the lock is held, on whichever goroutine made the change.
+// They must not call back into the SyncOrderBook, which would deadlock; a
+// callback that needs to act on the book can hand the work to another
+// goroutine.
+type SyncOrderBook struct {
+	*OrderBook
+	mu sync.RWMutex
+}
+
+// NewSyncOrderBook creates an empty SyncOrderBook.
+func NewSyncOrderBook() *SyncOrderBook {
+	return &SyncOrderBook{OrderBook: NewOrderBook()}
+}
+
+// WithLock calls fn with exclusive access to the embedded book, for running
+// several operations atomically or reaching the book's sides directly. fn
+// must not keep the book once it returns.
+func (s *SyncOrderBook) WithLock(fn func(ob *OrderBook)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(s.OrderBook)
+}
+
+// SetRejectSelfCross takes the lock and calls OrderBook.SetRejectSelfCross.
+func (s *SyncOrderBook) SetRejectSelfCross(enabled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.OrderBook.SetRejectSelfCross(enabled)
+}
+
+// SetDisplayPrecision takes the lock and calls OrderBook.SetDisplayPrecision.
+func (s *SyncOrderBook) SetDisplayPrecision(decimals int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.OrderBook.SetDisplayPrecision(decimals)
+}
+
+// SetLevelQueue takes the lock and calls OrderBook.SetLevelQueue. newQueue
+// is called with the lock held, so it must not call back into the
+// SyncOrderBook.
+func (s *SyncOrderBook) SetLevelQueue(newQueue func() LevelQueue) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.OrderBook.SetLevelQueue(newQueue)
+}
+
+// SetMaxOrderQuantity takes the lock and calls OrderBook.SetMaxOrderQuantity.
+func (s *SyncOrderBook) SetMaxOrderQuantity(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.OrderBook.SetMaxOrderQuantity(n)
+}
+
+// SetLotSize takes the lock and calls OrderBook.SetLotSize.
+func (s *SyncOrderBook) SetLotSize(min, step int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.OrderBook.SetLotSize(min, step)
+}
+
+// SetMaxLevels takes the lock and calls OrderBook.SetMaxLevels.
+func (s *SyncOrderBook) SetMaxLevels(side Side, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.OrderBook.SetMaxLevels(side, n)
+}
+
+// SetAllowNegativePrices takes the lock and calls
+// OrderBook.SetAllowNegativePrices.
+func (s *SyncOrderBook) SetAllowNegativePrices(allow bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.OrderBook.SetAllowNegativePrices(allow)
+}
+
+// SetMatchingMode takes the lock and calls OrderBook.SetMatchingMode.
+func (s *SyncOrderBook) SetMatchingMode(mode MatchingMode) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.OrderBook.SetMatchingMode(mode)
+}
+
+// SetPriceTolerance takes the lock and calls OrderBook.SetPriceTolerance.
+func (s *SyncOrderBook) SetPriceTolerance(tolerance float32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.OrderBook.SetPriceTolerance(tolerance)
+}
+
+// SetClock takes the lock and calls OrderBook.SetClock. The clock is called
+// with the lock held, so it must not call back into the SyncOrderBook.
+func (s *SyncOrderBook) SetClock(clock func() time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.OrderBook.SetClock(clock)
+}
+
+// SetMaxSweepDistance takes the lock and calls OrderBook.SetMaxSweepDistance.
+func (s *SyncOrderBook) SetMaxSweepDistance(fraction float32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.OrderBook.SetMaxSweepDistance(fraction)
+}
+
+// SetHiddenPriority takes the lock and calls OrderBook.SetHiddenPriority.
+func (s *SyncOrderBook) SetHiddenPriority(p HiddenPriority) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.OrderBook.SetHiddenPriority(p)
+}
+
+// SetMinResidual takes the lock and calls OrderBook.SetMinResidual.
+func (s *SyncOrderBook) SetMinResidual(qty int, policy ResidualPolicy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.OrderBook.SetMinResidual(qty, policy)
+}
+
+// SetProRataRounding takes the lock and calls OrderBook.SetProRataRounding.
+func (s *SyncOrderBook) SetProRataRounding(policy RoundingPolicy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.OrderBook.SetProRataRounding(policy)
+}
+
+// SetQuoteMode takes the lock and calls OrderBook.SetQuoteMode.
+func (s *SyncOrderBook) SetQuoteMode(mode QuoteMode) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.OrderBook.SetQuoteMode(mode)
+}
+
+// SetSelfTradePrevention takes the lock and calls
+// OrderBook.SetSelfTradePrevention.
+func (s *SyncOrderBook) SetSelfTradePrevention(mode STPMode) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.OrderBook.SetSelfTradePrevention(mode)
+}
+
+// SetTickSize takes the lock and calls OrderBook.SetTickSize.
+func (s *SyncOrderBook) SetTickSize(tick float64, policy TickPolicy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.OrderBook.SetTickSize(tick, policy)
+}
+
+// OnOrderStateChange registers fn as OrderBook.OnOrderStateChange does. fn
+// is called with the lock held, so it must not call back into the
+// SyncOrderBook.
+func (s *SyncOrderBook) OnOrderStateChange(fn func(orderId int, old, new OrderState)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.OrderBook.OnOrderStateChange(fn)
+}
+
+// OnSelfMatch registers fn as OrderBook.OnSelfMatch does. fn is called with
+// the lock held, so it must not call back into the SyncOrderBook.
+func (s *SyncOrderBook) OnSelfMatch(fn func(orderId int)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.OrderBook.OnSelfMatch(fn)
+}
+
+// OnTrade registers fn as OrderBook.OnTrade does. fn is called with the
+// lock held, so it must not call back into the SyncOrderBook.
+func (s *SyncOrderBook) OnTrade(fn func(Trade)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.OrderBook.OnTrade(fn)
+}
+
+// OnAdd registers fn as OrderBook.OnAdd does. fn is called with the
+// lock held, so it must not call back into the SyncOrderBook.
+func (s *SyncOrderBook) OnAdd(fn func(OrderView)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.OrderBook.OnAdd(fn)
+}
+
+// OnCancel registers fn as OrderBook.OnCancel does. fn is called with the
+// lock held, so it must not call back into the SyncOrderBook.
+func (s *SyncOrderBook) OnCancel(fn func(orderId int)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.OrderBook.OnCancel(fn)
+}
+
+// OnFill registers fn as OrderBook.OnFill does. fn is called with the
+// lock held, so it must not call back into the SyncOrderBook.
+func (s *SyncOrderBook) OnFill(fn func(orderId int, price float32, quantity int, remaining int)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.OrderBook.OnFill(fn)
+}
+
+// OnIncrementalUpdate registers fn as OrderBook.OnIncrementalUpdate does. fn
+// is called with the lock held, so it must not call back into the
+// SyncOrderBook.
+func (s *SyncOrderBook) OnIncrementalUpdate(fn func(IncrementalUpdate)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.OrderBook.OnIncrementalUpdate(fn)
+}
+
+// Init takes the lock and calls OrderBook.Init.
+func (s *SyncOrderBook) Init() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.OrderBook.Init()
+}
+
+// BeginLoad takes the lock and calls OrderBook.BeginLoad.
+func (s *SyncOrderBook) BeginLoad() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.OrderBook.BeginLoad()
+}
+
+// EndLoad takes the lock and calls OrderBook.EndLoad.
+func (s *SyncOrderBook) EndLoad() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.OrderBook.EndLoad()
+}
+
+// own copies trades so that the caller's slice is not shared with the
+// updates passed to the book's callbacks, which may run on other goroutines.
+func own(trades []Trade) []Trade {
+	if trades == nil {
+		return nil
+	}
+	return append(make([]Trade, 0, len(trades)), trades...)
+}
+
+// Insert takes the lock and calls OrderBook.Insert, returning a copy
+// of the trades.
+func (s *SyncOrderBook) Insert(orderId int, side Side, price float32, volume int) ([]Trade, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	trades, err := s.OrderBook.Insert(orderId, side, price, volume)
+	return own(trades), err
+}
+
+// InsertOrder takes the lock and calls OrderBook.InsertOrder, returning a
+// copy of the trades.
+func (s *SyncOrderBook) InsertOrder(side Side, o *Order) ([]Trade, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	trades, err := s.OrderBook.InsertOrder(side, o)
+	return own(trades), err
+}
+
+// InsertAuto takes the lock and calls OrderBook.InsertAuto, returning a copy
+// of the trades.
+func (s *SyncOrderBook) InsertAuto(side Side, price float32, volume int) (int, []Trade, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	orderId, trades, err := s.OrderBook.InsertAuto(side, price, volume)
+	return orderId, own(trades), err
+}
+
+// InsertStream calls yield with the lock held, so yield must not call back
+// into the SyncOrderBook.
+func (s *SyncOrderBook) InsertStream(orderId int, side Side, price float32, volume int, yield func(Trade) bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.OrderBook.InsertStream(orderId, side, price, volume, yield)
+}
+
+// InsertMaxAvgPrice takes the lock and calls OrderBook.InsertMaxAvgPrice,
+// returning a copy of the trades.
+func (s *SyncOrderBook) InsertMaxAvgPrice(orderId int, side Side, price float32, volume int, maxAvgPrice float32) ([]Trade, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	trades, err := s.OrderBook.InsertMaxAvgPrice(orderId, side, price, volume, maxAvgPrice)
+	return own(trades), err
+}
+
+// Submit takes the lock and calls OrderBook.Submit, returning a copy
+// of the trades.
+func (s *SyncOrderBook) Submit(side Side, o *Order) (InsertReport, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, err := s.OrderBook.Submit(side, o)
+	r.Trades = own(r.Trades)
+	return r, err
+}
+
+// Update takes the lock and calls OrderBook.Update, returning a copy
+// of the trades.
+func (s *SyncOrderBook) Update(orderId int, price float32, volume int) ([]Trade, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	trades, err := s.OrderBook.Update(orderId, price, volume)
+	return own(trades), err
+}
+
+// Cancel takes the lock and calls OrderBook.Cancel.
+func (s *SyncOrderBook) Cancel(orderId int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.OrderBook.Cancel(orderId)
+}
+
+// CancelAndReturn takes the lock and calls OrderBook.CancelAndReturn.
+func (s *SyncOrderBook) CancelAndReturn(orderId int) (*Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.OrderBook.CancelAndReturn(orderId)
+}
+
+// CancelBatch takes the lock and calls OrderBook.CancelBatch.
+func (s *SyncOrderBook) CancelBatch(ids []int, mode BatchMode) ([]int, []error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.OrderBook.CancelBatch(ids, mode)
+}
+
+// CancelAllForOwner takes the lock and calls OrderBook.CancelAllForOwner.
+func (s *SyncOrderBook) CancelAllForOwner(ownerId int) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.OrderBook.CancelAllForOwner(ownerId)
+}
+
+// Apply takes the lock and calls OrderBook.Apply, returning a copy
+// of the trades.
+func (s *SyncOrderBook) Apply(ev BookEvent) ([]Trade, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	trades, err := s.OrderBook.Apply(ev)
+	return own(trades), err
+}
+
+// Pause takes the lock and calls OrderBook.Pause.
+func (s *SyncOrderBook) Pause() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.OrderBook.Pause()
+}
+
+// Resume takes the lock and calls OrderBook.Resume, returning a copy
+// of the trades.
+func (s *SyncOrderBook) Resume() []Trade {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return own(s.OrderBook.Resume())
+}
+
+// Replace takes the lock and calls OrderBook.Replace, returning a copy
+// of the trades.
+func (s *SyncOrderBook) Replace(orderId int, newPrice float32, newVolume int) (Order, []Trade, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old, trades, err := s.OrderBook.Replace(orderId, newPrice, newVolume)
+	return old, own(trades), err
+}
+
+// Reduce takes the lock and calls OrderBook.Reduce.
+func (s *SyncOrderBook) Reduce(orderId int, by int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.OrderBook.Reduce(orderId, by)
+}
+
+// Restore takes the lock and calls OrderBook.Restore.
+func (s *SyncOrderBook) Restore(data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.OrderBook.Restore(data)
+}
+
+// LoadOrders takes the lock and calls OrderBook.LoadOrders.
+func (s *SyncOrderBook) LoadOrders(side Side, orders []Order) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.OrderBook.LoadOrders(side, orders)
+}
+
+// Clear takes the lock and calls OrderBook.Clear.
+func (s *SyncOrderBook) Clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.OrderBook.Clear()
+}
+
+// UnmarshalBinary takes the lock and calls OrderBook.UnmarshalBinary.
+func (s *SyncOrderBook) UnmarshalBinary(data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.OrderBook.UnmarshalBinary(data)
+}
+
+// InsertPostOnly takes the lock and calls OrderBook.InsertPostOnly,
+// returning a copy of the trades.
+func (s *SyncOrderBook) InsertPostOnly(orderId int, side Side, price float32, volume int) ([]Trade, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	trades, err := s.OrderBook.InsertPostOnly(orderId, side, price, volume)
+	return own(trades), err
+}
+
+// Quote takes the lock and calls OrderBook.Quote, returning a copy
+// of the trades.
+func (s *SyncOrderBook) Quote(accountId int, bidPrice float32, bidVol int, askPrice float32, askVol int) (bidId, askId int, trades []Trade, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	bidId, askId, trades, err = s.OrderBook.Quote(accountId, bidPrice, bidVol, askPrice, askVol)
+	return bidId, askId, own(trades), err
+}
+
+// InsertStop takes the lock and calls OrderBook.InsertStop.
+func (s *SyncOrderBook) InsertStop(orderId int, side Side, stopPrice, limitPrice float32, volume int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.OrderBook.InsertStop(orderId, side, stopPrice, limitPrice, volume)
+}
+
+// InsertTrailingStop takes the lock and calls OrderBook.InsertTrailingStop.
+func (s *SyncOrderBook) InsertTrailingStop(orderId int, side Side, trailOffset float32, volume int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.OrderBook.InsertTrailingStop(orderId, side, trailOffset, volume)
+}
+
+// CancelStop takes the lock and calls OrderBook.CancelStop.
+func (s *SyncOrderBook) CancelStop(orderId int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.OrderBook.CancelStop(orderId)
+}
+
+// InsertConditional takes the lock and calls OrderBook.InsertConditional.
+func (s *SyncOrderBook) InsertConditional(side Side, o *Order, trigger Trigger) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.OrderBook.InsertConditional(side, o, trigger)
+}
+
+// CancelConditional takes the lock and calls OrderBook.CancelConditional.
+func (s *SyncOrderBook) CancelConditional(orderId int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.OrderBook.CancelConditional(orderId)
+}
+
+// InsertSequenced takes the lock and calls OrderBook.InsertSequenced,
+// returning a copy of the trades.
+func (s *SyncOrderBook) InsertSequenced(seq uint64, orderId int, side Side, price float32, volume int) ([]Trade, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	trades, err := s.OrderBook.InsertSequenced(seq, orderId, side, price, volume)
+	return own(trades), err
+}
+
+// UpdateSequenced takes the lock and calls OrderBook.UpdateSequenced,
+// returning a copy of the trades.
+func (s *SyncOrderBook) UpdateSequenced(seq uint64, orderId int, price float32, volume int) ([]Trade, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	trades, err := s.OrderBook.UpdateSequenced(seq, orderId, price, volume)
+	return own(trades), err
+}
+
+// CancelSequenced takes the lock and calls OrderBook.CancelSequenced.
+func (s *SyncOrderBook) CancelSequenced(seq uint64, orderId int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.OrderBook.CancelSequenced(seq, orderId)
+}
+
+// MatchSlice takes the lock and calls OrderBook.MatchSlice, returning a copy
+// of the trades. The lock is held for one slice only, so other operations
+// may change the book before the continuation is resumed.
+func (s *SyncOrderBook) MatchSlice(orderId int, side Side, price float32, volume int, levels int) ([]Trade, *MatchContinuation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	trades, c, err := s.OrderBook.MatchSlice(orderId, side, price, volume, levels)
+	return own(trades), c, err
+}
+
+// ResumeMatch takes the lock and calls OrderBook.ResumeMatch, returning a
+// copy of the trades.
+func (s *SyncOrderBook) ResumeMatch(c *MatchContinuation) ([]Trade, *MatchContinuation) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	trades, c := s.OrderBook.ResumeMatch(c)
+	return own(trades), c
+}
+
+// Seed takes the lock and calls OrderBook.Seed.
+func (s *SyncOrderBook) Seed(refPrice float32, levels int, tickSize float32, sizePerLevel int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.OrderBook.Seed(refPrice, levels, tickSize, sizePerLevel)
+}
+
+// Inspect takes the shared lock and calls OrderBook.Inspect.
+func (s *SyncOrderBook) Inspect(orderId int) (OrderView, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.OrderBook.Inspect(orderId)
+}
+
+// TopOrders takes the shared lock and calls OrderBook.TopOrders.
+func (s *SyncOrderBook) TopOrders(side Side, n int) []*Order {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.OrderBook.TopOrders(side, n)
+}
+
+// Checksum takes the shared lock and calls OrderBook.Checksum.
+func (s *SyncOrderBook) Checksum(depth int) uint32 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.OrderBook.Checksum(depth)
+}
+
+// Snapshot takes the shared lock and calls OrderBook.Snapshot.
+func (s *SyncOrderBook) Snapshot() ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.OrderBook.Snapshot()
+}
+
+// MarshalBinary takes the shared lock and calls OrderBook.MarshalBinary.
+func (s *SyncOrderBook) MarshalBinary() ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.OrderBook.MarshalBinary()
+}
+
+// GetOrder returns a copy of a resting order and its side, since the resting
+// order may be changed by other goroutines once the lock is released.
+func (s *SyncOrderBook) GetOrder(orderId int) (*Order, Side, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	o, side, ok := s.OrderBook.GetOrder(orderId)
+	if !ok {
+		return nil, side, false
+	}
+	c := copyOrder(o)
+	return &c, side, true
+}
+
+// OrdersByOwner returns copies of an account's resting orders, since the
+// resting orders may be changed by other goroutines once the lock is
+// released. It takes the lock exclusively, as looking up the orders prunes
+// stale entries from the owner index.
+func (s *SyncOrderBook) OrdersByOwner(ownerId int) []*Order {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	orders := s.OrderBook.OrdersByOwner(ownerId)
+	for i, o := range orders {
+		c := copyOrder(o)
+		orders[i] = &c
+	}
+	return orders
+}
+
+// State takes the shared lock and calls OrderBook.State.
+func (s *SyncOrderBook) State() BookState {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.OrderBook.State()
+}
+
+// BookView takes the shared lock and calls OrderBook.BookView.
+func (s *SyncOrderBook) BookView() BookView {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.OrderBook.BookView()
+}
+
+// Depth takes the shared lock and calls OrderBook.Depth.
+func (s *SyncOrderBook) Depth(side Side, n int) []LevelUpdate {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.OrderBook.Depth(side, n)
+}
+
+// DepthSnapshot takes the shared lock and calls OrderBook.DepthSnapshot.
+func (s *SyncOrderBook) DepthSnapshot(levels int) ([]Level, []Level) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.OrderBook.DepthSnapshot(levels)
+}
+
+// Mid takes the shared lock and calls OrderBook.Mid.
+func (s *SyncOrderBook) Mid() (float32, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.OrderBook.Mid()
+}
+
+// Microprice takes the shared lock and calls OrderBook.Microprice.
+func (s *SyncOrderBook) Microprice() (float32, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.OrderBook.Microprice()
+}
+
+// Imbalance takes the shared lock and calls OrderBook.Imbalance.
+func (s *SyncOrderBook) Imbalance(levels int) float32 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.OrderBook.Imbalance(levels)
+}
+
+// MakerVolume takes the shared lock and calls OrderBook.MakerVolume.
+func (s *SyncOrderBook) MakerVolume(accountId int) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.OrderBook.MakerVolume(accountId)
+}
+
+// BestExcludingAccount takes the shared lock and calls
+// OrderBook.BestExcludingAccount.
+func (s *SyncOrderBook) BestExcludingAccount(side Side, accountId int) (price float32, volume int, ok bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.OrderBook.BestExcludingAccount(side, accountId)
+}
+
+// AccountConcentration takes the shared lock and calls
+// OrderBook.AccountConcentration.
+func (s *SyncOrderBook) AccountConcentration(side Side) (distinctAccounts int, topAccountVolume int, topAccountId int) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.OrderBook.AccountConcentration(side)
+}
+
+// TouchImbalance takes the shared lock and calls OrderBook.TouchImbalance.
+func (s *SyncOrderBook) TouchImbalance() (float64, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.OrderBook.TouchImbalance()
+}
+
+// ExpectedFillPrice takes the shared lock and calls
+// OrderBook.ExpectedFillPrice.
+func (s *SyncOrderBook) ExpectedFillPrice(side Side, quantity int) (float32, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.OrderBook.ExpectedFillPrice(side, quantity)
+}
+
+// MarketImpact takes the shared lock and calls OrderBook.MarketImpact.
+func (s *SyncOrderBook) MarketImpact(side Side, quantity int) (vwap float32, filled int, exhausted bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.OrderBook.MarketImpact(side, quantity)
+}
+
+// EffectiveSpread takes the shared lock and calls OrderBook.EffectiveSpread.
+func (s *SyncOrderBook) EffectiveSpread(size int) (float32, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.OrderBook.EffectiveSpread(size)
+}
+
+// ShapeMetrics takes the shared lock and calls OrderBook.ShapeMetrics.
+func (s *SyncOrderBook) ShapeMetrics(side Side) ShapeMetrics {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.OrderBook.ShapeMetrics(side)
+}
+
+// VolumeToMid takes the shared lock and calls OrderBook.VolumeToMid.
+func (s *SyncOrderBook) VolumeToMid(side Side) (int, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.OrderBook.VolumeToMid(side)
+}
+
+// DisplayedTouch takes the shared lock and calls OrderBook.DisplayedTouch.
+func (s *SyncOrderBook) DisplayedTouch() (bidPrice float32, bidDisplayVol int, askPrice float32, askDisplayVol int, ok bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.OrderBook.DisplayedTouch()
+}
+
+// QueuePosition takes the shared lock and calls OrderBook.QueuePosition.
+func (s *SyncOrderBook) QueuePosition(orderId int) (ahead int, ok bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.OrderBook.QueuePosition(orderId)
+}
+
+// CumulativeOrderCount takes the shared lock and calls
+// OrderBook.CumulativeOrderCount.
+func (s *SyncOrderBook) CumulativeOrderCount(side Side, price float32) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.OrderBook.CumulativeOrderCount(side, price)
+}
+
+// VolumeAtPrice takes the shared lock and calls OrderBook.VolumeAtPrice.
+func (s *SyncOrderBook) VolumeAtPrice(side Side, price float32) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.OrderBook.VolumeAtPrice(side, price)
+}
+
+// VolumeWithin takes the shared lock and calls OrderBook.VolumeWithin.
+func (s *SyncOrderBook) VolumeWithin(side Side, price float32) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.OrderBook.VolumeWithin(side, price)
+}
+
+// VolumeAtOrBetween takes the shared lock and calls
+// OrderBook.VolumeAtOrBetween.
+func (s *SyncOrderBook) VolumeAtOrBetween(side Side, low, high float32) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.OrderBook.VolumeAtOrBetween(side, low, high)
+}
+
+// TopNInto takes the shared lock and calls OrderBook.TopNInto.
+func (s *SyncOrderBook) TopNInto(side Side, n int, prices []float32, vols []int) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.OrderBook.TopNInto(side, n, prices, vols)
+}
+
+// LevelSizeHistogram takes the shared lock and calls
+// OrderBook.LevelSizeHistogram.
+func (s *SyncOrderBook) LevelSizeHistogram(side Side, price float32) map[int]int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.OrderBook.LevelSizeHistogram(side, price)
+}
+
+// SimulateInsert takes the shared lock and calls OrderBook.SimulateInsert.
+func (s *SyncOrderBook) SimulateInsert(side Side, price float32, volume int) []Trade {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.OrderBook.SimulateInsert(side, price, volume)
+}
+
+// LastAppliedSequence takes the shared lock and calls
+// OrderBook.LastAppliedSequence.
+func (s *SyncOrderBook) LastAppliedSequence() uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.OrderBook.LastAppliedSequence()
+}
+
+// PendingStops takes the shared lock and calls OrderBook.PendingStops.
+func (s *SyncOrderBook) PendingStops() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.OrderBook.PendingStops()
+}
+
+// TrailingStopPrice takes the shared lock and calls
+// OrderBook.TrailingStopPrice.
+func (s *SyncOrderBook) TrailingStopPrice(orderId int) (float32, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.OrderBook.TrailingStopPrice(orderId)
+}
+
+// PendingConditionals takes the shared lock and calls
+// OrderBook.PendingConditionals.
+func (s *SyncOrderBook) PendingConditionals() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.OrderBook.PendingConditionals()
+}
+
+// OldestOrder returns a copy of the oldest order on side, or nil if no order
+// on that side has a Timestamp.
+func (s *SyncOrderBook) OldestOrder(side Side) *Order {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	o := s.OrderBook.OldestOrder(side)
+	if o == nil {
+		return nil
+	}
+	c := copyOrder(o)
+	return &c
+}
+
+// IterateLevels calls fn with the shared lock held, so fn must not call back
+// into the SyncOrderBook, and must not keep the levels it is passed.
+func (s *SyncOrderBook) IterateLevels(side Side, fn func(*Node) bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	s.OrderBook.IterateLevels(side, fn)
+}
+
+// IterateOrders calls fn with the shared lock held, so fn must not call back
+// into the SyncOrderBook, and must not keep the orders it is passed.
+func (s *SyncOrderBook) IterateOrders(side Side, fn func(*Order) bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	s.OrderBook.IterateOrders(side, fn)
+}
+
+// BestBid returns a copy of the best bid, or false if there are no bids.
+func (s *SyncOrderBook) BestBid() (*Order, bool) {
+	o := s.Peek(BID)
+	return o, o != nil
+}
+
+// BestAsk returns a copy of the best ask, or false if there are no asks.
+func (s *SyncOrderBook) BestAsk() (*Order, bool) {
+	o := s.Peek(ASK)
+	return o, o != nil
+}
+
+// Spread takes the shared lock and calls OrderBook.Spread.
+func (s *SyncOrderBook) Spread() (float32, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.OrderBook.Spread()
+}
+
+// Sequence takes the shared lock and calls OrderBook.Sequence.
+func (s *SyncOrderBook) Sequence() uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.OrderBook.Sequence()
+}
+
+// OrderCount takes the shared lock and calls OrderBook.OrderCount.
+func (s *SyncOrderBook) OrderCount(side Side) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.OrderBook.OrderCount(side)
+}
+
+// LevelCount takes the shared lock and calls OrderBook.LevelCount.
+func (s *SyncOrderBook) LevelCount(side Side) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.OrderBook.LevelCount(side)
+}
+
+// TotalVolume takes the shared lock and calls OrderBook.TotalVolume.
+func (s *SyncOrderBook) TotalVolume(side Side) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.OrderBook.TotalVolume(side)
+}
+
+// Len returns the number of price levels on side.
+func (s *SyncOrderBook) Len(side Side) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if side == ASK {
+		return s.OrderBook.AskBook.Len()
+	}
+	return s.OrderBook.BidBook.Len()
+}
+
+// Peek returns a copy of the best order on side, or nil if that side of the
+// book is empty. A copy is returned because the resting order may be changed
+// by other goroutines once the lock is released.
+func (s *SyncOrderBook) Peek(side Side) *Order {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var o *Order
+	if side == ASK {
+		o = s.OrderBook.AskBook.Peek()
+	} else {
+		o = s.OrderBook.BidBook.Peek()
+	}
+	if o == nil {
+		return nil
+	}
+	c := copyOrder(o)
+	return &c
+}
@@ -0,0 +1,218 @@
+// Copyright 2024 Lane A. Shetron
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package orderbook
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"math/rand"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// checkConsistency verifies that the maps and heaps of a book agree.
+func checkConsistency(t *testing.T, ob *OrderBook) {
+	t.Helper()
+	sides := []struct {
+		Side   Side
+		Heap   BaseHeap
+		Less   func(i, j int) bool
+		Orders OrdersMap
+		Levels LevelsMap
+	}{
+		{ASK, ob.AskBook.Orders.BaseHeap, ob.AskBook.Orders.Less, ob.AskBook.OrdersMap, ob.AskBook.LevelsMap},
+		{BID, ob.BidBook.Orders.BaseHeap, ob.BidBook.Orders.Less, ob.BidBook.OrdersMap, ob.BidBook.LevelsMap},
+	}
+	for _, s := range sides {
+		if len(s.Heap) != len(s.Levels) {
+			t.Errorf("%s: %d levels in heap but %d in map", s.Side, len(s.Heap), len(s.Levels))
+		}
+		count := 0
+		for i, n := range s.Heap {
+			if n.index != i || s.Levels[n.Key] != n {
+				t.Errorf("%s: level %v is out of place", s.Side, n.Key)
+			}
+			if i > 0 && s.Less(i, (i-1)/2) {
+				t.Errorf("%s: heap property violated at %d", s.Side, i)
+			}
+			for e := n.Level.Front(); e != nil; e = e.Next() {
+				if o := e.Order(); o.Price != n.Key || s.Orders[o.OrderId] != e {
+					t.Errorf("%s: order %d is out of place", s.Side, o.OrderId)
+				}
+				count++
+			}
+		}
+		if count != len(s.Orders) {
+			t.Errorf("%s: %d orders in levels but %d in map", s.Side, count, len(s.Orders))
+		}
+	}
+	if bid, ask := ob.BidBook.Peek(), ob.AskBook.Peek(); bid != nil && ask != nil && bid.Price >= ask.Price {
+		t.Errorf("Expected an uncrossed book, got %v / %v", bid.Price, ask.Price)
+	}
+}
+
+func TestSyncOrderBook(t *testing.T) {
+	s := NewSyncOrderBook()
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			r := rand.New(rand.NewSource(int64(g)))
+			for i := 0; i < 500; i++ {
+				id := g*1000 + i
+				side := Side(r.Intn(2))
+				trades, _ := s.Insert(id, side, float32(95+r.Intn(10)), 1+r.Intn(5))
+				for j := range trades {
+					trades[j].Volume = -1 // must not affect anyone else
+				}
+				if r.Intn(2) == 0 {
+					s.Cancel(g*1000 + r.Intn(i+1))
+				}
+				s.Peek(BID)
+				s.Depth(ASK, 3)
+			}
+		}(g)
+	}
+	wg.Wait()
+	s.WithLock(func(ob *OrderBook) {
+		checkConsistency(t, ob)
+	})
+}
+
+func TestSyncInsertAuto(t *testing.T) {
+	s := NewSyncOrderBook()
+	ids := make([][]int, 8)
+	var wg sync.WaitGroup
+	for g := range ids {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				id, _, err := s.InsertAuto(Side(i%2), float32(90+g+i%2*20), 1)
+				if err != nil {
+					t.Errorf("Unexpected error: %v", err)
+					return
+				}
+				ids[g] = append(ids[g], id)
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	// Every id is unique, and each caller sees its ids strictly decrease
+	seen := make(map[int]bool)
+	for _, mine := range ids {
+		for i, id := range mine {
+			if seen[id] {
+				t.Fatalf("Expected unique ids, got %d twice", id)
+			}
+			seen[id] = true
+			if i > 0 && id >= mine[i-1] {
+				t.Errorf("Expected ids to decrease, got %d after %d", id, mine[i-1])
+			}
+		}
+	}
+	if len(seen) != 8*200 {
+		t.Errorf("Expected %d ids, got %d", 8*200, len(seen))
+	}
+
+	// The allocator carries on from a snapshot
+	data, _ := s.Snapshot()
+	restored := NewSyncOrderBook()
+	if err := restored.Restore(data); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if id, _, _ := restored.InsertAuto(BID, 80.0, 1); id != -len(seen)-1 {
+		t.Errorf("Expected id %d after restore, got %d", -len(seen)-1, id)
+	}
+}
+
+func TestSyncWrapsOrderBook(t *testing.T) {
+	// Methods promoted from the embedded book would run without the lock,
+	// so every one must be declared on SyncOrderBook itself
+	f, err := parser.ParseFile(token.NewFileSet(), "sync.go", nil, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	declared := make(map[string]bool)
+	for _, d := range f.Decls {
+		if fn, ok := d.(*ast.FuncDecl); ok && fn.Recv != nil {
+			if star, ok := fn.Recv.List[0].Type.(*ast.StarExpr); ok && star.X.(*ast.Ident).Name == "SyncOrderBook" {
+				declared[fn.Name.Name] = true
+			}
+		}
+	}
+
+	ob, wrapped := reflect.TypeOf(&OrderBook{}), reflect.TypeOf(&SyncOrderBook{})
+	for i := 0; i < ob.NumMethod(); i++ {
+		m := ob.Method(i)
+		if !declared[m.Name] {
+			t.Errorf("Expected SyncOrderBook to wrap %s", m.Name)
+			continue
+		}
+		w, _ := wrapped.MethodByName(m.Name)
+		same := m.Type.NumIn() == w.Type.NumIn() && m.Type.NumOut() == w.Type.NumOut()
+		for j := 1; same && j < m.Type.NumIn(); j++ {
+			same = m.Type.In(j) == w.Type.In(j)
+		}
+		for j := 0; same && j < m.Type.NumOut(); j++ {
+			same = m.Type.Out(j) == w.Type.Out(j)
+		}
+		if !same {
+			t.Errorf("Expected %s to have the signature %v, got %v", m.Name, m.Type, w.Type)
+		}
+	}
+}
+
+func TestSyncQueries(t *testing.T) {
+	s := NewSyncOrderBook()
+	trades := 0
+	s.OnTrade(func(Trade) { trades++ })
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			r := rand.New(rand.NewSource(int64(g)))
+			for i := 0; i < 300; i++ {
+				s.InsertOrder(Side(r.Intn(2)), &Order{OrderId: g*1000 + i, Price: px(float64(95 + r.Intn(10))), Quantity: 1 + r.Intn(5), OwnerId: g})
+				if r.Intn(3) == 0 {
+					s.Cancel(g*1000 + r.Intn(i+1))
+				}
+				for _, o := range s.OrdersByOwner(g) {
+					o.Quantity = -1 // a copy, so the book is unaffected
+				}
+				s.MarketImpact(BID, 10)
+				s.QueuePosition(g*1000 + i)
+				s.IterateOrders(ASK, func(o *Order) bool { return o.Quantity > 0 })
+			}
+		}(g)
+	}
+	wg.Wait()
+	s.WithLock(func(ob *OrderBook) {
+		checkConsistency(t, ob)
+		ob.IterateOrders(BID, func(o *Order) bool {
+			if o.Quantity <= 0 {
+				t.Errorf("Expected order %d to keep its quantity, got %d", o.OrderId, o.Quantity)
+			}
+			return true
+		})
+	})
+	if trades == 0 {
+		t.Errorf("Expected the callback registered through the wrapper to see trades")
+	}
+}
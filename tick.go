@@ -0,0 +1,59 @@
+package orderbook
+
+import "math"
+
+// NewOrderBookWithTick creates an OrderBook that snaps every incoming price
+// to the nearest multiple of tick. Prices are converted to the Price of the
+// nearest whole number of ticks, so prices that represent the same tick, such
+// as the float32 sums 0.1+0.6 and 0.7, always share a single price level and
+// trade at exactly the same Price. Prices so large that float32 cannot tell
+// neighbouring ticks apart are rejected with RejectTickPrecision rather than
+// merged into one level.
+func NewOrderBookWithTick(tick float64) *OrderBook {
+	ob := NewOrderBook()
+	ob.tick = tick
+	return ob
+}
+
+// TickPolicy selects what happens to an incoming price that is not a whole
+// number of ticks.
+type TickPolicy uint8
+
+const (
+	// TickSnap moves the price to the nearest tick.
+	TickSnap TickPolicy = iota
+	// TickReject rejects the order with RejectOffTick.
+	TickReject
+)
+
+// SetTickSize sets the book's tick size, as NewOrderBookWithTick does, and
+// how incoming prices that are not on a tick are handled. Prices on a tick
+// are always snapped to its exact Price. A tick of zero disables both.
+func (ob *OrderBook) SetTickSize(tick float64, policy TickPolicy) {
+	ob.tick = tick
+	ob.tickPolicy = policy
+}
+
+// onTick reports whether price is a whole number of ticks, allowing for the
+// few units of float32 rounding that arithmetic on prices can introduce.
+func (ob *OrderBook) onTick(price Price) bool {
+	if ob.tick <= 0 {
+		return true
+	}
+	diff := math.Abs((price - ob.snap(price)).Float())
+	return diff <= math.Max(ob.tick*1e-6, math.Abs(price.Float())*4/(1<<23))
+}
+
+// tickExact reports whether float32 is precise enough around price to hold
+// each tick at a price of its own. Once the gap between neighbouring float32
+// values reaches the tick, adjacent ticks may round to the same float32 and
+// so share a level, e.g. a tick of 0.0001 near 2000.
+func (ob *OrderBook) tickExact(price Price) bool {
+	if ob.tick <= 0 {
+		return true
+	}
+	// Measured a tick further out, in case that crosses into a coarser
+	// power of two
+	p := float32(math.Abs(ob.snap(price).Float()) + ob.tick)
+	return float64(math.Nextafter32(p, float32(math.Inf(1)))-p) < ob.tick
+}
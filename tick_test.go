@@ -0,0 +1,160 @@
+// Copyright 2024 Lane A. Shetron
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package orderbook
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestTickSize(t *testing.T) {
+	var tenth, sum float32 = 0.1, 0
+	for i := 0; i < 10; i++ {
+		sum += tenth
+	}
+	if sum == 1.0 {
+		t.Fatalf("Expected float32 representation error in the test price")
+	}
+
+	// Without a tick size the prices make separate levels
+	ob := NewOrderBook()
+	ob.Insert(1, BID, sum, 1)
+	ob.Insert(2, BID, 1.0, 1)
+	if len(ob.BidBook.LevelsMap) != 2 {
+		t.Errorf("Expected 2 levels without a tick size, got %d", len(ob.BidBook.LevelsMap))
+	}
+
+	ob = NewOrderBookWithTick(0.01)
+	ob.Insert(1, BID, sum, 1)
+	ob.Insert(2, BID, 1.0, 2)
+	ob.Insert(3, BID, tenth+0.6, 4)
+	ob.Insert(4, BID, 0.7, 8)
+	if len(ob.BidBook.LevelsMap) != 2 {
+		t.Fatalf("Expected 2 levels with a tick size, got %d", len(ob.BidBook.LevelsMap))
+	}
+	if v := ob.VolumeAtPrice(BID, 1.0); v != 3 {
+		t.Errorf("Expected 3 at 1.0, got %d", v)
+	}
+	if v := ob.VolumeAtPrice(BID, 0.7); v != 12 {
+		t.Errorf("Expected 12 at 0.7, got %d", v)
+	}
+	if p := ob.BidBook.Peek().Price; p != px(1.0) {
+		t.Errorf("Expected best bid 1.0, got %v", p)
+	}
+
+	trades, _ := ob.Insert(5, ASK, 0.1+0.6, 20)
+	for _, trade := range trades {
+		if trade.Price != px(1.0) && trade.Price != px(0.7) {
+			t.Errorf("Expected trades at canonical prices, got %v", trade.Price)
+		}
+	}
+	if len(trades) != 4 || ob.BidBook.Len() != 0 {
+		t.Errorf("Expected the ask to sweep both levels, got %+v", trades)
+	}
+
+	// Updates snap to the tick as well
+	ob.Insert(6, BID, 0.5, 1)
+	ob.Update(6, 0.5+0.001, 1)
+	if p := ob.BidBook.Peek().Price; p != px(0.5) {
+		t.Errorf("Expected the update to snap back to 0.5, got %v", p)
+	}
+}
+
+func TestTickPolicy(t *testing.T) {
+	var tenth, sum float32 = 0.1, 0
+	for i := 0; i < 10; i++ {
+		sum += tenth
+	}
+
+	// Snapping merges nearby prices into one level before they are pushed
+	ob := NewOrderBook()
+	ob.SetTickSize(0.25, TickSnap)
+	ob.Insert(1, BID, 99.9, 1)
+	ob.Insert(2, BID, 100.0, 1)
+	if n, ok := ob.BidBook.GetLevel(px(100.0)); !ok || n.Level.Len() != 2 || ob.LevelCount(BID) != 1 {
+		t.Errorf("Expected both bids snapped to 100")
+	}
+	ob.Update(2, 100.2, 1)
+	if v, _ := ob.Inspect(2); v.Price != px(100.25) {
+		t.Errorf("Expected the update to snap to 100.25, got %v", v.Price)
+	}
+
+	ob = NewOrderBook()
+	ob.SetTickSize(0.1, TickReject)
+	tests := []struct {
+		name  string
+		price float32
+		ok    bool
+	}{
+		{"on tick", 100.1, true},
+		{"float drift", sum, true},
+		{"off tick", 100.05, false},
+		{"barely off tick", 100.101, false},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ob.Insert(10+i, ASK, tt.price, 1)
+			var rej *RejectError
+			if tt.ok && err != nil {
+				t.Errorf("Expected %v to be accepted, got %v", tt.price, err)
+			}
+			if !tt.ok && (!errors.As(err, &rej) || rej.Reason != RejectOffTick) {
+				t.Errorf("Expected %v to be rejected off tick, got %v", tt.price, err)
+			}
+		})
+	}
+	if _, ok := ob.AskBook.GetLevel(px(1.0)); !ok {
+		t.Errorf("Expected the drifted price to rest at the canonical 1.0")
+	}
+
+	ob.Insert(1, BID, 0.5, 1)
+	var rej *RejectError
+	if _, err := ob.Update(1, 0.55, 1); !errors.As(err, &rej) || rej.Reason != RejectOffTick {
+		t.Errorf("Expected an off-tick update to be rejected, got %v", err)
+	}
+	if v, _ := ob.Inspect(1); v.Price != px(0.5) {
+		t.Errorf("Expected the order to stay at 0.5, got %v", v.Price)
+	}
+
+	// Without a tick size nothing is off tick
+	ob.SetTickSize(0, TickReject)
+	if _, err := ob.Insert(2, BID, 0.123, 1); err != nil {
+		t.Errorf("Expected no tick check, got %v", err)
+	}
+}
+
+func TestTickPrecision(t *testing.T) {
+	// Near 2000 float32 values are further apart than a 0.0001 tick, so
+	// adjacent ticks would share a level
+	ob := NewOrderBookWithTick(0.0001)
+	var rej *RejectError
+	if _, err := ob.Insert(1, BID, 2000.0001, 1); !errors.As(err, &rej) || rej.Reason != RejectTickPrecision {
+		t.Errorf("Expected a price beyond float32 precision to be rejected, got %v", err)
+	}
+	if ob.LevelCount(BID) != 0 {
+		t.Errorf("Expected the book to be unchanged")
+	}
+
+	// Near 1000 every tick still gets a level of its own
+	for i := 0; i < 100; i++ {
+		price := float32(1000 + float64(i)*0.0001)
+		if _, err := ob.Insert(10+i, BID, price, 1); err != nil {
+			t.Fatalf("Expected %v to be accepted, got %v", price, err)
+		}
+	}
+	if n := ob.LevelCount(BID); n != 100 {
+		t.Errorf("Expected 100 levels for 100 ticks, got %d", n)
+	}
+	checkConsistency(t, ob)
+}